@@ -52,6 +52,18 @@ var kubernetesCmd = &cobra.Command{
 			cmd.PersistentFlags().GetInt("service-max-idle-connections-per-host")
 		exitIfError(err)
 
+		serviceOTLPEndpoint, err :=
+			cmd.PersistentFlags().GetString("service-otlp-endpoint")
+		exitIfError(err)
+
+		serviceDrainPeriod, err :=
+			cmd.PersistentFlags().GetDuration("service-drain-period")
+		exitIfError(err)
+
+		serviceReadinessDownstream, err :=
+			cmd.PersistentFlags().GetBool("service-readiness-downstream")
+		exitIfError(err)
+
 		clientImage, err := cmd.PersistentFlags().GetString("client-image")
 		exitIfError(err)
 
@@ -66,7 +78,9 @@ var kubernetesCmd = &cobra.Command{
 
 		manifests, err := kubernetes.ServiceGraphToKubernetesManifests(
 			serviceGraph, serviceNodeSelector, serviceImage,
-			serviceMaxIdleConnectionsPerHost, clientNodeSelector, clientImage, environmentName)
+			serviceMaxIdleConnectionsPerHost, serviceOTLPEndpoint,
+			serviceDrainPeriod, serviceReadinessDownstream,
+			clientNodeSelector, clientImage, environmentName)
 		exitIfError(err)
 
 		fmt.Println(string(manifests))
@@ -80,10 +94,19 @@ func init() {
 	kubernetesCmd.PersistentFlags().Int(
 		"service-max-idle-connections-per-host", 0,
 		"maximum number of connections to keep open per host on each service")
+	kubernetesCmd.PersistentFlags().String(
+		"service-otlp-endpoint", "",
+		"the OTLP/HTTP endpoint services export spans to (tracing is disabled if empty)")
+	kubernetesCmd.PersistentFlags().Duration(
+		"service-drain-period", 0,
+		"how long services keep serving after SIGTERM while failing readiness (the services' default if 0)")
+	kubernetesCmd.PersistentFlags().Bool(
+		"service-readiness-downstream", false,
+		"whether services are only ready while the services they call can be connected to")
 	kubernetesCmd.PersistentFlags().String(
 		"client-image", "", "the image to use for the load testing client job")
 	kubernetesCmd.PersistentFlags().String(
-		"environment-name", "NONE", `the environment name for the test ("NONE" or "ISTIO")`)
+		"environment-name", "NONE", `the environment name for the test ("NONE", "ISTIO", "TLS" or "MTLS")`)
 	kubernetesCmd.PersistentFlags().String(
 		"client-node-selector", "", "the node selector for client workloads")
 	kubernetesCmd.PersistentFlags().String(
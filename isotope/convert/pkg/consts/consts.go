@@ -20,8 +20,19 @@ const (
 
 	// ServicePort is the port the service will run on.
 	ServicePort = 8080
+	// AdminPort is the port the service's debug endpoints run on. It is not
+	// part of the Kubernetes service.
+	AdminPort = 8081
+	// AdminPortName is the name of the container port of the debug endpoints.
+	AdminPortName = "http-admin"
 	// ServicePortName is the name of the service port.
 	ServicePortName = "http-web"
+	// ServiceGRPCPortName is the name of the service port for gRPC services. Its
+	// prefix lets Istio detect the protocol.
+	ServiceGRPCPortName = "grpc-web"
+	// ServiceTCPPortName is the name of the service port for TCP services. Its
+	// prefix makes Istio proxy it as opaque TCP.
+	ServiceTCPPortName = "tcp-web"
 
 	// ServiceGraphNamespace is the name of the namespace that all service graph
 	// related components will live in.
@@ -37,6 +48,19 @@ const (
 	// "${ConfigPath}/${ServiceGraphYAMLFileName}".
 	ServiceGraphConfigMapKey = "service-graph"
 
+	// TLSPath is the directory of the files with which a service serves and
+	// calls other services over TLS.
+	TLSPath = "/etc/certs"
+	// TLSCertFileName is the name of the file which contains the PEM-encoded
+	// certificate of the service.
+	TLSCertFileName = "tls.crt"
+	// TLSKeyFileName is the name of the file which contains the PEM-encoded
+	// private key of the service.
+	TLSKeyFileName = "tls.key"
+	// TLSCAFileName is the name of the file which contains the PEM-encoded
+	// certificate of the CA trusted by the service.
+	TLSCAFileName = "ca.crt"
+
 	// ServiceNameEnvKey is the key of the environment variable whose value is
 	// the name of the service.
 	ServiceNameEnvKey = "SERVICE_NAME"
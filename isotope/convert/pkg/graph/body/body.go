@@ -0,0 +1,154 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package body describes the bodies of a service's responses.
+package body
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Mode names how a response body is filled.
+type Mode string
+
+const (
+	// Random fills bodies with incompressible random bytes.
+	Random Mode = "random"
+	// Text fills bodies with compressible, word-like text.
+	Text Mode = "text"
+	// JSON fills bodies with a JSON document of a Shape.
+	JSON Mode = "json"
+	// Echo responds with the body of the request, whatever its size.
+	Echo Mode = "echo"
+)
+
+// UnmarshalJSON converts a JSON string to a Mode.
+func (m *Mode) UnmarshalJSON(b []byte) (err error) {
+	var s string
+	err = json.Unmarshal(b, &s)
+	if err != nil {
+		return
+	}
+	switch Mode(s) {
+	case Random, Text, JSON, Echo:
+		*m = Mode(s)
+	default:
+		err = InvalidModeError{s}
+	}
+	return
+}
+
+// MaxLeaves is the maximum number of leaves of a Shape.
+const MaxLeaves = 1 << 16
+
+// DefaultShape is the Shape of JSON documents if none is set.
+var DefaultShape = Shape{Depth: 1, Fields: 8}
+
+// Shape describes a JSON document of nested objects. Each object has Fields
+// fields, and the objects at depth Depth have string fields, whose lengths
+// make up the size of the document. A Depth of 0 describes a single string.
+type Shape struct {
+	Depth  int `json:"depth"`
+	Fields int `json:"fields"`
+}
+
+// NumLeaves returns the number of string fields of a document of shape s.
+func (s Shape) NumLeaves() int {
+	n := 1
+	for i := 0; i < s.Depth; i++ {
+		n *= s.Fields
+	}
+	return n
+}
+
+// Body describes how the bodies of a service's responses are filled. A nil
+// Body fills them with random bytes.
+type Body struct {
+	// Mode is how bodies are filled. If unset, it is Random.
+	Mode Mode `json:"mode,omitempty"`
+
+	// Shape is the shape of JSON documents in JSON mode. If unset, it is
+	// DefaultShape.
+	Shape *Shape `json:"shape,omitempty"`
+
+	// SizeHeader, if set, names a request header whose value (e.g. "10KiB")
+	// overrides the sampled size of the response.
+	SizeHeader string `json:"sizeHeader,omitempty"`
+}
+
+// UnmarshalJSON converts b to a Body and validates it.
+func (body *Body) UnmarshalJSON(b []byte) (err error) {
+	var unmarshallable unmarshallableBody
+	err = json.Unmarshal(b, &unmarshallable)
+	if err != nil {
+		return
+	}
+	*body = Body(unmarshallable)
+	if body.Shape != nil {
+		if body.Mode != JSON {
+			err = ErrShapeWithoutJSON
+			return
+		}
+		shape := *body.Shape
+		if shape.Depth < 0 || shape.Fields < 1 || exceedsMaxLeaves(shape) {
+			err = InvalidShapeError{shape}
+			return
+		}
+	}
+	if body.SizeHeader != "" {
+		body.SizeHeader = http.CanonicalHeaderKey(body.SizeHeader)
+	}
+	return
+}
+
+type unmarshallableBody Body
+
+// exceedsMaxLeaves reports whether shape has more than MaxLeaves leaves,
+// without overflowing.
+func exceedsMaxLeaves(shape Shape) bool {
+	n := 1
+	for i := 0; i < shape.Depth; i++ {
+		n *= shape.Fields
+		if n > MaxLeaves {
+			return true
+		}
+	}
+	return false
+}
+
+// BodyMode returns the Mode of body, or Random if body is nil or unset.
+func (body *Body) BodyMode() Mode {
+	if body == nil || body.Mode == "" {
+		return Random
+	}
+	return body.Mode
+}
+
+// BodyShape returns the Shape of JSON documents of body.
+func (body *Body) BodyShape() Shape {
+	if body == nil || body.Shape == nil {
+		return DefaultShape
+	}
+	return *body.Shape
+}
+
+// SizeHeaderName returns the name of the header overriding the size, or ""
+// if body is nil or does not set one.
+func (body *Body) SizeHeaderName() string {
+	if body == nil {
+		return ""
+	}
+	return body.SizeHeader
+}
@@ -0,0 +1,96 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package body
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestBody_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		input []byte
+		body  Body
+		err   error
+	}{
+		{
+			[]byte(`{}`),
+			Body{},
+			nil,
+		},
+		{
+			[]byte(`{"mode": "text", "sizeHeader": "x-response-size"}`),
+			Body{Mode: Text, SizeHeader: "X-Response-Size"},
+			nil,
+		},
+		{
+			[]byte(`{"mode": "json", "shape": {"depth": 2, "fields": 4}}`),
+			Body{Mode: JSON, Shape: &Shape{Depth: 2, Fields: 4}},
+			nil,
+		},
+		{
+			[]byte(`{"mode": "gzip"}`),
+			Body{},
+			InvalidModeError{"gzip"},
+		},
+		{
+			[]byte(`{"mode": "text", "shape": {"depth": 1, "fields": 1}}`),
+			Body{Mode: Text, Shape: &Shape{Depth: 1, Fields: 1}},
+			ErrShapeWithoutJSON,
+		},
+		{
+			[]byte(`{"mode": "json", "shape": {"depth": 1, "fields": 0}}`),
+			Body{Mode: JSON, Shape: &Shape{Depth: 1, Fields: 0}},
+			InvalidShapeError{Shape{Depth: 1, Fields: 0}},
+		},
+		{
+			[]byte(`{"mode": "json", "shape": {"depth": 5, "fields": 100}}`),
+			Body{Mode: JSON, Shape: &Shape{Depth: 5, Fields: 100}},
+			InvalidShapeError{Shape{Depth: 5, Fields: 100}},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			var body Body
+			err := json.Unmarshal(test.input, &body)
+			if test.err != err {
+				t.Errorf("expected %v; actual %v", test.err, err)
+			}
+			if !reflect.DeepEqual(test.body, body) {
+				t.Errorf("expected %+v; actual %+v", test.body, body)
+			}
+		})
+	}
+}
+
+func TestBody_Defaults(t *testing.T) {
+	t.Parallel()
+
+	var nilBody *Body
+	if mode := nilBody.BodyMode(); mode != Random {
+		t.Errorf("expected %v; actual %v", Random, mode)
+	}
+	if shape := nilBody.BodyShape(); shape != DefaultShape {
+		t.Errorf("expected %v; actual %v", DefaultShape, shape)
+	}
+	if name := nilBody.SizeHeaderName(); name != "" {
+		t.Errorf(`expected ""; actual %v`, name)
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package body
+
+import (
+	"errors"
+	"fmt"
+)
+
+// InvalidModeError is returned when a string is not parsable to a Mode.
+type InvalidModeError struct {
+	String string
+}
+
+func (e InvalidModeError) Error() string {
+	return fmt.Sprintf(
+		`unknown body mode: %s (must be "random", "text", "json" or "echo")`,
+		e.String)
+}
+
+// InvalidShapeError is returned when a Shape has a negative depth, no fields
+// or more than MaxLeaves leaves.
+type InvalidShapeError struct {
+	Shape Shape
+}
+
+func (e InvalidShapeError) Error() string {
+	return fmt.Sprintf(
+		"invalid JSON shape: depth %v, fields %v (depth must be non-negative, "+
+			"fields positive and fields^depth at most %v)",
+		e.Shape.Depth, e.Shape.Fields, MaxLeaves)
+}
+
+// ErrShapeWithoutJSON is returned when a Body sets a Shape without being in
+// JSON mode.
+var ErrShapeWithoutJSON = errors.New(`shape requires mode "json"`)
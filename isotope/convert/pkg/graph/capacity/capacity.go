@@ -0,0 +1,80 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package capacity describes how many requests a service serves at once, and
+// what happens to the others.
+package capacity
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/duration"
+)
+
+// Capacity bounds the requests a service serves concurrently. Requests over
+// the bound wait in a queue for one to complete, and are shed, i.e. responded
+// to with ShedCode without running the script, if the queue is full or they
+// waited for QueueTimeout.
+type Capacity struct {
+	// MaxConcurrency is the number of requests served at once.
+	MaxConcurrency int `json:"maxConcurrency"`
+
+	// QueueLength is the number of requests waiting to be served. If unset,
+	// requests over MaxConcurrency are shed right away.
+	QueueLength int `json:"queueLength,omitempty"`
+
+	// QueueTimeout bounds how long a request waits in the queue. If unset,
+	// requests wait until they are served or their caller gives up.
+	QueueTimeout duration.Duration `json:"queueTimeout,omitempty"`
+
+	// ShedCode is the HTTP status code of shed requests, 503 or 429. If
+	// unset, it is 503.
+	ShedCode int `json:"shedCode,omitempty"`
+}
+
+// UnmarshalJSON converts b to a Capacity and validates it.
+func (c *Capacity) UnmarshalJSON(b []byte) (err error) {
+	var unmarshallable unmarshallableCapacity
+	err = json.Unmarshal(b, &unmarshallable)
+	if err != nil {
+		return
+	}
+	*c = Capacity(unmarshallable)
+	if c.MaxConcurrency <= 0 {
+		err = NonPositiveMaxConcurrencyError{c.MaxConcurrency}
+		return
+	}
+	if c.QueueLength < 0 {
+		err = NegativeQueueLengthError{c.QueueLength}
+		return
+	}
+	switch c.ShedCode {
+	case 0, http.StatusServiceUnavailable, http.StatusTooManyRequests:
+	default:
+		err = InvalidShedCodeError{c.ShedCode}
+		return
+	}
+	return
+}
+
+type unmarshallableCapacity Capacity
+
+// Code returns the status code of shed requests.
+func (c Capacity) Code() int {
+	if c.ShedCode == 0 {
+		return http.StatusServiceUnavailable
+	}
+	return c.ShedCode
+}
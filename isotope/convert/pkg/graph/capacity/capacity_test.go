@@ -0,0 +1,105 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/duration"
+)
+
+func TestCapacity_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		input    []byte
+		capacity Capacity
+		err      error
+	}{
+		{
+			[]byte(`{"maxConcurrency": 10}`),
+			Capacity{MaxConcurrency: 10},
+			nil,
+		},
+		{
+			[]byte(`{"maxConcurrency": 10, "queueLength": 20, "queueTimeout": "100ms", "shedCode": 429}`),
+			Capacity{
+				MaxConcurrency: 10,
+				QueueLength:    20,
+				QueueTimeout:   duration.Duration(100 * time.Millisecond),
+				ShedCode:       429,
+			},
+			nil,
+		},
+		{
+			[]byte(`{}`),
+			Capacity{},
+			NonPositiveMaxConcurrencyError{0},
+		},
+		{
+			[]byte(`{"maxConcurrency": -1}`),
+			Capacity{},
+			NonPositiveMaxConcurrencyError{-1},
+		},
+		{
+			[]byte(`{"maxConcurrency": 1, "queueLength": -1}`),
+			Capacity{},
+			NegativeQueueLengthError{-1},
+		},
+		{
+			[]byte(`{"maxConcurrency": 1, "shedCode": 500}`),
+			Capacity{},
+			InvalidShedCodeError{500},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			var capacity Capacity
+			err := json.Unmarshal(test.input, &capacity)
+			if test.err != err {
+				t.Errorf("expected %v; actual %v", test.err, err)
+			}
+			if err == nil && !reflect.DeepEqual(test.capacity, capacity) {
+				t.Errorf("expected %v; actual %v", test.capacity, capacity)
+			}
+		})
+	}
+}
+
+func TestCapacity_Code(t *testing.T) {
+	tests := []struct {
+		capacity Capacity
+		expected int
+	}{
+		{Capacity{MaxConcurrency: 1}, 503},
+		{Capacity{MaxConcurrency: 1, ShedCode: 429}, 429},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			if actual := test.capacity.Code(); actual != test.expected {
+				t.Errorf("expected %v; actual %v", test.expected, actual)
+			}
+		})
+	}
+}
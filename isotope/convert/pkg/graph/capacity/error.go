@@ -0,0 +1,47 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import "fmt"
+
+// NonPositiveMaxConcurrencyError is returned when a Capacity does not allow
+// any request to be served.
+type NonPositiveMaxConcurrencyError struct {
+	MaxConcurrency int
+}
+
+func (e NonPositiveMaxConcurrencyError) Error() string {
+	return fmt.Sprintf(
+		"maxConcurrency %v must be positive", e.MaxConcurrency)
+}
+
+// NegativeQueueLengthError is returned when parsing a negative QueueLength.
+type NegativeQueueLengthError struct {
+	QueueLength int
+}
+
+func (e NegativeQueueLengthError) Error() string {
+	return fmt.Sprintf("queueLength %v must be non-negative", e.QueueLength)
+}
+
+// InvalidShedCodeError is returned when the code of shed requests is neither
+// 503 nor 429.
+type InvalidShedCodeError struct {
+	Code int
+}
+
+func (e InvalidShedCodeError) Error() string {
+	return fmt.Sprintf("invalid shed code: %v (must be 503 or 429)", e.Code)
+}
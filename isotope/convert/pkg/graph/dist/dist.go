@@ -0,0 +1,414 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dist describes probability distributions which values in the
+// service graph, such as sleep durations, are sampled from.
+package dist
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// Type names a family of distributions.
+type Type string
+
+const (
+	// Constant always samples Value.
+	Constant Type = "constant"
+	// Uniform samples evenly between Min and Max.
+	Uniform Type = "uniform"
+	// Normal samples around Mean with a standard deviation of StdDev.
+	Normal Type = "normal"
+	// Exponential samples with a mean of Mean.
+	Exponential Type = "exponential"
+	// LogNormal samples around Median with a shape of Sigma.
+	LogNormal Type = "lognormal"
+	// Pareto samples from Scale upwards with a tail index of Alpha.
+	Pareto Type = "pareto"
+	// Histogram samples from an empirical histogram.
+	Histogram Type = "histogram"
+)
+
+// Distribution is a probability distribution over non-negative values, in
+// the units of whatever is sampled (e.g. nanoseconds or bytes). Only the
+// parameters of its Type are used.
+type Distribution struct {
+	Type Type
+
+	Value  float64
+	Min    float64
+	Max    float64
+	Mean   float64
+	StdDev float64
+	Median float64
+	Sigma  float64
+	Scale  float64
+	Alpha  float64
+
+	// Buckets is the empirical histogram of a Histogram distribution.
+	Buckets *Buckets
+}
+
+// Buckets is an empirical histogram, sorted by UpperBound.
+type Buckets []Bucket
+
+// Bucket holds the values between the previous bucket's UpperBound (or 0) and
+// its own, with a Weight relative to the other buckets.
+type Bucket struct {
+	UpperBound float64
+	Weight     float64
+}
+
+// NewConstant returns a Distribution which always samples v.
+func NewConstant(v float64) Distribution {
+	return Distribution{Type: Constant, Value: v}
+}
+
+// Units converts the values of a distribution from and to their JSON
+// representation, such as "10ms" for durations or "1KiB" for sizes.
+type Units struct {
+	Parse  func(s string) (float64, error)
+	Format func(f float64) string
+}
+
+// Sample returns a random value from d. Negative samples are clamped to 0.
+func (d Distribution) Sample() float64 {
+	var v float64
+	switch d.Type {
+	case Constant:
+		v = d.Value
+	case Uniform:
+		v = d.Min + rand.Float64()*(d.Max-d.Min)
+	case Normal:
+		v = d.Mean + rand.NormFloat64()*d.StdDev
+	case Exponential:
+		v = rand.ExpFloat64() * d.Mean
+	case LogNormal:
+		v = d.Median * math.Exp(rand.NormFloat64()*d.Sigma)
+	case Pareto:
+		// 1 - rand.Float64() is in (0, 1], avoiding a division by zero.
+		v = d.Scale / math.Pow(1-rand.Float64(), 1/d.Alpha)
+	case Histogram:
+		v = d.Buckets.sample()
+	}
+	return math.Max(v, 0)
+}
+
+func (b Buckets) sample() float64 {
+	var total float64
+	for _, bucket := range b {
+		total += bucket.Weight
+	}
+	n := rand.Float64() * total
+	lowerBound := 0.0
+	for _, bucket := range b {
+		if n < bucket.Weight {
+			return lowerBound + rand.Float64()*(bucket.UpperBound-lowerBound)
+		}
+		n -= bucket.Weight
+		lowerBound = bucket.UpperBound
+	}
+	return lowerBound
+}
+
+// Validate returns nil if the parameters of d are valid for its Type.
+func (d Distribution) Validate() error {
+	invalid := func(reason string) error {
+		return InvalidDistributionError{d.Type, reason}
+	}
+	switch d.Type {
+	case Constant:
+		if d.Value < 0 {
+			return invalid("value must be non-negative")
+		}
+	case Uniform:
+		if d.Min < 0 || d.Max < d.Min {
+			return invalid("min must be non-negative and at most max")
+		}
+	case Normal:
+		if d.Mean < 0 || d.StdDev < 0 {
+			return invalid("mean and stddev must be non-negative")
+		}
+	case Exponential:
+		if d.Mean <= 0 {
+			return invalid("mean must be positive")
+		}
+	case LogNormal:
+		if d.Median <= 0 || d.Sigma < 0 {
+			return invalid("median must be positive and sigma non-negative")
+		}
+	case Pareto:
+		if d.Scale <= 0 || d.Alpha <= 0 {
+			return invalid("scale and alpha must be positive")
+		}
+	case Histogram:
+		return d.Buckets.validate(invalid)
+	default:
+		return UnknownTypeError{d.Type}
+	}
+	return nil
+}
+
+func (b *Buckets) validate(invalid func(string) error) error {
+	if b == nil || len(*b) == 0 {
+		return invalid("must have at least one bucket")
+	}
+	var total float64
+	lowerBound := 0.0
+	for _, bucket := range *b {
+		if bucket.UpperBound < lowerBound {
+			return invalid("upper bounds must be non-negative and ascending")
+		}
+		if bucket.Weight < 0 {
+			return invalid("weights must be non-negative")
+		}
+		lowerBound = bucket.UpperBound
+		total += bucket.Weight
+	}
+	if total == 0 {
+		return invalid("weights must not all be zero")
+	}
+	return nil
+}
+
+// Format describes d using units, e.g. "normal(mean=10ms, stddev=2ms)". A
+// Constant is described by its value alone.
+func (d Distribution) Format(units Units) string {
+	if d.Type == Constant {
+		return units.Format(d.Value)
+	}
+	params := d.params(units)
+	parts := make([]string, 0, len(params))
+	for _, p := range params {
+		parts = append(parts, fmt.Sprintf("%s=%s", p.key, p.value))
+	}
+	return fmt.Sprintf("%s(%s)", d.Type, strings.Join(parts, ", "))
+}
+
+type param struct {
+	key   string
+	value string
+}
+
+// params lists the parameters of d in the order they are written.
+func (d Distribution) params(units Units) []param {
+	f := units.Format
+	switch d.Type {
+	case Constant:
+		return []param{{"value", f(d.Value)}}
+	case Uniform:
+		return []param{{"min", f(d.Min)}, {"max", f(d.Max)}}
+	case Normal:
+		return []param{{"mean", f(d.Mean)}, {"stddev", f(d.StdDev)}}
+	case Exponential:
+		return []param{{"mean", f(d.Mean)}}
+	case LogNormal:
+		return []param{{"median", f(d.Median)}, {"sigma", formatFloat(d.Sigma)}}
+	case Pareto:
+		return []param{{"scale", f(d.Scale)}, {"alpha", formatFloat(d.Alpha)}}
+	case Histogram:
+		n := 0
+		if d.Buckets != nil {
+			n = len(*d.Buckets)
+		}
+		return []param{{"buckets", strconv.Itoa(n)}}
+	default:
+		return nil
+	}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// Marshal encodes d as JSON using units. A Constant is encoded as its value
+// alone; other types as a JSON object. Histograms are always encoded with
+// their buckets inline, even if they were loaded from a file.
+func (d Distribution) Marshal(units Units) ([]byte, error) {
+	if d.Type == Constant {
+		return json.Marshal(units.Format(d.Value))
+	}
+	m := map[string]interface{}{distributionKey: d.Type}
+	switch d.Type {
+	case LogNormal:
+		m["median"] = units.Format(d.Median)
+		m["sigma"] = d.Sigma
+	case Pareto:
+		m["scale"] = units.Format(d.Scale)
+		m["alpha"] = d.Alpha
+	case Histogram:
+		buckets := make([]map[string]interface{}, 0)
+		if d.Buckets != nil {
+			for _, b := range *d.Buckets {
+				buckets = append(buckets, map[string]interface{}{
+					"le":     units.Format(b.UpperBound),
+					"weight": b.Weight,
+				})
+			}
+		}
+		m["buckets"] = buckets
+	default:
+		for _, p := range d.params(units) {
+			m[p.key] = p.value
+		}
+	}
+	return json.Marshal(m)
+}
+
+const distributionKey = "distribution"
+
+// jsonDistribution is the JSON object form of a Distribution, before its
+// values are parsed with Units.
+type jsonDistribution struct {
+	Distribution Type            `json:"distribution"`
+	Value        json.RawMessage `json:"value"`
+	Min          json.RawMessage `json:"min"`
+	Max          json.RawMessage `json:"max"`
+	Mean         json.RawMessage `json:"mean"`
+	StdDev       json.RawMessage `json:"stddev"`
+	Median       json.RawMessage `json:"median"`
+	Sigma        float64         `json:"sigma"`
+	Scale        json.RawMessage `json:"scale"`
+	Alpha        float64         `json:"alpha"`
+	File         string          `json:"file"`
+	Buckets      []jsonBucket    `json:"buckets"`
+}
+
+type jsonBucket struct {
+	UpperBound json.RawMessage `json:"le"`
+	Weight     float64         `json:"weight"`
+}
+
+// Unmarshal converts b to a Distribution using units. If b is a JSON string
+// or number, it is parsed as the value of a Constant. If b is a JSON object,
+// its "distribution" key names the Type and its other keys the parameters.
+// A Histogram's buckets may be inline or loaded from a file with one
+// "upperBound,weight" pair per line.
+func Unmarshal(b []byte, units Units) (d Distribution, err error) {
+	isJSONObject := b[0] == '{'
+	if !isJSONObject {
+		d.Type = Constant
+		d.Value, err = parseValue(b, units)
+		return
+	}
+
+	var j jsonDistribution
+	err = json.Unmarshal(b, &j)
+	if err != nil {
+		return
+	}
+	d.Type = j.Distribution
+	d.Sigma = j.Sigma
+	d.Alpha = j.Alpha
+	values := []struct {
+		raw json.RawMessage
+		f   *float64
+	}{
+		{j.Value, &d.Value},
+		{j.Min, &d.Min},
+		{j.Max, &d.Max},
+		{j.Mean, &d.Mean},
+		{j.StdDev, &d.StdDev},
+		{j.Median, &d.Median},
+		{j.Scale, &d.Scale},
+	}
+	for _, v := range values {
+		if v.raw == nil {
+			continue
+		}
+		*v.f, err = parseValue(v.raw, units)
+		if err != nil {
+			return
+		}
+	}
+
+	if d.Type == Histogram {
+		var buckets Buckets
+		if j.File != "" {
+			buckets, err = bucketsFromFile(j.File, units)
+		} else {
+			buckets, err = bucketsFromJSON(j.Buckets, units)
+		}
+		if err != nil {
+			return
+		}
+		d.Buckets = &buckets
+	}
+	return
+}
+
+// parseValue parses a JSON string or number with units.
+func parseValue(b json.RawMessage, units Units) (float64, error) {
+	isJSONString := b[0] == '"'
+	if isJSONString {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return 0, err
+		}
+		return units.Parse(s)
+	}
+	return units.Parse(string(b))
+}
+
+func bucketsFromJSON(jsonBuckets []jsonBucket, units Units) (Buckets, error) {
+	buckets := make(Buckets, 0, len(jsonBuckets))
+	for _, j := range jsonBuckets {
+		if j.UpperBound == nil {
+			return nil, InvalidDistributionError{Histogram, "buckets must set le"}
+		}
+		upperBound, err := parseValue(j.UpperBound, units)
+		if err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, Bucket{upperBound, j.Weight})
+	}
+	return buckets, nil
+}
+
+func bucketsFromFile(path string, units Units) (Buckets, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var buckets Buckets
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.Split(line, ",")
+		if len(parts) != 2 {
+			return nil, InvalidHistogramLineError{path, lineNum, line}
+		}
+		upperBound, err := units.Parse(strings.TrimSpace(parts[0]))
+		if err != nil {
+			return nil, InvalidHistogramLineError{path, lineNum, line}
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil {
+			return nil, InvalidHistogramLineError{path, lineNum, line}
+		}
+		buckets = append(buckets, Bucket{upperBound, weight})
+	}
+	return buckets, scanner.Err()
+}
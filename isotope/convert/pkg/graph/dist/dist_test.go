@@ -0,0 +1,206 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dist
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// plainUnits parses and formats values as plain numbers.
+var plainUnits = Units{
+	Parse: func(s string) (float64, error) {
+		return strconv.ParseFloat(s, 64)
+	},
+	Format: formatFloat,
+}
+
+func TestUnmarshal(t *testing.T) {
+	tests := []struct {
+		input        []byte
+		distribution Distribution
+		err          error
+	}{
+		{
+			[]byte(`5`),
+			Distribution{Type: Constant, Value: 5},
+			nil,
+		},
+		{
+			[]byte(`"5"`),
+			Distribution{Type: Constant, Value: 5},
+			nil,
+		},
+		{
+			[]byte(`{"distribution": "uniform", "min": 1, "max": "2"}`),
+			Distribution{Type: Uniform, Min: 1, Max: 2},
+			nil,
+		},
+		{
+			[]byte(`{"distribution": "lognormal", "median": 3, "sigma": 0.5}`),
+			Distribution{Type: LogNormal, Median: 3, Sigma: 0.5},
+			nil,
+		},
+		{
+			[]byte(`{"distribution": "histogram", "buckets": [
+				{"le": 1, "weight": 3},
+				{"le": 10, "weight": 1}
+			]}`),
+			Distribution{
+				Type:    Histogram,
+				Buckets: &Buckets{{1, 3}, {10, 1}},
+			},
+			nil,
+		},
+		{
+			[]byte(`{"distribution": "histogram", "buckets": [{"weight": 3}]}`),
+			Distribution{},
+			InvalidDistributionError{Histogram, "buckets must set le"},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			distribution, err := Unmarshal(test.input, plainUnits)
+			if test.err != err {
+				t.Errorf("expected %v; actual %v", test.err, err)
+			}
+			if err == nil && !reflect.DeepEqual(test.distribution, distribution) {
+				t.Errorf("expected %v; actual %v", test.distribution, distribution)
+			}
+		})
+	}
+}
+
+func TestUnmarshal_HistogramFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "histogram.csv")
+	contents := "# upperBound,weight\n1,3\n\n10, 1\n"
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(map[string]string{
+		"distribution": "histogram",
+		"file":         path,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	distribution, err := Unmarshal(b, plainUnits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Distribution{Type: Histogram, Buckets: &Buckets{{1, 3}, {10, 1}}}
+	if !reflect.DeepEqual(expected, distribution) {
+		t.Errorf("expected %v; actual %v", expected, distribution)
+	}
+
+	badPath := filepath.Join(dir, "bad.csv")
+	if err := ioutil.WriteFile(badPath, []byte("1;3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	b, err = json.Marshal(map[string]string{
+		"distribution": "histogram",
+		"file":         badPath,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Unmarshal(b, plainUnits)
+	expectedErr := InvalidHistogramLineError{badPath, 1, "1;3"}
+	if expectedErr != err {
+		t.Errorf("expected %v; actual %v", expectedErr, err)
+	}
+}
+
+func TestDistribution_Validate(t *testing.T) {
+	tests := []struct {
+		distribution Distribution
+		valid        bool
+	}{
+		{Distribution{Type: Constant, Value: 0}, true},
+		{Distribution{Type: Constant, Value: -1}, false},
+		{Distribution{Type: Uniform, Min: 1, Max: 2}, true},
+		{Distribution{Type: Uniform, Min: 2, Max: 1}, false},
+		{Distribution{Type: Normal, Mean: 1, StdDev: 0}, true},
+		{Distribution{Type: Normal, Mean: 1, StdDev: -1}, false},
+		{Distribution{Type: Exponential, Mean: 1}, true},
+		{Distribution{Type: Exponential}, false},
+		{Distribution{Type: LogNormal, Median: 1, Sigma: 1}, true},
+		{Distribution{Type: LogNormal, Sigma: 1}, false},
+		{Distribution{Type: Pareto, Scale: 1, Alpha: 2}, true},
+		{Distribution{Type: Pareto, Scale: 1}, false},
+		{Distribution{Type: Histogram, Buckets: &Buckets{{1, 1}}}, true},
+		{Distribution{Type: Histogram, Buckets: &Buckets{}}, false},
+		{Distribution{Type: Histogram, Buckets: &Buckets{{2, 1}, {1, 1}}}, false},
+		{Distribution{Type: Histogram, Buckets: &Buckets{{1, 0}}}, false},
+		{Distribution{Type: "zipf"}, false},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			err := test.distribution.Validate()
+			if test.valid != (err == nil) {
+				t.Errorf("expected valid to be %v; actual error %v", test.valid, err)
+			}
+		})
+	}
+}
+
+func TestDistribution_Sample(t *testing.T) {
+	tests := []struct {
+		distribution Distribution
+		min          float64
+		max          float64
+	}{
+		{Distribution{Type: Constant, Value: 3}, 3, 3},
+		{Distribution{Type: Uniform, Min: 1, Max: 2}, 1, 2},
+		{Distribution{Type: Normal, Mean: 0, StdDev: 1}, 0, 100},
+		{Distribution{Type: Pareto, Scale: 5, Alpha: 2}, 5, 1e9},
+		{Distribution{Type: Histogram, Buckets: &Buckets{{1, 0}, {10, 1}}}, 1, 10},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			for i := 0; i < 1000; i++ {
+				v := test.distribution.Sample()
+				if v < test.min || v > test.max {
+					t.Fatalf("expected sample in [%v, %v]; actual %v",
+						test.min, test.max, v)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dist
+
+import "fmt"
+
+// UnknownTypeError is returned when a distribution's type is not known.
+type UnknownTypeError struct {
+	Type Type
+}
+
+func (e UnknownTypeError) Error() string {
+	return fmt.Sprintf("unknown distribution: %q", e.Type)
+}
+
+// InvalidDistributionError is returned when a distribution's parameters are
+// not valid for its type.
+type InvalidDistributionError struct {
+	Type   Type
+	Reason string
+}
+
+func (e InvalidDistributionError) Error() string {
+	return fmt.Sprintf("invalid %s distribution: %s", e.Type, e.Reason)
+}
+
+// InvalidHistogramLineError is returned when a line of a histogram file is
+// not an "upperBound,weight" pair.
+type InvalidHistogramLineError struct {
+	Path string
+	Line int
+	Text string
+}
+
+func (e InvalidHistogramLineError) Error() string {
+	return fmt.Sprintf(
+		`%s:%d: invalid histogram bucket "%s" (must be "upperBound,weight")`,
+		e.Path, e.Line, e.Text)
+}
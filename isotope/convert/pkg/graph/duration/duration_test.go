@@ -0,0 +1,59 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package duration
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDuration_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		input    []byte
+		duration Duration
+		err      error
+	}{
+		{[]byte(`"100ms"`), Duration(100 * time.Millisecond), nil},
+		{[]byte(`"1m30s"`), Duration(90 * time.Second), nil},
+		{[]byte(`"-1s"`), 0, NegativeDurationError{"-1s"}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			var duration Duration
+			err := json.Unmarshal(test.input, &duration)
+			if test.err != err {
+				t.Errorf("expected %v; actual %v", test.err, err)
+			}
+			if test.duration != duration {
+				t.Errorf("expected %v; actual %v", test.duration, duration)
+			}
+		})
+	}
+}
+
+func TestDuration_MarshalJSON(t *testing.T) {
+	output, err := json.Marshal(Duration(1500 * time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(output) != `"1.5s"` {
+		t.Errorf(`expected "1.5s"; actual %s`, output)
+	}
+}
@@ -0,0 +1,26 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package duration
+
+import "fmt"
+
+// NegativeDurationError is returned when parsing a negative duration.
+type NegativeDurationError struct {
+	String string
+}
+
+func (e NegativeDurationError) Error() string {
+	return fmt.Sprintf("duration %s must be non-negative", e.String)
+}
@@ -0,0 +1,70 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fault
+
+import (
+	"errors"
+	"fmt"
+)
+
+// InvalidCodeError is returned when a code is not an HTTP error status code.
+type InvalidCodeError struct {
+	Code int
+}
+
+func (e InvalidCodeError) Error() string {
+	return fmt.Sprintf(
+		"invalid error code: %v (must be between 400 and 599)", e.Code)
+}
+
+// InvalidWeightError is returned when parsing a code with a weight which is
+// not positive, or exceeds the sum weights are bounded by.
+type InvalidWeightError struct {
+	Weight int
+}
+
+func (e InvalidWeightError) Error() string {
+	return fmt.Sprintf(
+		"weight %v must be between 1 and %d", e.Weight, maxTotalWeight)
+}
+
+// ErrTotalWeightTooLarge is returned when the weights of an Injection's codes
+// add up to more than maxTotalWeight.
+var ErrTotalWeightTooLarge = fmt.Errorf(
+	"the weights of error codes must add up to at most %d", maxTotalWeight)
+
+// InvalidTimingError is returned when a string is not parsable to a Timing.
+type InvalidTimingError struct {
+	String string
+}
+
+func (e InvalidTimingError) Error() string {
+	return fmt.Sprintf(
+		`unknown error timing: %s (must be "before" or "after")`, e.String)
+}
+
+// NegativeAfterStepError is returned when parsing a negative AfterStep.
+type NegativeAfterStepError struct {
+	AfterStep int
+}
+
+func (e NegativeAfterStepError) Error() string {
+	return fmt.Sprintf("afterStep %v must be non-negative", e.AfterStep)
+}
+
+// ErrAfterStepBeforeScript is returned when an Injection both aborts after a
+// step and returns its error before the script runs.
+var ErrAfterStepBeforeScript = errors.New(
+	`afterStep cannot be combined with timing "before"`)
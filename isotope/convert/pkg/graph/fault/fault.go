@@ -0,0 +1,186 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fault describes the errors a service injects into its responses.
+package fault
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+)
+
+// Injection describes how a service fails when its error rate is hit.
+type Injection struct {
+	// Codes are the HTTP status codes to respond with, each picked according
+	// to its weight. If unset, the service responds with 500.
+	Codes []Code `json:"codes,omitempty"`
+
+	// Timing is whether the error is returned before or after the script runs.
+	// If unset, the script runs before responding with the error.
+	Timing Timing `json:"timing,omitempty"`
+
+	// AfterStep, if set, aborts the script with the error after its first
+	// AfterStep steps have run, skipping the rest.
+	AfterStep int `json:"afterStep,omitempty"`
+}
+
+// UnmarshalJSON converts b to an Injection and validates it.
+func (i *Injection) UnmarshalJSON(b []byte) (err error) {
+	var unmarshallable unmarshallableInjection
+	err = json.Unmarshal(b, &unmarshallable)
+	if err != nil {
+		return
+	}
+	*i = Injection(unmarshallable)
+	total := 0
+	for _, c := range i.Codes {
+		total += c.weight()
+		if total > maxTotalWeight {
+			err = ErrTotalWeightTooLarge
+			return
+		}
+	}
+	if i.AfterStep < 0 {
+		err = NegativeAfterStepError{i.AfterStep}
+		return
+	}
+	if i.AfterStep > 0 && i.Timing == Before {
+		err = ErrAfterStepBeforeScript
+		return
+	}
+	return
+}
+
+type unmarshallableInjection Injection
+
+// PickCode returns one of i.Codes according to their weights. A nil Injection
+// or one without codes always picks 500.
+func (i *Injection) PickCode() int {
+	if i == nil || len(i.Codes) == 0 {
+		return http.StatusInternalServerError
+	}
+	total := 0
+	for _, c := range i.Codes {
+		total += c.weight()
+	}
+	n := rand.Intn(total)
+	for _, c := range i.Codes {
+		n -= c.weight()
+		if n < 0 {
+			return c.Code
+		}
+	}
+	return i.Codes[len(i.Codes)-1].Code
+}
+
+// NumStepsBeforeAbort returns how many of a script's numSteps steps run
+// before the injected error is returned. A nil Injection runs them all.
+func (i *Injection) NumStepsBeforeAbort(numSteps int) int {
+	if i == nil {
+		return numSteps
+	}
+	switch {
+	case i.Timing == Before:
+		return 0
+	case i.AfterStep > 0 && i.AfterStep < numSteps:
+		return i.AfterStep
+	default:
+		return numSteps
+	}
+}
+
+// Code is an HTTP status code to respond with and its relative weight. It can
+// be unmarshalled from a JSON number or a JSON object.
+type Code struct {
+	Code int `json:"code"`
+	// Weight is relative to the other codes' weights. If unset, it is 1; an
+	// explicit weight must be positive.
+	Weight int `json:"weight,omitempty"`
+}
+
+// maxTotalWeight bounds the sum of the weights of an Injection's codes, so
+// that picking one cannot overflow.
+const maxTotalWeight = 1000000
+
+func (c Code) weight() int {
+	if c.Weight == 0 {
+		return 1
+	}
+	return c.Weight
+}
+
+// UnmarshalJSON converts a JSON number or object to a Code. The code must be
+// an HTTP error status code, between 400 and 599.
+func (c *Code) UnmarshalJSON(b []byte) (err error) {
+	isJSONObject := b[0] == '{'
+	if isJSONObject {
+		var unmarshallable unmarshallableCode
+		err = json.Unmarshal(b, &unmarshallable)
+		if err != nil {
+			return
+		}
+		*c = Code{Code: unmarshallable.Code}
+		if w := unmarshallable.Weight; w != nil {
+			if *w <= 0 || *w > maxTotalWeight {
+				err = InvalidWeightError{*w}
+				return
+			}
+			c.Weight = *w
+		}
+	} else {
+		*c = Code{}
+		err = json.Unmarshal(b, &c.Code)
+		if err != nil {
+			return
+		}
+	}
+	if c.Code < 400 || c.Code > 599 {
+		err = InvalidCodeError{c.Code}
+		return
+	}
+	return
+}
+
+// unmarshallableCode tells an explicit weight apart from an unset one.
+type unmarshallableCode struct {
+	Code   int  `json:"code"`
+	Weight *int `json:"weight"`
+}
+
+// Timing describes when an injected error is returned relative to the script.
+type Timing string
+
+const (
+	// Before returns the error without running the script.
+	Before Timing = "before"
+	// After runs the script, then returns the error.
+	After Timing = "after"
+)
+
+// UnmarshalJSON converts a JSON string to a Timing.
+func (t *Timing) UnmarshalJSON(b []byte) (err error) {
+	var s string
+	err = json.Unmarshal(b, &s)
+	if err != nil {
+		return
+	}
+	switch Timing(s) {
+	case Before, After:
+		*t = Timing(s)
+	default:
+		err = InvalidTimingError{s}
+	}
+	return
+}
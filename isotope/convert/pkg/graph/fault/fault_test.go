@@ -0,0 +1,160 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fault
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestInjection_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		input     []byte
+		injection Injection
+		err       error
+	}{
+		{
+			[]byte(`{}`),
+			Injection{},
+			nil,
+		},
+		{
+			[]byte(`{"codes": [503, {"code": 429, "weight": 3}]}`),
+			Injection{Codes: []Code{{Code: 503}, {Code: 429, Weight: 3}}},
+			nil,
+		},
+		{
+			[]byte(`{"timing": "before"}`),
+			Injection{Timing: Before},
+			nil,
+		},
+		{
+			[]byte(`{"afterStep": 2}`),
+			Injection{AfterStep: 2},
+			nil,
+		},
+		{
+			[]byte(`{"codes": [200]}`),
+			Injection{},
+			InvalidCodeError{200},
+		},
+		{
+			[]byte(`{"codes": [{"code": 500, "weight": -1}]}`),
+			Injection{},
+			InvalidWeightError{-1},
+		},
+		{
+			[]byte(`{"codes": [{"code": 500, "weight": 0}]}`),
+			Injection{},
+			InvalidWeightError{0},
+		},
+		{
+			[]byte(`{"codes": [{"code": 500, "weight": 1000000}, 503]}`),
+			Injection{},
+			ErrTotalWeightTooLarge,
+		},
+		{
+			[]byte(`{"timing": "during"}`),
+			Injection{},
+			InvalidTimingError{"during"},
+		},
+		{
+			[]byte(`{"afterStep": -1}`),
+			Injection{AfterStep: -1},
+			NegativeAfterStepError{-1},
+		},
+		{
+			[]byte(`{"timing": "before", "afterStep": 1}`),
+			Injection{Timing: Before, AfterStep: 1},
+			ErrAfterStepBeforeScript,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			var injection Injection
+			err := json.Unmarshal(test.input, &injection)
+			if test.err != err {
+				t.Errorf("expected %v; actual %v", test.err, err)
+			}
+			if err == nil && !reflect.DeepEqual(test.injection, injection) {
+				t.Errorf("expected %v; actual %v", test.injection, injection)
+			}
+		})
+	}
+}
+
+func TestInjection_PickCode(t *testing.T) {
+	tests := []struct {
+		injection *Injection
+		codes     map[int]bool
+	}{
+		{nil, map[int]bool{500: true}},
+		{&Injection{}, map[int]bool{500: true}},
+		{
+			&Injection{Codes: []Code{{Code: 503}}},
+			map[int]bool{503: true},
+		},
+		{
+			&Injection{Codes: []Code{{Code: 503}, {Code: 429, Weight: 2}}},
+			map[int]bool{503: true, 429: true},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			for i := 0; i < 100; i++ {
+				code := test.injection.PickCode()
+				if !test.codes[code] {
+					t.Errorf("expected one of %v; actual %v", test.codes, code)
+				}
+			}
+		})
+	}
+}
+
+func TestInjection_NumStepsBeforeAbort(t *testing.T) {
+	tests := []struct {
+		injection *Injection
+		numSteps  int
+		expected  int
+	}{
+		{nil, 3, 3},
+		{&Injection{}, 3, 3},
+		{&Injection{Timing: After}, 3, 3},
+		{&Injection{Timing: Before}, 3, 0},
+		{&Injection{AfterStep: 1}, 3, 1},
+		{&Injection{AfterStep: 5}, 3, 3},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			actual := test.injection.NumStepsBeforeAbort(test.numSteps)
+			if test.expected != actual {
+				t.Errorf("expected %v; actual %v", test.expected, actual)
+			}
+		})
+	}
+}
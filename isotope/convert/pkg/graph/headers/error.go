@@ -0,0 +1,39 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package headers
+
+import (
+	"fmt"
+)
+
+// InvalidNameError is returned when a string is not a valid header name.
+type InvalidNameError struct {
+	Name string
+}
+
+func (e InvalidNameError) Error() string {
+	return fmt.Sprintf("invalid header name: %q", e.Name)
+}
+
+// InvalidTemplateError is returned when a header value cannot be parsed as a
+// template.
+type InvalidTemplateError struct {
+	Text string
+	Err  error
+}
+
+func (e InvalidTemplateError) Error() string {
+	return fmt.Sprintf("invalid header template %q: %s", e.Text, e.Err)
+}
@@ -0,0 +1,173 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package headers describes which headers a service forwards to, sets on,
+// and echoes from the requests it handles, and templates values from the
+// inbound request.
+package headers
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"strings"
+	"text/template"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// Policy describes how a service handles headers. Header names are stored in
+// their canonical form.
+type Policy struct {
+	// Forward lists the inbound headers which are forwarded to every call. If
+	// nil, the request ID and trace context headers are forwarded.
+	Forward []string `json:"forward,omitempty"`
+
+	// Set maps headers which are added to, or overwritten on, every call to
+	// their values.
+	Set map[string]Template `json:"set,omitempty"`
+
+	// Echo lists the inbound headers which are copied into the response.
+	Echo []string `json:"echo,omitempty"`
+}
+
+// UnmarshalJSON converts b to a Policy, validating and canonicalizing its
+// header names.
+func (p *Policy) UnmarshalJSON(b []byte) (err error) {
+	var unmarshallable unmarshallablePolicy
+	err = json.Unmarshal(b, &unmarshallable)
+	if err != nil {
+		return
+	}
+	forward, err := canonicalNames(unmarshallable.Forward)
+	if err != nil {
+		return
+	}
+	echo, err := canonicalNames(unmarshallable.Echo)
+	if err != nil {
+		return
+	}
+	var set map[string]Template
+	if unmarshallable.Set != nil {
+		set = make(map[string]Template, len(unmarshallable.Set))
+		for name, value := range unmarshallable.Set {
+			if !httpguts.ValidHeaderFieldName(name) {
+				err = InvalidNameError{name}
+				return
+			}
+			set[http.CanonicalHeaderKey(name)] = value
+		}
+	}
+	*p = Policy{Forward: forward, Set: set, Echo: echo}
+	return
+}
+
+type unmarshallablePolicy Policy
+
+func canonicalNames(names []string) ([]string, error) {
+	if names == nil {
+		return nil, nil
+	}
+	canonical := make([]string, 0, len(names))
+	for _, name := range names {
+		if !httpguts.ValidHeaderFieldName(name) {
+			return nil, InvalidNameError{name}
+		}
+		canonical = append(canonical, http.CanonicalHeaderKey(name))
+	}
+	return canonical, nil
+}
+
+// Data is the request data available to a Template.
+type Data struct {
+	// Service is the name of the service handling the request.
+	Service string
+	// Destination is the name of the service being called, if any.
+	Destination string
+	// Method is the HTTP method of the inbound request.
+	Method string
+	// Path is the path of the inbound request.
+	Path string
+	// Header is the header of the inbound request.
+	Header http.Header
+}
+
+// Template is a value, such as a header value or the path of a call,
+// optionally templated from the request Data with text/template, e.g.
+// `{{ .Header.Get "X-User" }}-{{ .Service }}` or `/users/{{ randInt 1 100 }}`.
+type Template struct {
+	text string
+	// tmpl is nil if text is a static value.
+	tmpl *template.Template
+}
+
+// NewTemplate parses text to a Template.
+func NewTemplate(text string) (t Template, err error) {
+	t.text = text
+	if !strings.Contains(text, "{{") {
+		return
+	}
+	t.tmpl, err = template.New("").
+		Option("missingkey=error").
+		Funcs(funcs).
+		Parse(text)
+	if err != nil {
+		err = InvalidTemplateError{text, err}
+	}
+	return
+}
+
+// funcs are the functions available to a Template in addition to the
+// text/template builtins.
+var funcs = template.FuncMap{
+	// randInt returns a random integer between min and max inclusive.
+	"randInt": func(min int, max int) int {
+		if max <= min {
+			return min
+		}
+		return min + rand.Intn(max-min+1)
+	},
+}
+
+// Execute returns the value of t for data.
+func (t Template) Execute(data Data) (string, error) {
+	if t.tmpl == nil {
+		return t.text, nil
+	}
+	var b strings.Builder
+	if err := t.tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func (t Template) String() string {
+	return t.text
+}
+
+// MarshalJSON encodes the Template as its text.
+func (t Template) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.text)
+}
+
+// UnmarshalJSON parses a JSON string to a Template.
+func (t *Template) UnmarshalJSON(b []byte) (err error) {
+	var s string
+	err = json.Unmarshal(b, &s)
+	if err != nil {
+		return
+	}
+	*t, err = NewTemplate(s)
+	return
+}
@@ -0,0 +1,166 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package headers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestPolicy_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		input  []byte
+		policy Policy
+		err    error
+	}{
+		{
+			[]byte(`{}`),
+			Policy{},
+			nil,
+		},
+		{
+			[]byte(`{"forward": ["x-request-id", "X-User"], "echo": ["x-user"]}`),
+			Policy{
+				Forward: []string{"X-Request-Id", "X-User"},
+				Echo:    []string{"X-User"},
+			},
+			nil,
+		},
+		{
+			[]byte(`{"forward": []}`),
+			Policy{Forward: []string{}},
+			nil,
+		},
+		{
+			[]byte(`{"set": {"x-version": "v2"}}`),
+			Policy{Set: map[string]Template{"X-Version": {text: "v2"}}},
+			nil,
+		},
+		{
+			[]byte(`{"forward": ["x user"]}`),
+			Policy{},
+			InvalidNameError{"x user"},
+		},
+		{
+			[]byte(`{"echo": [""]}`),
+			Policy{},
+			InvalidNameError{""},
+		},
+		{
+			[]byte(`{"set": {"x:y": "v2"}}`),
+			Policy{},
+			InvalidNameError{"x:y"},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			var policy Policy
+			err := json.Unmarshal(test.input, &policy)
+			if test.err != err {
+				t.Errorf("expected %v; actual %v", test.err, err)
+			}
+			if err == nil && !reflect.DeepEqual(test.policy, policy) {
+				t.Errorf("expected %v; actual %v", test.policy, policy)
+			}
+		})
+	}
+}
+
+func TestTemplate_Execute(t *testing.T) {
+	data := Data{
+		Service:     "a",
+		Destination: "b",
+		Method:      "GET",
+		Path:        "/users",
+		Header:      http.Header{"X-User": {"alice"}},
+	}
+
+	tests := []struct {
+		text  string
+		value string
+	}{
+		{"v2", "v2"},
+		{"", ""},
+		{"{{ .Service }}->{{ .Destination }}", "a->b"},
+		{`{{ .Header.Get "x-user" }}`, "alice"},
+		{`{{ .Header.Get "X-Missing" }}`, ""},
+		{"{{ .Method }} {{ .Path }}", "GET /users"},
+		{"/users/{{ randInt 7 7 }}", "/users/7"},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			template, err := NewTemplate(test.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			value, err := template.Execute(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.value != value {
+				t.Errorf("expected %q; actual %q", test.value, value)
+			}
+		})
+	}
+}
+
+func TestTemplate_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		input []byte
+		text  string
+		isErr bool
+	}{
+		{[]byte(`"v2"`), "v2", false},
+		{[]byte(`"{{ .Service }}"`), "{{ .Service }}", false},
+		{[]byte(`"{{ .Service "`), "", true},
+		{[]byte(`2`), "", true},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			var template Template
+			err := json.Unmarshal(test.input, &template)
+			if test.isErr != (err != nil) {
+				t.Errorf("expected error: %v; actual %v", test.isErr, err)
+			}
+			if err == nil && test.text != template.String() {
+				t.Errorf("expected %q; actual %q", test.text, template)
+			}
+			if err != nil {
+				return
+			}
+			b, err := json.Marshal(template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(test.input) != string(b) {
+				t.Errorf("expected %s; actual %s", test.input, b)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/size"
+)
+
+// AllocateCommand describes a command to allocate memory and write to each of
+// its pages, so that it is resident.
+type AllocateCommand struct {
+	// Size is the number of bytes to allocate, between 1 and
+	// MaxAllocationSize.
+	Size size.ByteSize `json:"size"`
+	// Retain keeps the memory allocated for the lifetime of the service,
+	// rather than releasing it to the garbage collector after the command.
+	Retain bool `json:"retain,omitempty"`
+}
+
+// MaxAllocationSize bounds the Size of an AllocateCommand, so that a typo in
+// its unit fails validation rather than the service at runtime.
+const MaxAllocationSize size.ByteSize = 16 << 30
+
+// Validate returns nil if c allocates between 1 and MaxAllocationSize bytes.
+func (c AllocateCommand) Validate() error {
+	if c.Size == 0 {
+		return ErrEmptyAllocation
+	}
+	if c.Size > MaxAllocationSize {
+		return AllocationTooLargeError{c.Size}
+	}
+	return nil
+}
+
+// MarshalJSON encodes an AllocateCommand which is not retained as a JSON
+// string and any other as a JSON object.
+func (c AllocateCommand) MarshalJSON() ([]byte, error) {
+	if !c.Retain {
+		return json.Marshal(c.Size)
+	}
+	return json.Marshal(unmarshallableAllocateCommand(c))
+}
+
+// UnmarshalJSON converts a JSON string, number or object to an
+// AllocateCommand. If b is a JSON string or number, it is parsed as the Size.
+// If b is a JSON object, its properties are mapped to c, e.g.
+// {"size": "1MiB", "retain": true}.
+func (c *AllocateCommand) UnmarshalJSON(b []byte) (err error) {
+	*c = AllocateCommand{}
+	isJSONObject := b[0] == '{'
+	if !isJSONObject {
+		err = json.Unmarshal(b, &c.Size)
+		return
+	}
+	var unmarshallable unmarshallableAllocateCommand
+	err = json.Unmarshal(b, &unmarshallable)
+	if err != nil {
+		return
+	}
+	*c = AllocateCommand(unmarshallable)
+	return
+}
+
+type unmarshallableAllocateCommand AllocateCommand
+
+func (c AllocateCommand) String() string {
+	if c.Retain {
+		return fmt.Sprintf("%s retained", c.Size)
+	}
+	return c.Size.String()
+}
+
+// ErrEmptyAllocation is returned when an AllocateCommand allocates nothing.
+var ErrEmptyAllocation = errors.New("allocate size must be positive")
+
+// AllocationTooLargeError is returned when an AllocateCommand allocates more
+// than MaxAllocationSize bytes.
+type AllocationTooLargeError struct {
+	Size size.ByteSize
+}
+
+func (e AllocationTooLargeError) Error() string {
+	return fmt.Sprintf(
+		"allocate size %s must be at most %s", e.Size, MaxAllocationSize)
+}
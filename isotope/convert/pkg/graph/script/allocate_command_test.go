@@ -0,0 +1,110 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestAllocateCommand_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		input   []byte
+		command AllocateCommand
+		err     error
+	}{
+		{
+			[]byte(`"1MiB"`),
+			AllocateCommand{Size: 1048576},
+			nil,
+		},
+		{
+			[]byte(`4096`),
+			AllocateCommand{Size: 4096},
+			nil,
+		},
+		{
+			[]byte(`{"size": "1KiB", "retain": true}`),
+			AllocateCommand{Size: 1024, Retain: true},
+			nil,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			var command AllocateCommand
+			err := json.Unmarshal(test.input, &command)
+			if test.err != err {
+				t.Errorf("expected %v; actual %v", test.err, err)
+			}
+			if test.command != command {
+				t.Errorf("expected %v; actual %v", test.command, command)
+			}
+		})
+	}
+}
+
+func TestAllocateCommand_MarshalJSON(t *testing.T) {
+	tests := []struct {
+		input  AllocateCommand
+		output []byte
+	}{
+		{
+			AllocateCommand{Size: 1024},
+			[]byte(`"1KiB"`),
+		},
+		{
+			AllocateCommand{Size: 1024, Retain: true},
+			[]byte(`{"size":"1KiB","retain":true}`),
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			output, err := json.Marshal(test.input)
+			if err != nil {
+				t.Errorf("expected nil; actual %v", err)
+			}
+			if string(test.output) != string(output) {
+				t.Errorf("expected %s; actual %s", test.output, output)
+			}
+		})
+	}
+}
+
+func TestAllocateCommand_Validate(t *testing.T) {
+	t.Parallel()
+
+	if err := (AllocateCommand{Size: 1}).Validate(); err != nil {
+		t.Errorf("expected nil; actual %v", err)
+	}
+	if err := (AllocateCommand{}).Validate(); err != ErrEmptyAllocation {
+		t.Errorf("expected %v; actual %v", ErrEmptyAllocation, err)
+	}
+	if err := (AllocateCommand{Size: MaxAllocationSize}).Validate(); err != nil {
+		t.Errorf("expected nil; actual %v", err)
+	}
+	tooLarge := AllocateCommand{Size: MaxAllocationSize + 1}
+	expected := AllocationTooLargeError{MaxAllocationSize + 1}
+	if err := tooLarge.Validate(); err != expected {
+		t.Errorf("expected %v; actual %v", expected, err)
+	}
+}
@@ -23,8 +23,16 @@ import (
 type Command interface{}
 
 const (
-	sleepCommandKey   = "sleep"
-	requestCommandKey = "call"
+	sleepCommandKey      = "sleep"
+	requestCommandKey    = "call"
+	concurrentCommandKey = "concurrent"
+	computeCommandKey    = "compute"
+	allocateCommandKey   = "allocate"
+	streamCommandKey     = "stream"
+	oneOfCommandKey      = "oneOf"
+	sequenceCommandKey   = "sequence"
+	repeatCommandKey     = "repeat"
+	switchCommandKey     = "switch"
 )
 
 func commandsToMarshallable(cmds []Command) ([]interface{}, error) {
@@ -42,11 +50,28 @@ func commandsToMarshallable(cmds []Command) ([]interface{}, error) {
 func commandToMarshallable(cmd Command) (interface{}, error) {
 	switch cmd := cmd.(type) {
 	case SleepCommand:
-		return map[string]string{sleepCommandKey: cmd.String()}, nil
+		return map[string]SleepCommand{sleepCommandKey: cmd}, nil
 	case RequestCommand:
 		return map[string]RequestCommand{requestCommandKey: cmd}, nil
+	case ComputeCommand:
+		return map[string]ComputeCommand{computeCommandKey: cmd}, nil
+	case AllocateCommand:
+		return map[string]AllocateCommand{allocateCommandKey: cmd}, nil
+	case StreamCommand:
+		return map[string]StreamCommand{streamCommandKey: cmd}, nil
+	case OneOfCommand:
+		return map[string]OneOfCommand{oneOfCommandKey: cmd}, nil
+	case SequenceCommand:
+		return map[string]SequenceCommand{sequenceCommandKey: cmd}, nil
+	case RepeatCommand:
+		return map[string]RepeatCommand{repeatCommandKey: cmd}, nil
+	case SwitchCommand:
+		return map[string]SwitchCommand{switchCommandKey: cmd}, nil
 	case ConcurrentCommand:
-		return commandsToMarshallable(cmd)
+		if cmd.hasOptions() {
+			return map[string]ConcurrentCommand{concurrentCommandKey: cmd}, nil
+		}
+		return commandsToMarshallable(cmd.Commands)
 	default:
 		return nil, InvalidCommandTypeError{cmd}
 	}
@@ -97,6 +122,46 @@ func (c *unmarshallableCommand) UnmarshalJSON(b []byte) error {
 			if err != nil {
 				return err
 			}
+		case concurrentCommandKey:
+			c.Command, err = parseConcurrentCommandFromJSONMap(b)
+			if err != nil {
+				return err
+			}
+		case computeCommandKey:
+			c.Command, err = parseComputeCommandFromJSONMap(b)
+			if err != nil {
+				return err
+			}
+		case allocateCommandKey:
+			c.Command, err = parseAllocateCommandFromJSONMap(b)
+			if err != nil {
+				return err
+			}
+		case streamCommandKey:
+			c.Command, err = parseStreamCommandFromJSONMap(b)
+			if err != nil {
+				return err
+			}
+		case oneOfCommandKey:
+			c.Command, err = parseOneOfCommandFromJSONMap(b)
+			if err != nil {
+				return err
+			}
+		case sequenceCommandKey:
+			c.Command, err = parseSequenceCommandFromJSONMap(b)
+			if err != nil {
+				return err
+			}
+		case repeatCommandKey:
+			c.Command, err = parseRepeatCommandFromJSONMap(b)
+			if err != nil {
+				return err
+			}
+		case switchCommandKey:
+			c.Command, err = parseSwitchCommandFromJSONMap(b)
+			if err != nil {
+				return err
+			}
 		default:
 			return UnknownCommandKeyError{key}
 		}
@@ -144,6 +209,58 @@ func parseRequestCommandFromJSONMap(b []byte) (cmd RequestCommand, err error) {
 	return
 }
 
+// b must contain a single key whose value is an unmarshallable
+// ConcurrentCommand.
+func parseConcurrentCommandFromJSONMap(
+	b []byte) (cmd ConcurrentCommand, err error) {
+	var m map[string]ConcurrentCommand
+	err = json.Unmarshal(b, &m)
+	if err != nil {
+		return
+	}
+	for _, cmd = range m {
+	}
+	return
+}
+
+// b must contain a single key whose value is an unmarshallable ComputeCommand.
+func parseComputeCommandFromJSONMap(b []byte) (cmd ComputeCommand, err error) {
+	var m map[string]ComputeCommand
+	err = json.Unmarshal(b, &m)
+	if err != nil {
+		return
+	}
+	for _, cmd = range m {
+	}
+	return
+}
+
+// b must contain a single key whose value is an unmarshallable
+// AllocateCommand.
+func parseAllocateCommandFromJSONMap(
+	b []byte) (cmd AllocateCommand, err error) {
+	var m map[string]AllocateCommand
+	err = json.Unmarshal(b, &m)
+	if err != nil {
+		return
+	}
+	for _, cmd = range m {
+	}
+	return
+}
+
+// b must contain a single key whose value is an unmarshallable StreamCommand.
+func parseStreamCommandFromJSONMap(b []byte) (cmd StreamCommand, err error) {
+	var m map[string]StreamCommand
+	err = json.Unmarshal(b, &m)
+	if err != nil {
+		return
+	}
+	for _, cmd = range m {
+	}
+	return
+}
+
 // InvalidCommandTypeError is returned when a type-switch on a Command does not
 // reveal a known Command.
 type InvalidCommandTypeError struct {
@@ -0,0 +1,109 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/duration"
+)
+
+// ComputeCommand describes a command to keep a CPU busy, either for a
+// duration or for a number of hash iterations. Exactly one must be set.
+type ComputeCommand struct {
+	// Duration is how long to keep the CPU busy for.
+	Duration duration.Duration `json:"duration,omitempty"`
+	// Iterations is how many SHA-256 hashes to compute.
+	Iterations int `json:"iterations,omitempty"`
+}
+
+// Validate returns nil if c sets exactly one of a positive Duration or a
+// positive Iterations.
+func (c ComputeCommand) Validate() error {
+	if c.Duration < 0 {
+		return NegativeComputeDurationError{c.Duration}
+	}
+	if c.Iterations < 0 {
+		return NegativeIterationsError{c.Iterations}
+	}
+	if (c.Duration > 0) == (c.Iterations > 0) {
+		return ErrComputeAmbiguous
+	}
+	return nil
+}
+
+// MarshalJSON encodes a ComputeCommand with only a Duration as a JSON string
+// and any other as a JSON object.
+func (c ComputeCommand) MarshalJSON() ([]byte, error) {
+	if c.Iterations == 0 {
+		return json.Marshal(c.Duration)
+	}
+	return json.Marshal(unmarshallableComputeCommand(c))
+}
+
+// UnmarshalJSON converts a JSON string or object to a ComputeCommand. If b is
+// a JSON string, it is parsed as the Duration. If b is a JSON object, its
+// properties are mapped to c, e.g. {"iterations": 10000}.
+func (c *ComputeCommand) UnmarshalJSON(b []byte) (err error) {
+	*c = ComputeCommand{}
+	isJSONString := b[0] == '"'
+	if isJSONString {
+		err = json.Unmarshal(b, &c.Duration)
+		return
+	}
+	var unmarshallable unmarshallableComputeCommand
+	err = json.Unmarshal(b, &unmarshallable)
+	if err != nil {
+		return
+	}
+	*c = ComputeCommand(unmarshallable)
+	return
+}
+
+type unmarshallableComputeCommand ComputeCommand
+
+func (c ComputeCommand) String() string {
+	if c.Iterations > 0 {
+		return fmt.Sprintf("%d iterations", c.Iterations)
+	}
+	return c.Duration.String()
+}
+
+// NegativeComputeDurationError is returned when a ComputeCommand's Duration
+// is negative.
+type NegativeComputeDurationError struct {
+	Duration duration.Duration
+}
+
+func (e NegativeComputeDurationError) Error() string {
+	return fmt.Sprintf("compute duration %v must be non-negative", e.Duration)
+}
+
+// NegativeIterationsError is returned when a ComputeCommand's Iterations is
+// negative.
+type NegativeIterationsError struct {
+	Iterations int
+}
+
+func (e NegativeIterationsError) Error() string {
+	return fmt.Sprintf("iterations %v must be non-negative", e.Iterations)
+}
+
+// ErrComputeAmbiguous is returned when a ComputeCommand sets both or neither
+// of Duration and Iterations.
+var ErrComputeAmbiguous = errors.New(
+	"compute must set exactly one of duration or iterations")
@@ -0,0 +1,124 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/duration"
+)
+
+func TestComputeCommand_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		input   []byte
+		command ComputeCommand
+		err     error
+	}{
+		{
+			[]byte(`"10ms"`),
+			ComputeCommand{Duration: duration.Duration(10 * time.Millisecond)},
+			nil,
+		},
+		{
+			[]byte(`{"iterations": 10000}`),
+			ComputeCommand{Iterations: 10000},
+			nil,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			var command ComputeCommand
+			err := json.Unmarshal(test.input, &command)
+			if test.err != err {
+				t.Errorf("expected %v; actual %v", test.err, err)
+			}
+			if test.command != command {
+				t.Errorf("expected %v; actual %v", test.command, command)
+			}
+		})
+	}
+}
+
+func TestComputeCommand_MarshalJSON(t *testing.T) {
+	tests := []struct {
+		input  ComputeCommand
+		output []byte
+	}{
+		{
+			ComputeCommand{Duration: duration.Duration(10 * time.Millisecond)},
+			[]byte(`"10ms"`),
+		},
+		{
+			ComputeCommand{Iterations: 10000},
+			[]byte(`{"iterations":10000}`),
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			output, err := json.Marshal(test.input)
+			if err != nil {
+				t.Errorf("expected nil; actual %v", err)
+			}
+			if string(test.output) != string(output) {
+				t.Errorf("expected %s; actual %s", test.output, output)
+			}
+		})
+	}
+}
+
+func TestComputeCommand_Validate(t *testing.T) {
+	tests := []struct {
+		command ComputeCommand
+		err     error
+	}{
+		{ComputeCommand{Duration: duration.Duration(time.Millisecond)}, nil},
+		{ComputeCommand{Iterations: 1}, nil},
+		{ComputeCommand{}, ErrComputeAmbiguous},
+		{
+			ComputeCommand{
+				Duration:   duration.Duration(time.Millisecond),
+				Iterations: 1,
+			},
+			ErrComputeAmbiguous,
+		},
+		{ComputeCommand{Iterations: -1}, NegativeIterationsError{-1}},
+		{
+			ComputeCommand{Duration: -1},
+			NegativeComputeDurationError{-1},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			err := test.command.Validate()
+			if test.err != err {
+				t.Errorf("expected %v; actual %v", test.err, err)
+			}
+		})
+	}
+}
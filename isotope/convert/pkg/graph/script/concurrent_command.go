@@ -14,17 +14,119 @@
 
 package script
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
 // ConcurrentCommand describes a set of commands that should be executed
 // simultaneously.
-type ConcurrentCommand []Command
+type ConcurrentCommand struct {
+	Commands []Command
+	// Policy describes what happens when one of the commands fails. If unset,
+	// it is WaitAll.
+	Policy ConcurrencyPolicy
+	// MaxParallelism, if set, limits how many commands run at once.
+	MaxParallelism int
+}
+
+// ConcurrencyPolicy describes how a ConcurrentCommand handles the failure of
+// one of its commands.
+type ConcurrencyPolicy string
+
+const (
+	// WaitAll waits for every command to complete and fails with all of their
+	// errors.
+	WaitAll ConcurrencyPolicy = "waitAll"
+	// FailFast cancels the other commands as soon as one fails and fails with
+	// its error.
+	FailFast ConcurrencyPolicy = "failFast"
+)
+
+// UnmarshalJSON converts a JSON string to a ConcurrencyPolicy.
+func (p *ConcurrencyPolicy) UnmarshalJSON(b []byte) (err error) {
+	var s string
+	err = json.Unmarshal(b, &s)
+	if err != nil {
+		return
+	}
+	switch policy := ConcurrencyPolicy(s); policy {
+	case WaitAll, FailFast:
+		*p = policy
+	default:
+		err = InvalidConcurrencyPolicyError{s}
+	}
+	return
+}
+
+// hasOptions returns true if c cannot be written as a plain list of commands.
+func (c ConcurrentCommand) hasOptions() bool {
+	return c.Policy != "" || c.MaxParallelism != 0
+}
+
+// jsonConcurrentCommand is the JSON object form of a ConcurrentCommand.
+type jsonConcurrentCommand struct {
+	Commands       Script            `json:"commands"`
+	Policy         ConcurrencyPolicy `json:"policy,omitempty"`
+	MaxParallelism int               `json:"maxParallelism,omitempty"`
+}
+
+// MarshalJSON encodes the ConcurrentCommand as a JSON object with its
+// commands and options.
+func (c ConcurrentCommand) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonConcurrentCommand{
+		Commands:       Script(c.Commands),
+		Policy:         c.Policy,
+		MaxParallelism: c.MaxParallelism,
+	})
+}
 
 // UnmarshalJSON converts b to a ConcurrentCommand. b must be a JSON array of
-// commands.
+// commands or a JSON object with "commands" and, optionally, "policy" and
+// "maxParallelism".
 func (c *ConcurrentCommand) UnmarshalJSON(b []byte) (err error) {
-	cmds, err := parseJSONCommands(b)
+	isJSONArray := b[0] == '['
+	if isJSONArray {
+		var cmds []Command
+		cmds, err = parseJSONCommands(b)
+		if err != nil {
+			return
+		}
+		*c = ConcurrentCommand{Commands: cmds}
+		return
+	}
+
+	var j jsonConcurrentCommand
+	err = json.Unmarshal(b, &j)
 	if err != nil {
 		return
 	}
-	*c = ConcurrentCommand(cmds)
+	if j.MaxParallelism < 0 {
+		err = ErrNegativeMaxParallelism
+		return
+	}
+	*c = ConcurrentCommand{
+		Commands:       []Command(j.Commands),
+		Policy:         j.Policy,
+		MaxParallelism: j.MaxParallelism,
+	}
 	return
 }
+
+// InvalidConcurrencyPolicyError is returned when a string is not parsable to a
+// ConcurrencyPolicy.
+type InvalidConcurrencyPolicyError struct {
+	String string
+}
+
+func (e InvalidConcurrencyPolicyError) Error() string {
+	return fmt.Sprintf(
+		`unknown concurrency policy: %s (must be "waitAll" or "failFast")`,
+		e.String)
+}
+
+// ErrNegativeMaxParallelism is returned when a ConcurrentCommand has a
+// negative MaxParallelism.
+var ErrNegativeMaxParallelism = errors.New(
+	"maxParallelism must be non-negative")
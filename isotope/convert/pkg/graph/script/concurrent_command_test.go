@@ -29,24 +29,58 @@ func TestConcurrentCommand_UnmarshalJSON(t *testing.T) {
 	}{
 		{
 			[]byte(`[]`),
-			ConcurrentCommand{},
+			ConcurrentCommand{Commands: []Command{}},
 			nil,
 		},
 		{
 			[]byte(`[{"sleep": "1s"}]`),
 			ConcurrentCommand{
-				SleepCommand(1 * time.Second),
+				Commands: []Command{
+					ConstantSleepCommand(1 * time.Second),
+				},
 			},
 			nil,
 		},
 		{
 			[]byte(`[{"call": "A"}, {"sleep": "10ms"}]`),
 			ConcurrentCommand{
-				RequestCommand{ServiceName: "A"},
-				SleepCommand(10 * time.Millisecond),
+				Commands: []Command{
+					RequestCommand{ServiceName: "A"},
+					ConstantSleepCommand(10 * time.Millisecond),
+				},
+			},
+			nil,
+		},
+		{
+			[]byte(`{"commands": [{"call": "A"}, {"call": "B"}], "policy": "failFast", "maxParallelism": 1}`),
+			ConcurrentCommand{
+				Commands: []Command{
+					RequestCommand{ServiceName: "A"},
+					RequestCommand{ServiceName: "B"},
+				},
+				Policy:         FailFast,
+				MaxParallelism: 1,
+			},
+			nil,
+		},
+		{
+			[]byte(`{"commands": [{"call": "A"}], "policy": "waitAll"}`),
+			ConcurrentCommand{
+				Commands: []Command{RequestCommand{ServiceName: "A"}},
+				Policy:   WaitAll,
 			},
 			nil,
 		},
+		{
+			[]byte(`{"commands": [{"call": "A"}], "policy": "firstWins"}`),
+			ConcurrentCommand{},
+			InvalidConcurrencyPolicyError{"firstWins"},
+		},
+		{
+			[]byte(`{"commands": [{"call": "A"}], "maxParallelism": -1}`),
+			ConcurrentCommand{},
+			ErrNegativeMaxParallelism,
+		},
 	}
 
 	for _, test := range tests {
@@ -65,3 +99,43 @@ func TestConcurrentCommand_UnmarshalJSON(t *testing.T) {
 		})
 	}
 }
+
+func TestConcurrentCommand_MarshalJSON(t *testing.T) {
+	tests := []struct {
+		command Command
+		json    string
+	}{
+		{
+			ConcurrentCommand{
+				Commands: []Command{
+					RequestCommand{ServiceName: "A"},
+					RequestCommand{ServiceName: "B"},
+				},
+			},
+			`[{"call":{"service":"A","size":"0B"}},{"call":{"service":"B","size":"0B"}}]`,
+		},
+		{
+			ConcurrentCommand{
+				Commands:       []Command{RequestCommand{ServiceName: "A"}},
+				Policy:         FailFast,
+				MaxParallelism: 2,
+			},
+			`{"concurrent":{"commands":[{"call":{"service":"A","size":"0B"}}],"policy":"failFast","maxParallelism":2}}`,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			b, err := json.Marshal(Script{test.command})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected := "[" + test.json + "]"; string(b) != expected {
+				t.Errorf("expected %s; actual %s", expected, b)
+			}
+		})
+	}
+}
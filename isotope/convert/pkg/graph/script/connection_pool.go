@@ -0,0 +1,98 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/duration"
+)
+
+// ConnectionPool configures the connections of calls to a destination. Calls
+// to the same destination with the same pool share its connections. Unset
+// fields keep their defaults. Calls over HTTP/2 or to gRPC services multiplex
+// a single connection, so MaxIdle, IdleTimeout and MaxConnections do not
+// apply to them.
+type ConnectionPool struct {
+	// MaxIdle is the number of idle connections kept open to the destination.
+	// If unset, the service's --max-idle-connections-per-host applies, or 2.
+	MaxIdle int `json:"maxIdle,omitempty"`
+	// IdleTimeout closes connections which stay idle for longer. If unset,
+	// idle HTTP connections are closed after 90s and TCP connections are kept.
+	IdleTimeout duration.Duration `json:"idleTimeout,omitempty"`
+	// MaxConnections bounds the connections to the destination, idle or in
+	// use. Calls wait for a connection once the bound is reached. If unset,
+	// connections are unbounded.
+	MaxConnections int `json:"maxConnections,omitempty"`
+	// ConnectTimeout bounds opening a connection. If unset, it is 30s.
+	ConnectTimeout duration.Duration `json:"connectTimeout,omitempty"`
+	// KeepAlive sets whether connections are kept open for later calls. If
+	// false, each call opens a connection of its own and closes it after the
+	// response, as with ConnectionNew, so that the pool models clients which
+	// churn connections. If unset, connections are kept.
+	KeepAlive *bool `json:"keepAlive,omitempty"`
+}
+
+// KeepsAlive returns true unless p turns keep-alive off.
+func (p ConnectionPool) KeepsAlive() bool {
+	return p.KeepAlive == nil || *p.KeepAlive
+}
+
+// Validate returns nil if neither count of p is negative. Durations are never
+// negative.
+func (p ConnectionPool) Validate() error {
+	switch {
+	case p.MaxIdle < 0:
+		return NegativeConnectionPoolFieldError{"maxIdle"}
+	case p.MaxConnections < 0:
+		return NegativeConnectionPoolFieldError{"maxConnections"}
+	}
+	return nil
+}
+
+// String lists the fields of p which are set, e.g. "maxIdle=10
+// connectTimeout=1s".
+func (p ConnectionPool) String() string {
+	var fields []string
+	if p.MaxIdle > 0 {
+		fields = append(fields, fmt.Sprintf("maxIdle=%d", p.MaxIdle))
+	}
+	if p.IdleTimeout > 0 {
+		fields = append(fields, fmt.Sprintf("idleTimeout=%s", p.IdleTimeout))
+	}
+	if p.MaxConnections > 0 {
+		fields = append(fields,
+			fmt.Sprintf("maxConnections=%d", p.MaxConnections))
+	}
+	if p.ConnectTimeout > 0 {
+		fields = append(fields,
+			fmt.Sprintf("connectTimeout=%s", p.ConnectTimeout))
+	}
+	if p.KeepAlive != nil {
+		fields = append(fields, fmt.Sprintf("keepAlive=%t", *p.KeepAlive))
+	}
+	return strings.Join(fields, " ")
+}
+
+// NegativeConnectionPoolFieldError is returned when a field of a
+// ConnectionPool is negative.
+type NegativeConnectionPoolFieldError struct {
+	Field string
+}
+
+func (e NegativeConnectionPoolFieldError) Error() string {
+	return fmt.Sprintf("connection pool %s must be non-negative", e.Field)
+}
@@ -0,0 +1,206 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+)
+
+// OneOfCommand describes a choice between alternatives, one of which is picked
+// at random, according to their weights, each time the command runs.
+type OneOfCommand struct {
+	Alternatives []Alternative
+}
+
+// Alternative is a choice of a OneOfCommand: the commands run in order when
+// it is picked. An alternative without commands does nothing.
+type Alternative struct {
+	// Weight is relative to the other alternatives' weights. If unset, it is
+	// 1; an explicit weight must be positive.
+	Weight int `json:"weight,omitempty"`
+	// Script is run in order when the alternative is picked.
+	Script Script `json:"script,omitempty"`
+}
+
+const branchScriptKey = "script"
+
+// maxTotalWeight bounds the sum of the weights of a OneOfCommand's
+// alternatives, so that picking one cannot overflow.
+const maxTotalWeight = 1000000
+
+func (a Alternative) weight() int {
+	if a.Weight == 0 {
+		return 1
+	}
+	return a.Weight
+}
+
+// Pick returns one of c's alternatives according to their weights.
+func (c OneOfCommand) Pick() Alternative {
+	total := 0
+	for _, a := range c.Alternatives {
+		total += a.weight()
+	}
+	n := rand.Intn(total)
+	for _, a := range c.Alternatives {
+		n -= a.weight()
+		if n < 0 {
+			return a
+		}
+	}
+	return c.Alternatives[len(c.Alternatives)-1]
+}
+
+// Percentage returns the chance, from 0 to 100, that the alternative at index
+// i is picked.
+func (c OneOfCommand) Percentage(i int) float64 {
+	total := 0
+	for _, a := range c.Alternatives {
+		total += a.weight()
+	}
+	return 100 * float64(c.Alternatives[i].weight()) / float64(total)
+}
+
+// MarshalJSON encodes the OneOfCommand as a JSON array of alternatives.
+func (c OneOfCommand) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.Alternatives)
+}
+
+// UnmarshalJSON converts b, a JSON array of alternatives, to a OneOfCommand.
+func (c *OneOfCommand) UnmarshalJSON(b []byte) (err error) {
+	var alternatives []Alternative
+	err = json.Unmarshal(b, &alternatives)
+	if err != nil {
+		return
+	}
+	if len(alternatives) == 0 {
+		err = ErrEmptyOneOf
+		return
+	}
+	total := 0
+	for _, a := range alternatives {
+		total += a.weight()
+		if total > maxTotalWeight {
+			err = ErrTotalWeightTooLarge
+			return
+		}
+	}
+	*c = OneOfCommand{Alternatives: alternatives}
+	return
+}
+
+// UnmarshalJSON converts b to an Alternative. b must be a JSON object with an
+// optional "weight" and either a single command, e.g. "call", or a "script"
+// of commands. It may also be a JSON array of commands run concurrently.
+func (a *Alternative) UnmarshalJSON(b []byte) (err error) {
+	*a = Alternative{}
+	isJSONArray := b[0] == '['
+	if isJSONArray {
+		var cmd unmarshallableCommand
+		err = json.Unmarshal(b, &cmd)
+		if err != nil {
+			return
+		}
+		a.Script = Script{cmd.Command}
+		return
+	}
+
+	var m map[string]json.RawMessage
+	err = json.Unmarshal(b, &m)
+	if err != nil {
+		return
+	}
+	if weight, ok := m["weight"]; ok {
+		err = json.Unmarshal(weight, &a.Weight)
+		if err != nil {
+			return
+		}
+		if a.Weight <= 0 || a.Weight > maxTotalWeight {
+			err = InvalidAlternativeWeightError{a.Weight}
+			return
+		}
+		delete(m, "weight")
+	}
+	a.Script, err = parseBranchScript(m)
+	return
+}
+
+// parseBranchScript converts m, the JSON object of a branch such as an
+// alternative without its own keys, to the branch's script: its "script", its
+// single command, or nothing if m is empty.
+func parseBranchScript(m map[string]json.RawMessage) (s Script, err error) {
+	if script, ok := m[branchScriptKey]; ok {
+		if len(m) > 1 {
+			err = ErrCommandAndScript
+			return
+		}
+		err = json.Unmarshal(script, &s)
+		return
+	}
+	if len(m) == 0 {
+		return
+	}
+
+	cmdJSON, err := json.Marshal(m)
+	if err != nil {
+		return
+	}
+	var cmd unmarshallableCommand
+	err = json.Unmarshal(cmdJSON, &cmd)
+	if err != nil {
+		return
+	}
+	s = Script{cmd.Command}
+	return
+}
+
+// b must contain a single key whose value is an unmarshallable OneOfCommand.
+func parseOneOfCommandFromJSONMap(b []byte) (cmd OneOfCommand, err error) {
+	var m map[string]OneOfCommand
+	err = json.Unmarshal(b, &m)
+	if err != nil {
+		return
+	}
+	for _, cmd = range m {
+	}
+	return
+}
+
+// InvalidAlternativeWeightError is returned when parsing an alternative with
+// a weight which is not positive, or exceeds the sum weights are bounded by.
+type InvalidAlternativeWeightError struct {
+	Weight int
+}
+
+func (e InvalidAlternativeWeightError) Error() string {
+	return fmt.Sprintf(
+		"weight %v must be between 1 and %d", e.Weight, maxTotalWeight)
+}
+
+// ErrEmptyOneOf is returned when a OneOfCommand has no alternatives.
+var ErrEmptyOneOf = errors.New("oneOf must have at least one alternative")
+
+// ErrTotalWeightTooLarge is returned when the weights of a OneOfCommand's
+// alternatives add up to more than maxTotalWeight.
+var ErrTotalWeightTooLarge = fmt.Errorf(
+	"the weights of oneOf must add up to at most %d", maxTotalWeight)
+
+// ErrCommandAndScript is returned when a branch, such as an alternative of a
+// OneOfCommand, sets both a command and a script.
+var ErrCommandAndScript = errors.New(
+	"a branch cannot set both a command and a script")
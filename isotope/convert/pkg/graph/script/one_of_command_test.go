@@ -0,0 +1,204 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOneOfCommand_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		input   []byte
+		command OneOfCommand
+		err     error
+	}{
+		{
+			[]byte(`[{"weight": 70, "call": "A"}, {"weight": 30, "call": "B"}]`),
+			OneOfCommand{
+				Alternatives: []Alternative{
+					{Weight: 70, Script: Script{RequestCommand{ServiceName: "A"}}},
+					{Weight: 30, Script: Script{RequestCommand{ServiceName: "B"}}},
+				},
+			},
+			nil,
+		},
+		{
+			[]byte(`[{"sleep": "10ms"}, {"weight": 2, "script": [{"sleep": "1ms"}, {"call": "A"}]}, {"weight": 1}]`),
+			OneOfCommand{
+				Alternatives: []Alternative{
+					{Script: Script{ConstantSleepCommand(10 * time.Millisecond)}},
+					{
+						Weight: 2,
+						Script: Script{
+							ConstantSleepCommand(1 * time.Millisecond),
+							RequestCommand{ServiceName: "A"},
+						},
+					},
+					{Weight: 1},
+				},
+			},
+			nil,
+		},
+		{
+			[]byte(`[[{"call": "A"}, {"call": "B"}]]`),
+			OneOfCommand{
+				Alternatives: []Alternative{
+					{
+						Script: Script{
+							ConcurrentCommand{
+								Commands: []Command{
+									RequestCommand{ServiceName: "A"},
+									RequestCommand{ServiceName: "B"},
+								},
+							},
+						},
+					},
+				},
+			},
+			nil,
+		},
+		{
+			[]byte(`[]`),
+			OneOfCommand{},
+			ErrEmptyOneOf,
+		},
+		{
+			[]byte(`[{"weight": -1, "call": "A"}]`),
+			OneOfCommand{},
+			InvalidAlternativeWeightError{-1},
+		},
+		{
+			[]byte(`[{"weight": 0, "call": "A"}]`),
+			OneOfCommand{},
+			InvalidAlternativeWeightError{0},
+		},
+		{
+			[]byte(`[{"weight": 1000000, "call": "A"}, {"call": "B"}]`),
+			OneOfCommand{},
+			ErrTotalWeightTooLarge,
+		},
+		{
+			[]byte(`[{"call": "A", "script": [{"call": "B"}]}]`),
+			OneOfCommand{},
+			ErrCommandAndScript,
+		},
+		{
+			[]byte(`[{"wait": "1s"}]`),
+			OneOfCommand{},
+			UnknownCommandKeyError{"wait"},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			var command OneOfCommand
+			err := json.Unmarshal(test.input, &command)
+			if test.err != err {
+				t.Errorf("expected %v; actual %v", test.err, err)
+			}
+			if !reflect.DeepEqual(test.command, command) {
+				t.Errorf("expected %v; actual %v", test.command, command)
+			}
+		})
+	}
+}
+
+func TestOneOfCommand_MarshalJSON(t *testing.T) {
+	tests := []struct {
+		command Command
+		json    string
+	}{
+		{
+			OneOfCommand{
+				Alternatives: []Alternative{
+					{Weight: 70, Script: Script{RequestCommand{ServiceName: "A"}}},
+					{Script: Script{ConstantSleepCommand(10 * time.Millisecond)}},
+					{Weight: 10},
+				},
+			},
+			`[{"weight":70,"script":[{"call":{"service":"A","size":"0B"}}]},{"script":[{"sleep":"10ms"}]},{"weight":10}]`,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			b, err := json.Marshal(test.command)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != test.json {
+				t.Errorf("expected %s; actual %s", test.json, b)
+			}
+
+			var command OneOfCommand
+			if err := json.Unmarshal(b, &command); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(test.command, command) {
+				t.Errorf("expected %v; actual %v", test.command, command)
+			}
+		})
+	}
+}
+
+func TestOneOfCommand_Pick(t *testing.T) {
+	a := Alternative{Weight: 3, Script: Script{RequestCommand{ServiceName: "A"}}}
+	b := Alternative{Script: Script{RequestCommand{ServiceName: "B"}}}
+	tests := []struct {
+		command  OneOfCommand
+		expected []Alternative
+	}{
+		{OneOfCommand{Alternatives: []Alternative{a}}, []Alternative{a}},
+		{OneOfCommand{Alternatives: []Alternative{a, b}}, []Alternative{a, b}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			for i := 0; i < 100; i++ {
+				picked := test.command.Pick()
+				found := false
+				for _, expected := range test.expected {
+					found = found || reflect.DeepEqual(expected, picked)
+				}
+				if !found {
+					t.Errorf("expected one of %v; actual %v", test.expected, picked)
+				}
+			}
+		})
+	}
+}
+
+func TestOneOfCommand_Percentage(t *testing.T) {
+	command := OneOfCommand{
+		Alternatives: []Alternative{{Weight: 7}, {Weight: 2}, {}},
+	}
+	for i, expected := range []float64{70, 20, 10} {
+		if actual := command.Percentage(i); actual != expected {
+			t.Errorf("expected %v; actual %v", expected, actual)
+		}
+	}
+}
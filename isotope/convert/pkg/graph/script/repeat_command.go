@@ -0,0 +1,133 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// RepeatCommand describes a script run Count times, one run after the other
+// or, if Concurrent, at the same time.
+type RepeatCommand struct {
+	// Count is between 1 and MaxRepeatCount.
+	Count int
+	// Concurrent runs each repetition in its own goroutine, like the commands
+	// of a ConcurrentCommand.
+	Concurrent bool
+	// Policy describes what happens when a concurrent repetition fails. If
+	// unset, it is WaitAll. Sequential repetitions stop at the first failure.
+	Policy ConcurrencyPolicy
+	// MaxParallelism, if set, limits how many concurrent repetitions run at
+	// once.
+	MaxParallelism int
+	// Script is run in order by each repetition.
+	Script Script
+}
+
+// MaxRepeatCount bounds the Count of a RepeatCommand, so that a script cannot
+// run for practically ever, or start a goroutine per repetition beyond it.
+const MaxRepeatCount = 10000
+
+// Repetition returns the command each repetition of c runs, as a command of
+// a ConcurrentCommand: a SequenceCommand of c's script, or its single command.
+func (c RepeatCommand) Repetition() Command {
+	if len(c.Script) == 1 {
+		return c.Script[0]
+	}
+	return SequenceCommand{Commands: c.Script}
+}
+
+// jsonRepeatCommand is the JSON object form of a RepeatCommand.
+type jsonRepeatCommand struct {
+	Count          int               `json:"count"`
+	Concurrent     bool              `json:"concurrent,omitempty"`
+	Policy         ConcurrencyPolicy `json:"policy,omitempty"`
+	MaxParallelism int               `json:"maxParallelism,omitempty"`
+	Script         Script            `json:"script"`
+}
+
+// MarshalJSON encodes the RepeatCommand as a JSON object with its count,
+// options and script.
+func (c RepeatCommand) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonRepeatCommand(c))
+}
+
+// UnmarshalJSON converts b to a RepeatCommand. b must be a JSON object with
+// "count", "script" and, optionally, "concurrent", "policy" and
+// "maxParallelism".
+func (c *RepeatCommand) UnmarshalJSON(b []byte) (err error) {
+	var j jsonRepeatCommand
+	err = json.Unmarshal(b, &j)
+	if err != nil {
+		return
+	}
+	if j.Count <= 0 {
+		err = NonPositiveRepeatCountError{j.Count}
+		return
+	}
+	if j.Count > MaxRepeatCount {
+		err = RepeatCountTooLargeError{j.Count}
+		return
+	}
+	if j.MaxParallelism < 0 {
+		err = ErrNegativeMaxParallelism
+		return
+	}
+	if !j.Concurrent && (j.Policy != "" || j.MaxParallelism != 0) {
+		err = ErrConcurrencyOptionsWithoutConcurrent
+		return
+	}
+	*c = RepeatCommand(j)
+	return
+}
+
+// b must contain a single key whose value is an unmarshallable RepeatCommand.
+func parseRepeatCommandFromJSONMap(b []byte) (cmd RepeatCommand, err error) {
+	var m map[string]RepeatCommand
+	err = json.Unmarshal(b, &m)
+	if err != nil {
+		return
+	}
+	for _, cmd = range m {
+	}
+	return
+}
+
+// NonPositiveRepeatCountError is returned when a RepeatCommand repeats its
+// script less than once.
+type NonPositiveRepeatCountError struct {
+	Count int
+}
+
+func (e NonPositiveRepeatCountError) Error() string {
+	return fmt.Sprintf("count %v must be positive", e.Count)
+}
+
+// RepeatCountTooLargeError is returned when a RepeatCommand repeats its
+// script more than MaxRepeatCount times.
+type RepeatCountTooLargeError struct {
+	Count int
+}
+
+func (e RepeatCountTooLargeError) Error() string {
+	return fmt.Sprintf("count %v must be at most %d", e.Count, MaxRepeatCount)
+}
+
+// ErrConcurrencyOptionsWithoutConcurrent is returned when a RepeatCommand sets
+// a policy or maxParallelism without being concurrent.
+var ErrConcurrencyOptionsWithoutConcurrent = errors.New(
+	"policy and maxParallelism require concurrent")
@@ -0,0 +1,189 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestRepeatCommand_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		input   []byte
+		command RepeatCommand
+		err     error
+	}{
+		{
+			[]byte(`{"count": 3, "script": [{"call": "A"}]}`),
+			RepeatCommand{
+				Count:  3,
+				Script: Script{RequestCommand{ServiceName: "A"}},
+			},
+			nil,
+		},
+		{
+			[]byte(`{"count": 20, "concurrent": true, "maxParallelism": 5, "policy": "failFast", "script": [{"call": "A"}, {"call": "B"}]}`),
+			RepeatCommand{
+				Count:          20,
+				Concurrent:     true,
+				Policy:         FailFast,
+				MaxParallelism: 5,
+				Script: Script{
+					RequestCommand{ServiceName: "A"},
+					RequestCommand{ServiceName: "B"},
+				},
+			},
+			nil,
+		},
+		{
+			[]byte(`{"count": 2, "script": [{"repeat": {"count": 2, "concurrent": true, "script": [[{"call": "A"}, {"call": "B"}]]}}]}`),
+			RepeatCommand{
+				Count: 2,
+				Script: Script{
+					RepeatCommand{
+						Count:      2,
+						Concurrent: true,
+						Script: Script{
+							ConcurrentCommand{
+								Commands: []Command{
+									RequestCommand{ServiceName: "A"},
+									RequestCommand{ServiceName: "B"},
+								},
+							},
+						},
+					},
+				},
+			},
+			nil,
+		},
+		{
+			[]byte(`{"count": 0, "script": [{"call": "A"}]}`),
+			RepeatCommand{},
+			NonPositiveRepeatCountError{0},
+		},
+		{
+			[]byte(`{"count": 10001, "script": [{"call": "A"}]}`),
+			RepeatCommand{},
+			RepeatCountTooLargeError{10001},
+		},
+		{
+			[]byte(`{"count": 2, "concurrent": true, "maxParallelism": -1, "script": [{"call": "A"}]}`),
+			RepeatCommand{},
+			ErrNegativeMaxParallelism,
+		},
+		{
+			[]byte(`{"count": 2, "maxParallelism": 1, "script": [{"call": "A"}]}`),
+			RepeatCommand{},
+			ErrConcurrencyOptionsWithoutConcurrent,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			var command RepeatCommand
+			err := json.Unmarshal(test.input, &command)
+			if test.err != err {
+				t.Errorf("expected %v; actual %v", test.err, err)
+			}
+			if !reflect.DeepEqual(test.command, command) {
+				t.Errorf("expected %v; actual %v", test.command, command)
+			}
+		})
+	}
+}
+
+func TestRepeatCommand_MarshalJSON(t *testing.T) {
+	tests := []struct {
+		command Script
+		json    string
+	}{
+		{
+			Script{RepeatCommand{
+				Count:  2,
+				Script: Script{RequestCommand{ServiceName: "A"}},
+			}},
+			`[{"repeat":{"count":2,"script":[{"call":{"service":"A","size":"0B"}}]}}]`,
+		},
+		{
+			Script{RepeatCommand{
+				Count:          20,
+				Concurrent:     true,
+				MaxParallelism: 5,
+				Script: Script{
+					SequenceCommand{
+						Commands: []Command{
+							RequestCommand{ServiceName: "A"},
+						},
+					},
+				},
+			}},
+			`[{"repeat":{"count":20,"concurrent":true,"maxParallelism":5,"script":[{"sequence":[{"call":{"service":"A","size":"0B"}}]}]}}]`,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			b, err := json.Marshal(test.command)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != test.json {
+				t.Errorf("expected %s; actual %s", test.json, b)
+			}
+
+			var command Script
+			if err := json.Unmarshal(b, &command); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(test.command, command) {
+				t.Errorf("expected %v; actual %v", test.command, command)
+			}
+		})
+	}
+}
+
+func TestRepeatCommand_Repetition(t *testing.T) {
+	a := RequestCommand{ServiceName: "A"}
+	b := RequestCommand{ServiceName: "B"}
+	tests := []struct {
+		command    RepeatCommand
+		repetition Command
+	}{
+		{RepeatCommand{Count: 2, Script: Script{a}}, a},
+		{
+			RepeatCommand{Count: 2, Script: Script{a, b}},
+			SequenceCommand{Commands: Script{a, b}},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			repetition := test.command.Repetition()
+			if !reflect.DeepEqual(test.repetition, repetition) {
+				t.Errorf("expected %v; actual %v", test.repetition, repetition)
+			}
+		})
+	}
+}
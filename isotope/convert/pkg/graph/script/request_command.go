@@ -17,7 +17,15 @@ package script
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
+	"golang.org/x/net/http/httpguts"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/duration"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/headers"
 	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/size"
 )
 
@@ -25,21 +33,205 @@ import (
 // service.
 type RequestCommand struct {
 	ServiceName string `json:"service"`
+	// Endpoint is the name of the endpoint of the service to call, which sets
+	// the path and default method of the call. If unset, the service's own
+	// script is called on Path. In YAML, it may also be given with the
+	// service as "service/endpoint".
+	Endpoint string `json:"endpoint,omitempty"`
 	// Size is the number of bytes in the request body.
 	Size size.ByteSize `json:"size"`
 	// Probability is the chance a call will be made, from 1-100%. If unset, the call will always be made
 	// 1 means 1% of calls will be made; 100 means 100% of calls will be made
 	Probability int `json:"probability,omitempty"`
+	// Timeout bounds each attempt of the call. If unset, attempts never time
+	// out.
+	Timeout duration.Duration `json:"timeout,omitempty"`
+	// Retries is the number of times a failed call is attempted again.
+	Retries int `json:"retries,omitempty"`
+	// RetryOn lists the failures which are retried. If unset, DefaultRetryOn
+	// is used.
+	RetryOn []RetryCondition `json:"retryOn,omitempty"`
+	// Backoff sets the pause between attempts. If unset, DefaultBackoff is
+	// used.
+	Backoff *Backoff `json:"backoff,omitempty"`
+	// Method is the HTTP method of the call. If unset, it is GET.
+	Method string `json:"method,omitempty"`
+	// Path is the path of the call, optionally templated from the inbound
+	// request. If unset, it is "/". Once rendered, it must start with "/",
+	// and is escaped, so that it cannot add a query or fragment to the call.
+	Path *headers.Template `json:"path,omitempty"`
+	// Query maps the query parameters of the call to their values, optionally
+	// templated from the inbound request.
+	Query map[string]headers.Template `json:"query,omitempty"`
+	// Protocol is the protocol of the call. If unset, HTTP/1.1 is used over
+	// plaintext and HTTP/2 is negotiated over TLS.
+	Protocol Protocol `json:"protocol,omitempty"`
+	// Connection sets whether the call reuses an idle connection to the
+	// service or opens a new one, i.e. whether keep-alive is on. If unset,
+	// connections are reused.
+	Connection Connection `json:"connection,omitempty"`
+	// ConnectionPool configures the connections to the service. Its fields
+	// override those of the default pool, if any.
+	ConnectionPool *ConnectionPool `json:"connectionPool,omitempty"`
+}
+
+// Protocol is the protocol of an HTTP call. Calls to gRPC services always use
+// HTTP/2.
+type Protocol string
+
+const (
+	// ProtocolHTTP1 forces HTTP/1.1, even over TLS.
+	ProtocolHTTP1 Protocol = "http/1.1"
+	// ProtocolH2C uses HTTP/2 over plaintext, with prior knowledge.
+	ProtocolH2C Protocol = "h2c"
+	// ProtocolH2 uses HTTP/2 over TLS.
+	ProtocolH2 Protocol = "h2"
+)
+
+// UnmarshalJSON converts a JSON string to a Protocol.
+func (p *Protocol) UnmarshalJSON(b []byte) (err error) {
+	var s string
+	err = json.Unmarshal(b, &s)
+	if err != nil {
+		return
+	}
+	switch protocol := Protocol(s); protocol {
+	case ProtocolHTTP1, ProtocolH2C, ProtocolH2:
+		*p = protocol
+	default:
+		err = InvalidProtocolError{s}
+	}
+	return
+}
+
+// Connection is how a call gets its connection.
+type Connection string
+
+const (
+	// ConnectionReuse sends the call on an idle connection to the service if
+	// there is one, and keeps the connection open afterwards.
+	ConnectionReuse Connection = "reuse"
+	// ConnectionNew opens a connection for the call alone, and closes it
+	// afterwards, so that each call pays for the handshakes.
+	ConnectionNew Connection = "new"
+)
+
+// UnmarshalJSON converts a JSON string to a Connection.
+func (c *Connection) UnmarshalJSON(b []byte) (err error) {
+	var s string
+	err = json.Unmarshal(b, &s)
+	if err != nil {
+		return
+	}
+	switch connection := Connection(s); connection {
+	case ConnectionReuse, ConnectionNew:
+		*c = connection
+	default:
+		err = InvalidConnectionError{s}
+	}
+	return
 }
 
+// RetryCondition is a failure of an attempt which may be retried: an HTTP
+// status code such as "503", a class of status codes ("4xx" or "5xx"), or one
+// of the connection failures below.
+type RetryCondition string
+
+const (
+	// RetryOn4xx matches any 4xx status code.
+	RetryOn4xx RetryCondition = "4xx"
+	// RetryOn5xx matches any 5xx status code.
+	RetryOn5xx RetryCondition = "5xx"
+	// RetryOnConnectFailure matches failures to connect to the destination.
+	RetryOnConnectFailure RetryCondition = "connect-failure"
+	// RetryOnReset matches connections failing after they were established.
+	RetryOnReset RetryCondition = "reset"
+	// RetryOnTimeout matches attempts which exceeded their Timeout.
+	RetryOnTimeout RetryCondition = "timeout"
+)
+
+// DefaultRetryOn lists the failures retried when RetryOn is unset.
+var DefaultRetryOn = []RetryCondition{
+	RetryOn5xx, RetryOnConnectFailure, RetryOnReset, RetryOnTimeout}
+
+// UnmarshalJSON converts a JSON string, or a JSON number for a status code,
+// to a RetryCondition.
+func (c *RetryCondition) UnmarshalJSON(b []byte) (err error) {
+	var s string
+	if isJSONString := b[0] == '"'; isJSONString {
+		err = json.Unmarshal(b, &s)
+	} else {
+		var code int
+		err = json.Unmarshal(b, &code)
+		s = strconv.Itoa(code)
+	}
+	if err != nil {
+		return
+	}
+	switch cond := RetryCondition(s); cond {
+	case RetryOn4xx, RetryOn5xx, RetryOnConnectFailure, RetryOnReset,
+		RetryOnTimeout:
+		*c = cond
+	default:
+		code, convErr := strconv.Atoi(s)
+		if convErr != nil || code < 100 || code > 599 {
+			err = InvalidRetryConditionError{s}
+			return
+		}
+		*c = cond
+	}
+	return
+}
+
+// Matches returns true if c matches an attempt's outcome, which is either its
+// HTTP status code or the name of its connection failure.
+func (c RetryCondition) Matches(outcome string) bool {
+	switch c {
+	case RetryOn4xx, RetryOn5xx:
+		return len(outcome) == 3 && outcome[0] == string(c)[0]
+	default:
+		return string(c) == outcome
+	}
+}
+
+// Backoff describes the exponential, jittered pause between attempts. The nth
+// retry pauses for a random duration up to BaseInterval * 2^(n-1), capped at
+// MaxInterval.
+type Backoff struct {
+	// BaseInterval is the longest pause before the first retry. If unset, it
+	// is that of DefaultBackoff.
+	BaseInterval duration.Duration `json:"baseInterval,omitempty"`
+	// MaxInterval caps the pause. If unset, it is 10 times BaseInterval.
+	MaxInterval duration.Duration `json:"maxInterval,omitempty"`
+}
+
+// UnmarshalJSON converts b to a Backoff. Fields unset in b keep their values
+// in DefaultBackoff.
+func (b *Backoff) UnmarshalJSON(data []byte) (err error) {
+	unmarshallable := unmarshallableBackoff(DefaultBackoff)
+	err = json.Unmarshal(data, &unmarshallable)
+	if err != nil {
+		return
+	}
+	*b = Backoff(unmarshallable)
+	return
+}
+
+type unmarshallableBackoff Backoff
+
 var (
 	// DefaultRequestCommand is used by UnmarshalJSON to set defaults.
 	DefaultRequestCommand RequestCommand
+
+	// DefaultBackoff is used between attempts when Backoff is unset.
+	DefaultBackoff = Backoff{
+		BaseInterval: duration.Duration(25 * time.Millisecond),
+	}
 )
 
 // UnmarshalJSON converts b to a RequestCommand. If b is a JSON string, it is
-// set as c's ServiceName. If b is a JSON object, it's properties are mapped to
-// c.
+// set as c's ServiceName, or ServiceName and Endpoint if it is of the form
+// "service/endpoint". If b is a JSON object, it's properties are mapped to c.
 func (c *RequestCommand) UnmarshalJSON(b []byte) (err error) {
 	*c = DefaultRequestCommand
 	isJSONString := b[0] == '"'
@@ -49,8 +241,18 @@ func (c *RequestCommand) UnmarshalJSON(b []byte) (err error) {
 		if err != nil {
 			return
 		}
-		c.ServiceName = s
+		c.ServiceName, c.Endpoint = splitServiceName(s)
 	} else {
+		// Decode the connection pool into a copy of the default one, so that
+		// it overrides its fields without changing it.
+		if c.ConnectionPool != nil {
+			pool := *c.ConnectionPool
+			if pool.KeepAlive != nil {
+				keepAlive := *pool.KeepAlive
+				pool.KeepAlive = &keepAlive
+			}
+			c.ConnectionPool = &pool
+		}
 		// Wrap the RequestCommand to dodge the custom UnmarshalJSON.
 		unmarshallableRequestCommand := unmarshallableRequestCommand(*c)
 		err = json.Unmarshal(b, &unmarshallableRequestCommand)
@@ -60,11 +262,116 @@ func (c *RequestCommand) UnmarshalJSON(b []byte) (err error) {
 
 		*c = RequestCommand(unmarshallableRequestCommand)
 
+		if strings.Contains(c.ServiceName, "/") {
+			if c.Endpoint != "" {
+				return ErrEndpointSetTwice
+			}
+			c.ServiceName, c.Endpoint = splitServiceName(c.ServiceName)
+		}
+		if c.Endpoint != "" && c.Path != nil {
+			return ErrEndpointAndPath
+		}
+
 		if c.Probability < 0 || c.Probability > 100 {
 			return errors.New("math: invalid probability, outside range: [0,100]")
 		}
+		if c.Retries < 0 {
+			return ErrNegativeRetries
+		}
+		// Methods are tokens, like header names.
+		if c.Method != "" && !httpguts.ValidHeaderFieldName(c.Method) {
+			return InvalidMethodError{c.Method}
+		}
+		// A path starting with an action, e.g. {{ .Path }}, is only checked
+		// once rendered.
+		if path := c.Path; path != nil &&
+			!strings.HasPrefix(path.String(), "/") &&
+			!strings.HasPrefix(path.String(), "{{") {
+			return InvalidPathError{path.String()}
+		}
+		if c.ConnectionPool != nil {
+			if err := c.ConnectionPool.Validate(); err != nil {
+				return err
+			}
+		}
 	}
 	return
 }
 
 type unmarshallableRequestCommand RequestCommand
+
+// splitServiceName splits "service/endpoint" into the service and the
+// endpoint, or returns s and "" if it names no endpoint.
+func splitServiceName(s string) (serviceName string, endpoint string) {
+	i := strings.Index(s, "/")
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], s[i+1:]
+}
+
+// InvalidRetryConditionError is returned when a string is not parsable to a
+// RetryCondition.
+type InvalidRetryConditionError struct {
+	String string
+}
+
+func (e InvalidRetryConditionError) Error() string {
+	return fmt.Sprintf("invalid retry condition: %s", e.String)
+}
+
+// InvalidProtocolError is returned when a string is not parsable to a
+// Protocol.
+type InvalidProtocolError struct {
+	String string
+}
+
+func (e InvalidProtocolError) Error() string {
+	return fmt.Sprintf(
+		`unknown protocol: %s (must be "%s", "%s" or "%s")`,
+		e.String, ProtocolHTTP1, ProtocolH2C, ProtocolH2)
+}
+
+// InvalidConnectionError is returned when a string is not parsable to a
+// Connection.
+type InvalidConnectionError struct {
+	String string
+}
+
+func (e InvalidConnectionError) Error() string {
+	return fmt.Sprintf(
+		`unknown connection: %s (must be "%s" or "%s")`,
+		e.String, ConnectionReuse, ConnectionNew)
+}
+
+// InvalidMethodError is returned when the method of a RequestCommand or of an
+// endpoint is not a valid HTTP method.
+type InvalidMethodError struct {
+	Method string
+}
+
+func (e InvalidMethodError) Error() string {
+	return fmt.Sprintf("invalid method: %q", e.Method)
+}
+
+// InvalidPathError is returned when a RequestCommand's path, or the path it
+// renders, does not start with "/".
+type InvalidPathError struct {
+	Path string
+}
+
+func (e InvalidPathError) Error() string {
+	return fmt.Sprintf(`invalid path: %q (must start with "/")`, e.Path)
+}
+
+// ErrNegativeRetries is returned when a RequestCommand has negative retries.
+var ErrNegativeRetries = errors.New("retries must be non-negative")
+
+// ErrEndpointSetTwice is returned when a RequestCommand names its endpoint
+// both in its service, as "service/endpoint", and in its endpoint.
+var ErrEndpointSetTwice = errors.New(
+	`endpoint cannot be set both as "service/endpoint" and on its own`)
+
+// ErrEndpointAndPath is returned when a RequestCommand sets both an endpoint
+// and a path, since the endpoint sets the path.
+var ErrEndpointAndPath = errors.New("endpoint cannot be combined with path")
@@ -16,7 +16,12 @@ package script
 
 import (
 	"encoding/json"
+	"reflect"
 	"testing"
+	"time"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/duration"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/headers"
 )
 
 func TestRequestCommand_UnmarshalJSON(t *testing.T) {
@@ -42,6 +47,163 @@ func TestRequestCommand_UnmarshalJSON(t *testing.T) {
 			RequestCommand{ServiceName: "a", Size: 128},
 			nil,
 		},
+		{
+			[]byte(`{
+				"service": "a",
+				"timeout": "1s",
+				"retries": 2,
+				"retryOn": ["503", 429, "connect-failure"],
+				"backoff": {"baseInterval": "10ms", "maxInterval": "1s"}
+			}`),
+			RequestCommand{
+				ServiceName: "a",
+				Timeout:     duration.Duration(time.Second),
+				Retries:     2,
+				RetryOn:     []RetryCondition{"503", "429", RetryOnConnectFailure},
+				Backoff: &Backoff{
+					BaseInterval: duration.Duration(10 * time.Millisecond),
+					MaxInterval:  duration.Duration(time.Second),
+				},
+			},
+			nil,
+		},
+		{
+			[]byte(`{"service": "a", "backoff": {"maxInterval": "1s"}}`),
+			RequestCommand{
+				ServiceName: "a",
+				Backoff: &Backoff{
+					BaseInterval: duration.Duration(25 * time.Millisecond),
+					MaxInterval:  duration.Duration(time.Second),
+				},
+			},
+			nil,
+		},
+		{
+			[]byte(`{"service": "a", "backoff": {"baseInterval": "-1s"}}`),
+			RequestCommand{},
+			duration.NegativeDurationError{String: "-1s"},
+		},
+		{
+			[]byte(`{"service": "a", "timeout": "-1s"}`),
+			RequestCommand{},
+			duration.NegativeDurationError{String: "-1s"},
+		},
+		{
+			[]byte(`{"service": "a", "retries": -1}`),
+			RequestCommand{ServiceName: "a", Retries: -1},
+			ErrNegativeRetries,
+		},
+		{
+			[]byte(`{"service": "a", "retryOn": ["6xx"]}`),
+			RequestCommand{},
+			InvalidRetryConditionError{"6xx"},
+		},
+		{
+			[]byte(`{"service": "a", "retryOn": [600]}`),
+			RequestCommand{},
+			InvalidRetryConditionError{"600"},
+		},
+		{
+			[]byte(`{
+				"service": "a",
+				"method": "POST",
+				"path": "/users",
+				"query": {"page": "2"},
+				"protocol": "h2c"
+			}`),
+			RequestCommand{
+				ServiceName: "a",
+				Method:      "POST",
+				Path:        mustTemplate("/users"),
+				Query:       map[string]headers.Template{"page": *mustTemplate("2")},
+				Protocol:    ProtocolH2C,
+			},
+			nil,
+		},
+		{
+			[]byte(`{"service": "a", "method": "GET /"}`),
+			RequestCommand{ServiceName: "a", Method: "GET /"},
+			InvalidMethodError{"GET /"},
+		},
+		{
+			[]byte(`{"service": "a", "path": "users"}`),
+			RequestCommand{ServiceName: "a", Path: mustTemplate("users")},
+			InvalidPathError{"users"},
+		},
+
+		{
+			[]byte(`{"service": "a", "protocol": "spdy"}`),
+			RequestCommand{},
+			InvalidProtocolError{"spdy"},
+		},
+		{
+			[]byte(`{"service": "a", "connection": "new"}`),
+			RequestCommand{ServiceName: "a", Connection: ConnectionNew},
+			nil,
+		},
+		{
+			[]byte(`{"service": "a", "connection": "pooled"}`),
+			RequestCommand{},
+			InvalidConnectionError{"pooled"},
+		},
+		{
+			[]byte(`{
+				"service": "a",
+				"connectionPool": {
+					"maxIdle": 10,
+					"idleTimeout": "30s",
+					"maxConnections": 20,
+					"connectTimeout": "1s"
+				}
+			}`),
+			RequestCommand{
+				ServiceName: "a",
+				ConnectionPool: &ConnectionPool{
+					MaxIdle:        10,
+					IdleTimeout:    duration.Duration(30 * time.Second),
+					MaxConnections: 20,
+					ConnectTimeout: duration.Duration(time.Second),
+				},
+			},
+			nil,
+		},
+		{
+			[]byte(`{"service": "a", "connectionPool": {"maxIdle": -1}}`),
+			RequestCommand{
+				ServiceName:    "a",
+				ConnectionPool: &ConnectionPool{MaxIdle: -1},
+			},
+			NegativeConnectionPoolFieldError{"maxIdle"},
+		},
+		{
+			[]byte(`"b/login"`),
+			RequestCommand{ServiceName: "b", Endpoint: "login"},
+			nil,
+		},
+		{
+			[]byte(`{"service": "b/login", "method": "POST"}`),
+			RequestCommand{ServiceName: "b", Endpoint: "login", Method: "POST"},
+			nil,
+		},
+		{
+			[]byte(`{"service": "b", "endpoint": "login"}`),
+			RequestCommand{ServiceName: "b", Endpoint: "login"},
+			nil,
+		},
+		{
+			[]byte(`{"service": "b/login", "endpoint": "logout"}`),
+			RequestCommand{ServiceName: "b/login", Endpoint: "logout"},
+			ErrEndpointSetTwice,
+		},
+		{
+			[]byte(`{"service": "b/login", "path": "/login"}`),
+			RequestCommand{
+				ServiceName: "b",
+				Endpoint:    "login",
+				Path:        mustTemplate("/login"),
+			},
+			ErrEndpointAndPath,
+		},
 	}
 
 	for _, test := range tests {
@@ -54,13 +216,42 @@ func TestRequestCommand_UnmarshalJSON(t *testing.T) {
 			if test.err != err {
 				t.Errorf("expected %v; actual %v", test.err, err)
 			}
-			if test.command != command {
+			if !reflect.DeepEqual(test.command, command) {
 				t.Errorf("expected %v; actual %v", test.command, command)
 			}
 		})
 	}
 }
 
+func TestRetryCondition_Matches(t *testing.T) {
+	tests := []struct {
+		condition RetryCondition
+		outcome   string
+		matches   bool
+	}{
+		{RetryOn5xx, "503", true},
+		{RetryOn5xx, "429", false},
+		{RetryOn4xx, "429", true},
+		{"503", "503", true},
+		{"503", "500", false},
+		{RetryOnTimeout, "timeout", true},
+		{RetryOn5xx, "timeout", false},
+		{RetryOnConnectFailure, "reset", false},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			matches := test.condition.Matches(test.outcome)
+			if test.matches != matches {
+				t.Errorf("expected %v; actual %v", test.matches, matches)
+			}
+		})
+	}
+}
+
 func TestRequestCommand_UnmarshalJSON_Default(t *testing.T) {
 	DefaultRequestCommand = RequestCommand{Size: 512}
 
@@ -96,9 +287,76 @@ func TestRequestCommand_UnmarshalJSON_Default(t *testing.T) {
 			if test.err != err {
 				t.Errorf("expected %v; actual %v", test.err, err)
 			}
-			if test.command != command {
+			if !reflect.DeepEqual(test.command, command) {
 				t.Errorf("expected %v; actual %v", test.command, command)
 			}
 		})
 	}
 }
+
+func TestRequestCommand_UnmarshalJSON_TemplatedPath(t *testing.T) {
+	DefaultRequestCommand = RequestCommand{}
+
+	var command RequestCommand
+	err := json.Unmarshal([]byte(`{"service": "a", "path": "{{ .Path }}"}`), &command)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command.Path == nil || command.Path.String() != "{{ .Path }}" {
+		t.Errorf("expected path {{ .Path }}; actual %v", command.Path)
+	}
+}
+
+func mustTemplate(text string) *headers.Template {
+	t, err := headers.NewTemplate(text)
+	if err != nil {
+		panic(err)
+	}
+	return &t
+}
+
+func TestRequestCommand_UnmarshalJSON_DefaultConnectionPool(t *testing.T) {
+	keepAlive := true
+	defaultPool := ConnectionPool{MaxIdle: 10, MaxConnections: 20, KeepAlive: &keepAlive}
+	DefaultRequestCommand = RequestCommand{ConnectionPool: &defaultPool}
+
+	tests := []struct {
+		input   []byte
+		command RequestCommand
+	}{
+		{
+			[]byte(`"a"`),
+			RequestCommand{
+				ServiceName:    "a",
+				ConnectionPool: &ConnectionPool{MaxIdle: 10, MaxConnections: 20, KeepAlive: &keepAlive},
+			},
+		},
+		{
+			[]byte(`{"service": "a", "connectionPool": {"maxIdle": 1}}`),
+			RequestCommand{
+				ServiceName:    "a",
+				ConnectionPool: &ConnectionPool{MaxIdle: 1, MaxConnections: 20, KeepAlive: &keepAlive},
+			},
+		},
+		{
+			[]byte(`{"service": "a", "connectionPool": {"keepAlive": false}}`),
+			RequestCommand{
+				ServiceName:    "a",
+				ConnectionPool: &ConnectionPool{MaxIdle: 10, MaxConnections: 20, KeepAlive: new(bool)},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		var command RequestCommand
+		if err := json.Unmarshal(test.input, &command); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(test.command, command) {
+			t.Errorf("expected %v; actual %v", test.command, command)
+		}
+	}
+	if defaultPool.MaxIdle != 10 || !*defaultPool.KeepAlive {
+		t.Errorf("the default connection pool was changed to %v", defaultPool)
+	}
+}
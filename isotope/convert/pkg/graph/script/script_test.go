@@ -19,6 +19,8 @@ import (
 	"reflect"
 	"testing"
 	"time"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/duration"
 )
 
 func TestScript_UnmarshalJSON(t *testing.T) {
@@ -37,7 +39,7 @@ func TestScript_UnmarshalJSON(t *testing.T) {
 		{
 			[]byte(`[{"sleep": "1s"}]`),
 			Script{
-				SleepCommand(1 * time.Second),
+				ConstantSleepCommand(1 * time.Second),
 			},
 			nil,
 		},
@@ -45,7 +47,7 @@ func TestScript_UnmarshalJSON(t *testing.T) {
 			[]byte(`[{"call": "A"}, {"sleep": "10ms"}]`),
 			Script{
 				RequestCommand{ServiceName: "A"},
-				SleepCommand(10 * time.Millisecond),
+				ConstantSleepCommand(10 * time.Millisecond),
 			},
 			nil,
 		},
@@ -53,10 +55,30 @@ func TestScript_UnmarshalJSON(t *testing.T) {
 			[]byte(`[[{"call": "A"}, {"call": "B"}], {"sleep": "10ms"}]`),
 			Script{
 				ConcurrentCommand{
-					RequestCommand{ServiceName: "A"},
-					RequestCommand{ServiceName: "B"},
+					Commands: []Command{
+						RequestCommand{ServiceName: "A"},
+						RequestCommand{ServiceName: "B"},
+					},
 				},
-				SleepCommand(10 * time.Millisecond),
+				ConstantSleepCommand(10 * time.Millisecond),
+			},
+			nil,
+		},
+		{
+			[]byte(`[{"concurrent": {"policy": "failFast", "commands": [{"call": "A"}]}}]`),
+			Script{
+				ConcurrentCommand{
+					Commands: []Command{RequestCommand{ServiceName: "A"}},
+					Policy:   FailFast,
+				},
+			},
+			nil,
+		},
+		{
+			[]byte(`[{"compute": "5ms"}, {"allocate": {"size": "1KiB", "retain": true}}]`),
+			Script{
+				ComputeCommand{Duration: duration.Duration(5 * time.Millisecond)},
+				AllocateCommand{Size: 1024, Retain: true},
 			},
 			nil,
 		},
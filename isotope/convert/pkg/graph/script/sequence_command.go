@@ -0,0 +1,53 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import "encoding/json"
+
+// SequenceCommand describes commands run in order, as a single step. It lets
+// a ConcurrentCommand run several commands one after the other alongside its
+// other commands.
+type SequenceCommand struct {
+	Commands []Command
+}
+
+// MarshalJSON encodes the SequenceCommand as a JSON array of its commands.
+func (c SequenceCommand) MarshalJSON() ([]byte, error) {
+	return json.Marshal(Script(c.Commands))
+}
+
+// UnmarshalJSON converts b, a JSON array of commands, to a SequenceCommand.
+func (c *SequenceCommand) UnmarshalJSON(b []byte) (err error) {
+	cmds, err := parseJSONCommands(b)
+	if err != nil {
+		return
+	}
+	*c = SequenceCommand{Commands: cmds}
+	return
+}
+
+// b must contain a single key whose value is an unmarshallable
+// SequenceCommand.
+func parseSequenceCommandFromJSONMap(
+	b []byte) (cmd SequenceCommand, err error) {
+	var m map[string]SequenceCommand
+	err = json.Unmarshal(b, &m)
+	if err != nil {
+		return
+	}
+	for _, cmd = range m {
+	}
+	return
+}
@@ -0,0 +1,124 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSequenceCommand_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		input   []byte
+		command SequenceCommand
+		err     error
+	}{
+		{
+			[]byte(`[{"call": "A"}, {"sleep": "10ms"}]`),
+			SequenceCommand{
+				Commands: []Command{
+					RequestCommand{ServiceName: "A"},
+					ConstantSleepCommand(10 * time.Millisecond),
+				},
+			},
+			nil,
+		},
+		{
+			[]byte(`[[{"call": "A"}, {"call": "B"}], {"call": "C"}]`),
+			SequenceCommand{
+				Commands: []Command{
+					ConcurrentCommand{
+						Commands: []Command{
+							RequestCommand{ServiceName: "A"},
+							RequestCommand{ServiceName: "B"},
+						},
+					},
+					RequestCommand{ServiceName: "C"},
+				},
+			},
+			nil,
+		},
+		{
+			[]byte(`[{"wait": "1s"}]`),
+			SequenceCommand{},
+			UnknownCommandKeyError{"wait"},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			var command SequenceCommand
+			err := json.Unmarshal(test.input, &command)
+			if test.err != err {
+				t.Errorf("expected %v; actual %v", test.err, err)
+			}
+			if !reflect.DeepEqual(test.command, command) {
+				t.Errorf("expected %v; actual %v", test.command, command)
+			}
+		})
+	}
+}
+
+func TestSequenceCommand_MarshalJSON(t *testing.T) {
+	tests := []struct {
+		command Script
+		json    string
+	}{
+		{
+			Script{
+				ConcurrentCommand{
+					Commands: []Command{
+						SequenceCommand{
+							Commands: []Command{
+								ConstantSleepCommand(10 * time.Millisecond),
+								RequestCommand{ServiceName: "A"},
+							},
+						},
+						RequestCommand{ServiceName: "B"},
+					},
+				},
+			},
+			`[[{"sequence":[{"sleep":"10ms"},{"call":{"service":"A","size":"0B"}}]},{"call":{"service":"B","size":"0B"}}]]`,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			b, err := json.Marshal(test.command)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != test.json {
+				t.Errorf("expected %s; actual %s", test.json, b)
+			}
+
+			var command Script
+			if err := json.Unmarshal(b, &command); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(test.command, command) {
+				t.Errorf("expected %v; actual %v", test.command, command)
+			}
+		})
+	}
+}
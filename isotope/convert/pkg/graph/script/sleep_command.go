@@ -15,28 +15,69 @@
 package script
 
 import (
-	"encoding/json"
+	"math"
 	"time"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/dist"
 )
 
-// SleepCommand describes a command to pause for a duration.
-type SleepCommand time.Duration
+// SleepCommand describes a command to pause for a duration sampled from a
+// distribution.
+type SleepCommand struct {
+	// Duration is the distribution of pauses, in nanoseconds.
+	Duration dist.Distribution
+}
 
-// UnmarshalJSON converts a JSON object to a SleepCommand.
-func (c *SleepCommand) UnmarshalJSON(b []byte) (err error) {
-	var durationStr string
-	err = json.Unmarshal(b, &durationStr)
-	if err != nil {
-		return
+// ConstantSleepCommand returns a SleepCommand which always pauses for d.
+func ConstantSleepCommand(d time.Duration) SleepCommand {
+	return SleepCommand{dist.NewConstant(float64(d))}
+}
+
+var durationUnits = dist.Units{
+	Parse: func(s string) (float64, error) {
+		d, err := time.ParseDuration(s)
+		return float64(d), err
+	},
+	Format: func(f float64) string {
+		return time.Duration(f).String()
+	},
+}
+
+// Sample returns a duration to pause for. Samples beyond the longest
+// time.Duration, which heavy-tailed distributions can draw, are clamped to
+// it, rather than overflowing to a negative duration.
+func (c SleepCommand) Sample() time.Duration {
+	d := c.Duration.Sample()
+	if d >= math.MaxInt64 {
+		return math.MaxInt64
 	}
-	duration, err := time.ParseDuration(durationStr)
+	return time.Duration(d)
+}
+
+// Validate returns nil if the distribution of c is valid.
+func (c SleepCommand) Validate() error {
+	return c.Duration.Validate()
+}
+
+// MarshalJSON encodes a constant SleepCommand as a JSON string and any other
+// as a JSON object describing its distribution.
+func (c SleepCommand) MarshalJSON() ([]byte, error) {
+	return c.Duration.Marshal(durationUnits)
+}
+
+// UnmarshalJSON converts a JSON string or object to a SleepCommand. If b is a
+// JSON string, it is parsed as a constant duration. If b is a JSON object, it
+// describes a distribution of durations, e.g.
+// {"distribution": "normal", "mean": "10ms", "stddev": "2ms"}.
+func (c *SleepCommand) UnmarshalJSON(b []byte) (err error) {
+	d, err := dist.Unmarshal(b, durationUnits)
 	if err != nil {
 		return
 	}
-	*c = SleepCommand(duration)
+	*c = SleepCommand{d}
 	return
 }
 
 func (c SleepCommand) String() string {
-	return time.Duration(c).String()
+	return c.Duration.Format(durationUnits)
 }
@@ -16,8 +16,11 @@ package script
 
 import (
 	"encoding/json"
+	"math"
 	"testing"
 	"time"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/dist"
 )
 
 func TestSleepCommand_UnmarshalJSON(t *testing.T) {
@@ -28,7 +31,25 @@ func TestSleepCommand_UnmarshalJSON(t *testing.T) {
 	}{
 		{
 			[]byte(`"100ms"`),
-			SleepCommand(100 * time.Millisecond),
+			ConstantSleepCommand(100 * time.Millisecond),
+			nil,
+		},
+		{
+			[]byte(`{"distribution": "normal", "mean": "10ms", "stddev": "2ms"}`),
+			SleepCommand{dist.Distribution{
+				Type:   dist.Normal,
+				Mean:   float64(10 * time.Millisecond),
+				StdDev: float64(2 * time.Millisecond),
+			}},
+			nil,
+		},
+		{
+			[]byte(`{"distribution": "pareto", "scale": "5ms", "alpha": 1.5}`),
+			SleepCommand{dist.Distribution{
+				Type:  dist.Pareto,
+				Scale: float64(5 * time.Millisecond),
+				Alpha: 1.5,
+			}},
 			nil,
 		},
 	}
@@ -49,3 +70,112 @@ func TestSleepCommand_UnmarshalJSON(t *testing.T) {
 		})
 	}
 }
+
+func TestSleepCommand_Sample(t *testing.T) {
+	tests := []struct {
+		command  SleepCommand
+		duration time.Duration
+	}{
+		{ConstantSleepCommand(10 * time.Millisecond), 10 * time.Millisecond},
+		{SleepCommand{dist.NewConstant(1e19)}, math.MaxInt64},
+		{SleepCommand{dist.NewConstant(math.Inf(1))}, math.MaxInt64},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			if duration := test.command.Sample(); duration != test.duration {
+				t.Errorf("expected %v; actual %v", test.duration, duration)
+			}
+		})
+	}
+}
+
+func TestSleepCommand_MarshalJSON(t *testing.T) {
+	tests := []struct {
+		input  SleepCommand
+		output []byte
+	}{
+		{
+			ConstantSleepCommand(100 * time.Millisecond),
+			[]byte(`"100ms"`),
+		},
+		{
+			SleepCommand{dist.Distribution{
+				Type: dist.Uniform,
+				Min:  float64(5 * time.Millisecond),
+				Max:  float64(15 * time.Millisecond),
+			}},
+			[]byte(`{"distribution":"uniform","max":"15ms","min":"5ms"}`),
+		},
+		{
+			SleepCommand{dist.Distribution{
+				Type:   dist.LogNormal,
+				Median: float64(10 * time.Millisecond),
+				Sigma:  0.5,
+			}},
+			[]byte(`{"distribution":"lognormal","median":"10ms","sigma":0.5}`),
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			output, err := json.Marshal(test.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(test.output) != string(output) {
+				t.Errorf("expected %s; actual %s", test.output, output)
+			}
+
+			var command SleepCommand
+			if err := json.Unmarshal(output, &command); err != nil {
+				t.Fatal(err)
+			}
+			if test.input != command {
+				t.Errorf("expected %v; actual %v", test.input, command)
+			}
+		})
+	}
+}
+
+func TestSleepCommand_String(t *testing.T) {
+	tests := []struct {
+		input SleepCommand
+		s     string
+	}{
+		{ConstantSleepCommand(100 * time.Millisecond), "100ms"},
+		{
+			SleepCommand{dist.Distribution{
+				Type:   dist.Normal,
+				Mean:   float64(10 * time.Millisecond),
+				StdDev: float64(2 * time.Millisecond),
+			}},
+			"normal(mean=10ms, stddev=2ms)",
+		},
+		{
+			SleepCommand{dist.Distribution{
+				Type: dist.Exponential,
+				Mean: float64(time.Second),
+			}},
+			"exponential(mean=1s)",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			s := test.input.String()
+			if test.s != s {
+				t.Errorf("expected %v; actual %v", test.s, s)
+			}
+		})
+	}
+}
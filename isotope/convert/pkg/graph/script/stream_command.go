@@ -0,0 +1,142 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/duration"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/size"
+)
+
+// StreamCommand describes a command to open a long-lived stream to another
+// service, which runs its script and then streams Messages messages back, one
+// every Interval.
+type StreamCommand struct {
+	ServiceName string `json:"service"`
+	// Mode is how an HTTP service streams the messages. Streams from gRPC
+	// services use a server-streaming RPC, and streams from TCP services a
+	// frame per message. If unset, StreamChunked is used.
+	Mode StreamMode `json:"mode,omitempty"`
+	// Messages is the number of messages streamed back.
+	Messages int `json:"messages"`
+	// Interval is the pause between two messages.
+	Interval duration.Duration `json:"interval,omitempty"`
+	// MessageSize is the number of bytes in each message.
+	MessageSize size.ByteSize `json:"messageSize,omitempty"`
+	// Size is the number of bytes in the request body.
+	Size size.ByteSize `json:"size,omitempty"`
+	// Timeout bounds the whole stream. If unset, the stream never times out.
+	Timeout duration.Duration `json:"timeout,omitempty"`
+}
+
+// StreamMode is how an HTTP service streams messages.
+type StreamMode string
+
+const (
+	// StreamChunked streams a line per message in a chunked response.
+	StreamChunked StreamMode = "chunked"
+	// StreamSSE streams an event per message as server-sent events.
+	StreamSSE StreamMode = "sse"
+	// StreamWebSocket upgrades the connection to a WebSocket and streams a
+	// binary frame per message.
+	StreamWebSocket StreamMode = "websocket"
+)
+
+// UnmarshalJSON converts a JSON string to a StreamMode.
+func (m *StreamMode) UnmarshalJSON(b []byte) (err error) {
+	var s string
+	err = json.Unmarshal(b, &s)
+	if err != nil {
+		return
+	}
+	switch mode := StreamMode(s); mode {
+	case StreamChunked, StreamSSE, StreamWebSocket:
+		*m = mode
+	default:
+		err = InvalidStreamModeError{s}
+	}
+	return
+}
+
+// Validate returns nil if c streams at least one message, with a
+// non-negative Interval and Timeout.
+func (c StreamCommand) Validate() error {
+	if c.Messages < 1 {
+		return NonPositiveMessagesError{c.Messages}
+	}
+	if c.Interval < 0 {
+		return NegativeStreamIntervalError{c.Interval}
+	}
+	if c.Timeout < 0 {
+		return NegativeStreamTimeoutError{c.Timeout}
+	}
+	return nil
+}
+
+func (c StreamCommand) String() string {
+	mode := c.Mode
+	if mode == "" {
+		mode = StreamChunked
+	}
+	s := fmt.Sprintf("%dx%s", c.Messages, c.MessageSize)
+	if c.Interval > 0 {
+		s += fmt.Sprintf(" every %s", c.Interval)
+	}
+	return s + fmt.Sprintf(" mode=%s", mode)
+}
+
+// InvalidStreamModeError is returned when a string is not parsable to a
+// StreamMode.
+type InvalidStreamModeError struct {
+	String string
+}
+
+func (e InvalidStreamModeError) Error() string {
+	return fmt.Sprintf(
+		`unknown stream mode: %s (must be "%s", "%s" or "%s")`,
+		e.String, StreamChunked, StreamSSE, StreamWebSocket)
+}
+
+// NonPositiveMessagesError is returned when a StreamCommand streams no
+// messages.
+type NonPositiveMessagesError struct {
+	Messages int
+}
+
+func (e NonPositiveMessagesError) Error() string {
+	return fmt.Sprintf("stream messages %v must be positive", e.Messages)
+}
+
+// NegativeStreamIntervalError is returned when a StreamCommand's Interval is
+// negative.
+type NegativeStreamIntervalError struct {
+	Interval duration.Duration
+}
+
+func (e NegativeStreamIntervalError) Error() string {
+	return fmt.Sprintf("stream interval %v must be non-negative", e.Interval)
+}
+
+// NegativeStreamTimeoutError is returned when a StreamCommand's Timeout is
+// negative.
+type NegativeStreamTimeoutError struct {
+	Timeout duration.Duration
+}
+
+func (e NegativeStreamTimeoutError) Error() string {
+	return fmt.Sprintf("stream timeout %v must be non-negative", e.Timeout)
+}
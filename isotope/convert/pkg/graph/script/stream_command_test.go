@@ -0,0 +1,120 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/duration"
+)
+
+func TestStreamCommand_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		input   []byte
+		command StreamCommand
+		err     error
+	}{
+		{
+			[]byte(`{"service": "a", "messages": 10}`),
+			StreamCommand{ServiceName: "a", Messages: 10},
+			nil,
+		},
+		{
+			[]byte(`{
+				"service": "a",
+				"mode": "sse",
+				"messages": 100,
+				"interval": "1s",
+				"messageSize": "1KiB",
+				"timeout": "5m"
+			}`),
+			StreamCommand{
+				ServiceName: "a",
+				Mode:        StreamSSE,
+				Messages:    100,
+				Interval:    duration.Duration(time.Second),
+				MessageSize: 1024,
+				Timeout:     duration.Duration(5 * time.Minute),
+			},
+			nil,
+		},
+		{
+			[]byte(`{"service": "a", "mode": "websocket", "messages": 1}`),
+			StreamCommand{ServiceName: "a", Mode: StreamWebSocket, Messages: 1},
+			nil,
+		},
+		{
+			[]byte(`{"service": "a", "messages": 1, "mode": "long-poll"}`),
+			StreamCommand{ServiceName: "a", Messages: 1},
+			InvalidStreamModeError{"long-poll"},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			var command StreamCommand
+			err := json.Unmarshal(test.input, &command)
+			if test.err != err {
+				t.Errorf("expected %v; actual %v", test.err, err)
+			}
+			if test.command != command {
+				t.Errorf("expected %v; actual %v", test.command, command)
+			}
+		})
+	}
+}
+
+func TestStreamCommand_Validate(t *testing.T) {
+	tests := []struct {
+		command StreamCommand
+		err     error
+	}{
+		{StreamCommand{ServiceName: "a", Messages: 1}, nil},
+		{
+			StreamCommand{
+				ServiceName: "a",
+				Messages:    10,
+				Interval:    duration.Duration(time.Second),
+			},
+			nil,
+		},
+		{StreamCommand{ServiceName: "a"}, NonPositiveMessagesError{0}},
+		{
+			StreamCommand{ServiceName: "a", Messages: 1, Interval: -1},
+			NegativeStreamIntervalError{-1},
+		},
+		{
+			StreamCommand{ServiceName: "a", Messages: 1, Timeout: -1},
+			NegativeStreamTimeoutError{-1},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			err := test.command.Validate()
+			if test.err != err {
+				t.Errorf("expected %v; actual %v", test.err, err)
+			}
+		})
+	}
+}
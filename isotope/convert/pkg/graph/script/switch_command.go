@@ -0,0 +1,284 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/headers"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/pct"
+)
+
+// SwitchCommand describes branches conditioned on the inbound request. The
+// first case whose condition matches the request runs; if none matches,
+// nothing runs.
+type SwitchCommand struct {
+	Cases []Case
+}
+
+// Case is a branch of a SwitchCommand: the commands run in order when its
+// condition matches. A case without commands does nothing.
+type Case struct {
+	// When is the condition of the case. If nil, the case always matches, as
+	// the default case.
+	When *Condition `json:"when,omitempty"`
+	// Script is run in order when the case matches.
+	Script Script `json:"script,omitempty"`
+}
+
+// Condition matches inbound requests. Each of its set fields must match.
+// Path and PathPrefix match the URL path of HTTP requests; gRPC and TCP
+// requests have no such path, so their services cannot set them.
+type Condition struct {
+	// Header is the name of a header which must be present on the request.
+	Header string `json:"header,omitempty"`
+	// Equals is the value one of the Header's values must equal. If unset,
+	// the Header only has to be present.
+	Equals string `json:"equals,omitempty"`
+	// Path is the path the request must have.
+	Path string `json:"path,omitempty"`
+	// PathPrefix is a prefix the request's path must have.
+	PathPrefix string `json:"pathPrefix,omitempty"`
+	// Cohort is the share of requests which match.
+	Cohort *pct.Percentage `json:"cohort,omitempty"`
+	// CohortKey is the name of a header whose value assigns the request to
+	// the cohort, so that requests with the same value, e.g. of the same user,
+	// match alike in every service. If unset, each request is assigned at
+	// random. Requests without the header are not in the cohort.
+	CohortKey string `json:"cohortKey,omitempty"`
+}
+
+// Match returns the first of c's cases which matches data, the inbound
+// request, or false if none does.
+func (c SwitchCommand) Match(data headers.Data) (Case, bool) {
+	for _, cs := range c.Cases {
+		if cs.When == nil || cs.When.Matches(data) {
+			return cs, true
+		}
+	}
+	return Case{}, false
+}
+
+// Matches returns true if data, the inbound request, matches c.
+func (c Condition) Matches(data headers.Data) bool {
+	if c.Header != "" && !c.matchesHeader(data.Header) {
+		return false
+	}
+	if c.Path != "" && data.Path != c.Path {
+		return false
+	}
+	if c.PathPrefix != "" && !strings.HasPrefix(data.Path, c.PathPrefix) {
+		return false
+	}
+	if c.Cohort != nil && !c.inCohort(data.Header) {
+		return false
+	}
+	return true
+}
+
+func (c Condition) matchesHeader(header http.Header) bool {
+	values, ok := header[c.Header]
+	if !ok {
+		return false
+	}
+	if c.Equals == "" {
+		return true
+	}
+	for _, v := range values {
+		if v == c.Equals {
+			return true
+		}
+	}
+	return false
+}
+
+// inCohort returns true if the request with header is assigned to c's
+// cohort: at random, or by the hash of its CohortKey header if set.
+func (c Condition) inCohort(header http.Header) bool {
+	if c.CohortKey == "" {
+		return rand.Float64() < float64(*c.Cohort)
+	}
+	values, ok := header[c.CohortKey]
+	if !ok {
+		return false
+	}
+	// The low bits of FNV hashes of short values are better distributed than
+	// their high bits.
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(values[0]))
+	return float64(h.Sum32()%cohortBuckets)/cohortBuckets < float64(*c.Cohort)
+}
+
+// cohortBuckets is the number of buckets the values of a CohortKey hash into.
+const cohortBuckets = 10000
+
+func (c Condition) String() string {
+	var parts []string
+	if c.Header != "" {
+		if c.Equals != "" {
+			parts = append(parts, fmt.Sprintf("header %s=%s", c.Header, c.Equals))
+		} else {
+			parts = append(parts, fmt.Sprintf("header %s", c.Header))
+		}
+	}
+	if c.Path != "" {
+		parts = append(parts, fmt.Sprintf("path %s", c.Path))
+	}
+	if c.PathPrefix != "" {
+		parts = append(parts, fmt.Sprintf("path prefix %s", c.PathPrefix))
+	}
+	if c.Cohort != nil {
+		s := fmt.Sprintf("cohort %s", c.Cohort)
+		if c.CohortKey != "" {
+			s += fmt.Sprintf(" by %s", c.CohortKey)
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, " and ")
+}
+
+// UnmarshalJSON converts b to a Condition, validating it and canonicalizing
+// its header names.
+func (c *Condition) UnmarshalJSON(b []byte) (err error) {
+	var unmarshallable unmarshallableCondition
+	err = json.Unmarshal(b, &unmarshallable)
+	if err != nil {
+		return
+	}
+	cond := Condition(unmarshallable)
+	if cond.Header == "" && cond.Path == "" && cond.PathPrefix == "" &&
+		cond.Cohort == nil {
+		err = ErrEmptyCondition
+		return
+	}
+	if cond.Equals != "" && cond.Header == "" {
+		err = ErrEqualsWithoutHeader
+		return
+	}
+	if cond.CohortKey != "" && cond.Cohort == nil {
+		err = ErrCohortKeyWithoutCohort
+		return
+	}
+	for _, name := range []*string{&cond.Header, &cond.CohortKey} {
+		if *name == "" {
+			continue
+		}
+		if !httpguts.ValidHeaderFieldName(*name) {
+			err = headers.InvalidNameError{Name: *name}
+			return
+		}
+		*name = http.CanonicalHeaderKey(*name)
+	}
+	for _, path := range []string{cond.Path, cond.PathPrefix} {
+		if path != "" && !strings.HasPrefix(path, "/") {
+			err = InvalidPathError{path}
+			return
+		}
+	}
+	*c = cond
+	return
+}
+
+type unmarshallableCondition Condition
+
+// MarshalJSON encodes the SwitchCommand as a JSON array of cases.
+func (c SwitchCommand) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.Cases)
+}
+
+// UnmarshalJSON converts b, a JSON array of cases, to a SwitchCommand.
+func (c *SwitchCommand) UnmarshalJSON(b []byte) (err error) {
+	var cases []Case
+	err = json.Unmarshal(b, &cases)
+	if err != nil {
+		return
+	}
+	if len(cases) == 0 {
+		err = ErrEmptySwitch
+		return
+	}
+	for _, cs := range cases[:len(cases)-1] {
+		if cs.When == nil {
+			err = ErrCaseAfterDefault
+			return
+		}
+	}
+	*c = SwitchCommand{Cases: cases}
+	return
+}
+
+// UnmarshalJSON converts b to a Case. b must be a JSON object with an
+// optional "when" condition and either a single command, e.g. "call", or a
+// "script" of commands.
+func (cs *Case) UnmarshalJSON(b []byte) (err error) {
+	*cs = Case{}
+	var m map[string]json.RawMessage
+	err = json.Unmarshal(b, &m)
+	if err != nil {
+		return
+	}
+	if when, ok := m["when"]; ok {
+		var cond Condition
+		err = json.Unmarshal(when, &cond)
+		if err != nil {
+			return
+		}
+		cs.When = &cond
+		delete(m, "when")
+	}
+	cs.Script, err = parseBranchScript(m)
+	return
+}
+
+// b must contain a single key whose value is an unmarshallable SwitchCommand.
+func parseSwitchCommandFromJSONMap(b []byte) (cmd SwitchCommand, err error) {
+	var m map[string]SwitchCommand
+	err = json.Unmarshal(b, &m)
+	if err != nil {
+		return
+	}
+	for _, cmd = range m {
+	}
+	return
+}
+
+// ErrEmptySwitch is returned when a SwitchCommand has no cases.
+var ErrEmptySwitch = errors.New("switch must have at least one case")
+
+// ErrCaseAfterDefault is returned when a case of a SwitchCommand follows a
+// case without a condition, which always matches.
+var ErrCaseAfterDefault = errors.New(
+	"only the last case of a switch may omit its condition")
+
+// ErrEmptyCondition is returned when a Condition sets none of a header, a
+// path, a path prefix or a cohort.
+var ErrEmptyCondition = errors.New(
+	"condition must set a header, path, pathPrefix or cohort")
+
+// ErrEqualsWithoutHeader is returned when a Condition sets a value to equal
+// without a header.
+var ErrEqualsWithoutHeader = errors.New("equals requires a header")
+
+// ErrCohortKeyWithoutCohort is returned when a Condition sets a cohort key
+// without a cohort.
+var ErrCohortKeyWithoutCohort = errors.New("cohortKey requires a cohort")
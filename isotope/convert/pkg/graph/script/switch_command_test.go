@@ -0,0 +1,280 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/headers"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/pct"
+)
+
+func percentage(p pct.Percentage) *pct.Percentage {
+	return &p
+}
+
+func TestSwitchCommand_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		input   []byte
+		command SwitchCommand
+		err     error
+	}{
+		{
+			[]byte(`[{"when": {"header": "x-variant", "equals": "canary"}, "call": "B"}, {"call": "A"}]`),
+			SwitchCommand{
+				Cases: []Case{
+					{
+						When:   &Condition{Header: "X-Variant", Equals: "canary"},
+						Script: Script{RequestCommand{ServiceName: "B"}},
+					},
+					{Script: Script{RequestCommand{ServiceName: "A"}}},
+				},
+			},
+			nil,
+		},
+		{
+			[]byte(`[{"when": {"pathPrefix": "/api/", "cohort": "10%", "cohortKey": "x-user"}, "script": [{"call": "A"}, {"call": "B"}]}, {"when": {"path": "/"}}]`),
+			SwitchCommand{
+				Cases: []Case{
+					{
+						When: &Condition{
+							PathPrefix: "/api/",
+							Cohort:     percentage(0.1),
+							CohortKey:  "X-User",
+						},
+						Script: Script{
+							RequestCommand{ServiceName: "A"},
+							RequestCommand{ServiceName: "B"},
+						},
+					},
+					{When: &Condition{Path: "/"}},
+				},
+			},
+			nil,
+		},
+		{
+			[]byte(`[]`),
+			SwitchCommand{},
+			ErrEmptySwitch,
+		},
+		{
+			[]byte(`[{"call": "A"}, {"when": {"path": "/"}, "call": "B"}]`),
+			SwitchCommand{},
+			ErrCaseAfterDefault,
+		},
+		{
+			[]byte(`[{"when": {}, "call": "A"}]`),
+			SwitchCommand{},
+			ErrEmptyCondition,
+		},
+		{
+			[]byte(`[{"when": {"path": "/", "equals": "canary"}, "call": "A"}]`),
+			SwitchCommand{},
+			ErrEqualsWithoutHeader,
+		},
+		{
+			[]byte(`[{"when": {"path": "/", "cohortKey": "x-user"}, "call": "A"}]`),
+			SwitchCommand{},
+			ErrCohortKeyWithoutCohort,
+		},
+		{
+			[]byte(`[{"when": {"header": "x variant"}, "call": "A"}]`),
+			SwitchCommand{},
+			headers.InvalidNameError{Name: "x variant"},
+		},
+		{
+			[]byte(`[{"when": {"pathPrefix": "api"}, "call": "A"}]`),
+			SwitchCommand{},
+			InvalidPathError{"api"},
+		},
+		{
+			[]byte(`[{"when": {"path": "/"}, "call": "A", "script": [{"call": "B"}]}]`),
+			SwitchCommand{},
+			ErrCommandAndScript,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			var command SwitchCommand
+			err := json.Unmarshal(test.input, &command)
+			if test.err != err {
+				t.Errorf("expected %v; actual %v", test.err, err)
+			}
+			if !reflect.DeepEqual(test.command, command) {
+				t.Errorf("expected %v; actual %v", test.command, command)
+			}
+		})
+	}
+}
+
+func TestSwitchCommand_MarshalJSON(t *testing.T) {
+	tests := []struct {
+		command Script
+		json    string
+	}{
+		{
+			Script{SwitchCommand{
+				Cases: []Case{
+					{
+						When: &Condition{
+							Header:    "X-Variant",
+							Equals:    "canary",
+							Cohort:    percentage(0.5),
+							CohortKey: "X-User",
+						},
+						Script: Script{RequestCommand{ServiceName: "B"}},
+					},
+					{},
+				},
+			}},
+			`[{"switch":[{"when":{"header":"X-Variant","equals":"canary","cohort":0.5,"cohortKey":"X-User"},"script":[{"call":{"service":"B","size":"0B"}}]},{}]}]`,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			b, err := json.Marshal(test.command)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != test.json {
+				t.Errorf("expected %s; actual %s", test.json, b)
+			}
+
+			var command Script
+			if err := json.Unmarshal(b, &command); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(test.command, command) {
+				t.Errorf("expected %v; actual %v", test.command, command)
+			}
+		})
+	}
+}
+
+func TestCondition_Matches(t *testing.T) {
+	data := headers.Data{
+		Path: "/api/users",
+		Header: http.Header{
+			"X-Variant": []string{"stable", "canary"},
+			"X-User":    []string{"alice"},
+		},
+	}
+	tests := []struct {
+		condition Condition
+		matches   bool
+	}{
+		{Condition{Header: "X-Variant"}, true},
+		{Condition{Header: "X-Variant", Equals: "canary"}, true},
+		{Condition{Header: "X-Variant", Equals: "beta"}, false},
+		{Condition{Header: "X-Beta"}, false},
+		{Condition{Path: "/api/users"}, true},
+		{Condition{Path: "/api"}, false},
+		{Condition{PathPrefix: "/api/"}, true},
+		{Condition{PathPrefix: "/web/"}, false},
+		{Condition{Cohort: percentage(0)}, false},
+		{Condition{Cohort: percentage(1)}, true},
+		{Condition{Cohort: percentage(1), CohortKey: "X-User"}, true},
+		{Condition{Cohort: percentage(1), CohortKey: "X-Session"}, false},
+		{Condition{Header: "X-Variant", Path: "/api"}, false},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			if matches := test.condition.Matches(data); matches != test.matches {
+				t.Errorf("expected %v; actual %v", test.matches, matches)
+			}
+		})
+	}
+}
+
+func TestCondition_Matches_CohortKey(t *testing.T) {
+	condition := Condition{Cohort: percentage(0.5), CohortKey: "X-User"}
+	matches := 0
+	for _, user := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		data := headers.Data{Header: http.Header{"X-User": []string{user}}}
+		first := condition.Matches(data)
+		for i := 0; i < 10; i++ {
+			if condition.Matches(data) != first {
+				t.Fatalf("expected user %s to match consistently", user)
+			}
+		}
+		if first {
+			matches++
+		}
+	}
+	if matches == 0 || matches == 8 {
+		t.Errorf("expected some users in the cohort; actual %d of 8", matches)
+	}
+}
+
+func TestSwitchCommand_Match(t *testing.T) {
+	canary := Case{
+		When:   &Condition{Header: "X-Variant", Equals: "canary"},
+		Script: Script{RequestCommand{ServiceName: "B"}},
+	}
+	fallback := Case{Script: Script{RequestCommand{ServiceName: "A"}}}
+	tests := []struct {
+		command SwitchCommand
+		header  http.Header
+		matched Case
+		ok      bool
+	}{
+		{
+			SwitchCommand{Cases: []Case{canary, fallback}},
+			http.Header{"X-Variant": []string{"canary"}},
+			canary,
+			true,
+		},
+		{
+			SwitchCommand{Cases: []Case{canary, fallback}},
+			http.Header{},
+			fallback,
+			true,
+		},
+		{
+			SwitchCommand{Cases: []Case{canary}},
+			http.Header{},
+			Case{},
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			matched, ok := test.command.Match(headers.Data{Header: test.header})
+			if ok != test.ok || !reflect.DeepEqual(test.matched, matched) {
+				t.Errorf("expected %v, %v; actual %v, %v",
+					test.matched, test.ok, matched, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package size
+
+import (
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/dist"
+)
+
+// Distribution is a distribution of sizes, in bytes. A nil Distribution
+// always samples 0.
+type Distribution struct {
+	dist.Distribution
+}
+
+// ConstantDistribution returns a Distribution which always samples z.
+func ConstantDistribution(z ByteSize) *Distribution {
+	return &Distribution{dist.NewConstant(float64(z))}
+}
+
+var byteUnits = dist.Units{
+	Parse: func(s string) (float64, error) {
+		z, err := FromString(s)
+		return float64(z), err
+	},
+	Format: func(f float64) string {
+		return ByteSize(f).String()
+	},
+}
+
+// Sample returns a random size from d.
+func (d *Distribution) Sample() ByteSize {
+	if d == nil {
+		return 0
+	}
+	return ByteSize(d.Distribution.Sample())
+}
+
+// Validate returns nil if the parameters of d are valid.
+func (d *Distribution) Validate() error {
+	if d == nil {
+		return nil
+	}
+	return d.Distribution.Validate()
+}
+
+// MarshalJSON encodes a constant Distribution as a JSON string and any other
+// as a JSON object.
+func (d Distribution) MarshalJSON() ([]byte, error) {
+	return d.Distribution.Marshal(byteUnits)
+}
+
+// UnmarshalJSON converts a JSON string, number or object to a Distribution.
+// A JSON string or number is parsed as a constant size. A JSON object
+// describes a distribution of sizes, e.g.
+// {"distribution": "lognormal", "median": "4KiB", "sigma": 1}.
+func (d *Distribution) UnmarshalJSON(b []byte) (err error) {
+	distribution, err := dist.Unmarshal(b, byteUnits)
+	if err != nil {
+		return
+	}
+	*d = Distribution{distribution}
+	return
+}
+
+func (d *Distribution) String() string {
+	if d == nil {
+		return ByteSize(0).String()
+	}
+	return d.Distribution.Format(byteUnits)
+}
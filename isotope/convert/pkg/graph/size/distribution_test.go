@@ -0,0 +1,110 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package size
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/dist"
+)
+
+func TestDistribution_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		input        []byte
+		distribution Distribution
+		err          error
+	}{
+		{
+			[]byte(`1024`),
+			Distribution{dist.NewConstant(1024)},
+			nil,
+		},
+		{
+			[]byte(`"10 KB"`),
+			Distribution{dist.NewConstant(10240)},
+			nil,
+		},
+		{
+			[]byte(`{"distribution": "uniform", "min": "1K", "max": "2K"}`),
+			Distribution{dist.Distribution{
+				Type: dist.Uniform,
+				Min:  1024,
+				Max:  2048,
+			}},
+			nil,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			var distribution Distribution
+			err := json.Unmarshal(test.input, &distribution)
+			if test.err != err {
+				t.Errorf("expected %v; actual %v", test.err, err)
+			}
+			if !reflect.DeepEqual(test.distribution, distribution) {
+				t.Errorf("expected %v; actual %v", test.distribution, distribution)
+			}
+		})
+	}
+}
+
+func TestDistribution_MarshalJSON(t *testing.T) {
+	tests := []struct {
+		input  *Distribution
+		output []byte
+	}{
+		{
+			ConstantDistribution(10240),
+			[]byte(`"10KiB"`),
+		},
+		{
+			&Distribution{dist.Distribution{Type: dist.Exponential, Mean: 1024}},
+			[]byte(`{"distribution":"exponential","mean":"1KiB"}`),
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			output, err := json.Marshal(test.input)
+			if err != nil {
+				t.Errorf("expected nil; actual %v", err)
+			}
+			if string(test.output) != string(output) {
+				t.Errorf("expected %s; actual %s", test.output, output)
+			}
+		})
+	}
+}
+
+func TestDistribution_Sample(t *testing.T) {
+	t.Parallel()
+
+	var nilDistribution *Distribution
+	if z := nilDistribution.Sample(); z != 0 {
+		t.Errorf("expected 0; actual %v", z)
+	}
+	if z := ConstantDistribution(512).Sample(); z != 512 {
+		t.Errorf("expected 512; actual %v", z)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/script"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/size"
+)
+
+// Endpoint is a named API of a service, which runs its own script instead of
+// the service's.
+type Endpoint struct {
+	// Name identifies the endpoint in calls to it, as "service/name".
+	Name string `json:"name"`
+
+	// Path is the path the endpoint is served on. If unset, it is "/" + Name.
+	Path string `json:"path,omitempty"`
+
+	// Method is the HTTP method the endpoint accepts. If unset, it accepts
+	// any method, and calls to it use GET.
+	Method string `json:"method,omitempty"`
+
+	// ResponseSize is the distribution of the number of bytes in the response
+	// body. If unset, the service's is used.
+	ResponseSize *size.Distribution `json:"responseSize,omitempty"`
+
+	// Script is sequentially called each time the endpoint is called.
+	Script script.Script `json:"script,omitempty"`
+}
+
+// UnmarshalJSON converts b to an Endpoint, defaulting its Path, and validates
+// it.
+func (e *Endpoint) UnmarshalJSON(b []byte) (err error) {
+	var unmarshallable unmarshallableEndpoint
+	err = json.Unmarshal(b, &unmarshallable)
+	if err != nil {
+		return
+	}
+	*e = Endpoint(unmarshallable)
+	if e.Name == "" {
+		err = ErrEmptyEndpointName
+		return
+	}
+	if strings.Contains(e.Name, "/") {
+		err = InvalidEndpointNameError{e.Name}
+		return
+	}
+	if e.Path == "" {
+		e.Path = "/" + e.Name
+	}
+	if !strings.HasPrefix(e.Path, "/") {
+		err = InvalidEndpointPathError{e.Path}
+		return
+	}
+	// Methods are tokens, like header names.
+	if e.Method != "" && !httpguts.ValidHeaderFieldName(e.Method) {
+		err = script.InvalidMethodError{Method: e.Method}
+		return
+	}
+	return
+}
+
+type unmarshallableEndpoint Endpoint
+
+// EndpointByName returns the endpoint of svc named name, if any.
+func (svc Service) EndpointByName(name string) (Endpoint, bool) {
+	for _, e := range svc.Endpoints {
+		if e.Name == name {
+			return e, true
+		}
+	}
+	return Endpoint{}, false
+}
+
+// EndpointByPath returns the endpoint of svc served on path, if any.
+func (svc Service) EndpointByPath(path string) (Endpoint, bool) {
+	for _, e := range svc.Endpoints {
+		if e.Path == path {
+			return e, true
+		}
+	}
+	return Endpoint{}, false
+}
+
+// ErrEmptyEndpointName is returned when an endpoint has no name.
+var ErrEmptyEndpointName = errors.New("endpoints must have a name")
+
+// InvalidEndpointNameError is returned when an endpoint's name contains a
+// "/", which separates the service from the endpoint in calls.
+type InvalidEndpointNameError struct {
+	Name string
+}
+
+func (e InvalidEndpointNameError) Error() string {
+	return fmt.Sprintf(`invalid endpoint name: "%s" (must not contain "/")`, e.Name)
+}
+
+// InvalidEndpointPathError is returned when an endpoint's path does not start
+// with "/".
+type InvalidEndpointPathError struct {
+	Path string
+}
+
+func (e InvalidEndpointPathError) Error() string {
+	return fmt.Sprintf(`invalid endpoint path: "%s" (must start with "/")`, e.Path)
+}
@@ -0,0 +1,127 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/script"
+)
+
+func TestEndpoint_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		input    []byte
+		endpoint Endpoint
+		err      error
+	}{
+		{
+			[]byte(`{"name": "login"}`),
+			Endpoint{Name: "login", Path: "/login"},
+			nil,
+		},
+		{
+			[]byte(`{
+				"name": "users",
+				"path": "/api/users",
+				"method": "GET",
+				"script": [{"sleep": "10ms"}]
+			}`),
+			Endpoint{
+				Name:   "users",
+				Path:   "/api/users",
+				Method: "GET",
+				Script: script.Script{
+					script.ConstantSleepCommand(10 * time.Millisecond),
+				},
+			},
+			nil,
+		},
+		{
+			[]byte(`{}`),
+			Endpoint{},
+			ErrEmptyEndpointName,
+		},
+		{
+			[]byte(`{"name": "a/b"}`),
+			Endpoint{Name: "a/b"},
+			InvalidEndpointNameError{"a/b"},
+		},
+		{
+			[]byte(`{"name": "login", "path": "login"}`),
+			Endpoint{Name: "login", Path: "login"},
+			InvalidEndpointPathError{"login"},
+		},
+		{
+			[]byte(`{"name": "login", "method": "GET /"}`),
+			Endpoint{Name: "login", Path: "/login", Method: "GET /"},
+			script.InvalidMethodError{Method: "GET /"},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			var endpoint Endpoint
+			err := json.Unmarshal(test.input, &endpoint)
+			if test.err != err {
+				t.Errorf("expected %v; actual %v", test.err, err)
+			}
+			if !reflect.DeepEqual(test.endpoint, endpoint) {
+				t.Errorf("expected %v; actual %v", test.endpoint, endpoint)
+			}
+		})
+	}
+}
+
+func TestService_EndpointByPath(t *testing.T) {
+	service := Service{
+		Name: "a",
+		Endpoints: []Endpoint{
+			{Name: "login", Path: "/login"},
+			{Name: "users", Path: "/api/users"},
+		},
+	}
+
+	tests := []struct {
+		path string
+		name string
+		ok   bool
+	}{
+		{"/login", "login", true},
+		{"/api/users", "users", true},
+		{"/users", "", false},
+		{"/", "", false},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.path, func(t *testing.T) {
+			t.Parallel()
+
+			endpoint, ok := service.EndpointByPath(test.path)
+			if test.ok != ok {
+				t.Errorf("expected %v; actual %v", test.ok, ok)
+			}
+			if test.name != endpoint.Name {
+				t.Errorf("expected %v; actual %v", test.name, endpoint.Name)
+			}
+		})
+	}
+}
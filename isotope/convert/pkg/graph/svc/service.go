@@ -15,6 +15,11 @@
 package svc
 
 import (
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/body"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/capacity"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/duration"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/fault"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/headers"
 	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/pct"
 	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/script"
 	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/size"
@@ -37,15 +42,41 @@ type Service struct {
 	IsEntrypoint bool `json:"isEntrypoint,omitempty"`
 
 	// ErrorRate is the percentage chance between 0 and 1 that this service
-	// should respond with a 500 server error rather than 200 OK.
+	// should respond with an error (500 unless set by Errors) rather than 200
+	// OK.
 	ErrorRate pct.Percentage `json:"errorRate,omitempty"`
 
-	// ResponseSize is the number of bytes in the response body.
-	ResponseSize size.ByteSize `json:"responseSize,omitempty"`
+	// Errors describes the codes and timing of the errors returned when
+	// ErrorRate is hit.
+	Errors *fault.Injection `json:"errors,omitempty"`
 
-	// Script is sequentially called each time the service is called.
+	// Capacity bounds the requests served at once, queueing and shedding the
+	// others. If unset, any number of requests is served at once.
+	Capacity *capacity.Capacity `json:"capacity,omitempty"`
+
+	// Headers describes which headers are forwarded to, set on, and echoed
+	// from requests.
+	Headers *headers.Policy `json:"headers,omitempty"`
+
+	// ResponseSize is the distribution of the number of bytes in the response
+	// body. If unset, the body is empty.
+	ResponseSize *size.Distribution `json:"responseSize,omitempty"`
+
+	// ResponseBody describes how the response body is filled.
+	ResponseBody *body.Body `json:"responseBody,omitempty"`
+
+	// Script is sequentially called each time the service is called, unless
+	// the call is to one of its Endpoints.
 	Script script.Script `json:"script,omitempty"`
 
+	// Endpoints are named APIs of the service, each with its own script.
+	Endpoints []Endpoint `json:"endpoints,omitempty"`
+
+	// LatencyBuckets are the upper bounds of the buckets of the service's
+	// duration histograms, in increasing order. If unset, the service's
+	// built-in buckets are used.
+	LatencyBuckets []duration.Duration `json:"latencyBuckets,omitempty"`
+
 	// NumRbacPolicies is the number of policies generated for each service.
 	NumRbacPolicies int32 `json:"numRbacPolicies"`
 }
@@ -30,10 +30,36 @@ var (
 // DefaultService.
 func (svc *Service) UnmarshalJSON(b []byte) (err error) {
 	unmarshallable := unmarshallableService(DefaultService)
+	// Pointer and slice fields are replaced rather than merged, since the
+	// defaults they point to are shared between services.
+	unmarshallable.Errors = nil
+	unmarshallable.Capacity = nil
+	unmarshallable.Headers = nil
+	unmarshallable.ResponseSize = nil
+	unmarshallable.ResponseBody = nil
+	unmarshallable.LatencyBuckets = nil
 	err = json.Unmarshal(b, &unmarshallable)
 	if err != nil {
 		return
 	}
+	if unmarshallable.Errors == nil {
+		unmarshallable.Errors = DefaultService.Errors
+	}
+	if unmarshallable.Capacity == nil {
+		unmarshallable.Capacity = DefaultService.Capacity
+	}
+	if unmarshallable.Headers == nil {
+		unmarshallable.Headers = DefaultService.Headers
+	}
+	if unmarshallable.ResponseSize == nil {
+		unmarshallable.ResponseSize = DefaultService.ResponseSize
+	}
+	if unmarshallable.ResponseBody == nil {
+		unmarshallable.ResponseBody = DefaultService.ResponseBody
+	}
+	if unmarshallable.LatencyBuckets == nil {
+		unmarshallable.LatencyBuckets = DefaultService.LatencyBuckets
+	}
 	*svc = Service(unmarshallable)
 	if svc.Name == "" {
 		err = ErrEmptyName
@@ -27,6 +27,7 @@ func TestFromString(t *testing.T) {
 	}{
 		{"http", ServiceHTTP, nil},
 		{"grpc", ServiceGRPC, nil},
+		{"tcp", ServiceTCP, nil},
 		{"", ServiceUnknown, InvalidServiceTypeStringError{""}},
 		{"cat", ServiceUnknown, InvalidServiceTypeStringError{"cat"}},
 	}
@@ -18,6 +18,11 @@ import (
 	"encoding/json"
 	"sync"
 
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/body"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/capacity"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/duration"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/fault"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/headers"
 	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/pct"
 	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/script"
 	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/size"
@@ -33,6 +38,12 @@ func (g *ServiceGraph) UnmarshalJSON(b []byte) (err error) {
 	if err != nil {
 		return
 	}
+	if pool := metadata.Defaults.ConnectionPool; pool != nil {
+		err = pool.Validate()
+		if err != nil {
+			return
+		}
+	}
 
 	*g, err = parseJSONServiceGraphWithDefaults(b, metadata.Defaults)
 	if err != nil {
@@ -76,13 +87,20 @@ type serviceGraphJSONMetadata struct {
 }
 
 type defaults struct {
-	Type            svctype.ServiceType `json:"type"`
-	ErrorRate       pct.Percentage      `json:"errorRate"`
-	ResponseSize    size.ByteSize       `json:"responseSize"`
-	Script          script.Script       `json:"script"`
-	RequestSize     size.ByteSize       `json:"requestSize"`
-	NumReplicas     int32               `json:"numReplicas"`
-	NumRbacPolicies int32               `json:"numRbacPolicies"`
+	Type            svctype.ServiceType    `json:"type"`
+	ErrorRate       pct.Percentage         `json:"errorRate"`
+	Errors          *fault.Injection       `json:"errors"`
+	Capacity        *capacity.Capacity     `json:"capacity"`
+	Headers         *headers.Policy        `json:"headers"`
+	ResponseSize    *size.Distribution     `json:"responseSize"`
+	ResponseBody    *body.Body             `json:"responseBody"`
+	Script          script.Script          `json:"script"`
+	RequestSize     size.ByteSize          `json:"requestSize"`
+	Connection      script.Connection      `json:"connection"`
+	ConnectionPool  *script.ConnectionPool `json:"connectionPool"`
+	NumReplicas     int32                  `json:"numReplicas"`
+	NumRbacPolicies int32                  `json:"numRbacPolicies"`
+	LatencyBuckets  []duration.Duration    `json:"latencyBuckets"`
 }
 
 func withGlobalDefaults(defaults defaults, f func()) {
@@ -93,14 +111,21 @@ func withGlobalDefaults(defaults defaults, f func()) {
 		Type:            defaults.Type,
 		NumReplicas:     defaults.NumReplicas,
 		ErrorRate:       defaults.ErrorRate,
+		Errors:          defaults.Errors,
+		Capacity:        defaults.Capacity,
+		Headers:         defaults.Headers,
 		ResponseSize:    defaults.ResponseSize,
+		ResponseBody:    defaults.ResponseBody,
 		Script:          defaults.Script,
 		NumRbacPolicies: defaults.NumRbacPolicies,
+		LatencyBuckets:  defaults.LatencyBuckets,
 	}
 
 	origDefaultRequestCommand := script.DefaultRequestCommand
 	script.DefaultRequestCommand = script.RequestCommand{
-		Size: defaults.RequestSize,
+		Size:           defaults.RequestSize,
+		Connection:     defaults.Connection,
+		ConnectionPool: defaults.ConnectionPool,
 	}
 
 	f()
@@ -20,7 +20,14 @@ import (
 	"testing"
 	"time"
 
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/body"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/capacity"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/dist"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/duration"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/fault"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/headers"
 	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/script"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/size"
 	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/svc"
 
 	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/svctype"
@@ -39,10 +46,101 @@ func TestServiceGraph_UnmarshalJSON(t *testing.T) {
 			ServiceGraph{},
 			ErrRequestToUndefinedService{"b"},
 		},
+		{jsonWithNestedConcurrentCommand, graphWithNestedConcurrentCommand, nil},
+		{jsonWithErrors, graphWithErrors, nil},
+		{jsonWithCapacity, graphWithCapacity, nil},
 		{
-			jsonWithNestedConcurrentCommand,
+			jsonWithInvalidCapacity,
 			ServiceGraph{},
-			ErrNestedConcurrentCommand,
+			capacity.InvalidShedCodeError{Code: 500},
+		},
+		{jsonWithHeaders, graphWithHeaders, nil},
+		{jsonWithLatencyBuckets, graphWithLatencyBuckets, nil},
+		{
+			jsonWithUnsortedLatencyBuckets,
+			ServiceGraph{},
+			ErrInvalidLatencyBuckets{"a"},
+		},
+		{jsonWithResponseBody, graphWithResponseBody, nil},
+		{
+			jsonWithInvalidResponseSizeDistribution,
+			ServiceGraph{},
+			dist.InvalidDistributionError{
+				Type:   dist.Exponential,
+				Reason: "mean must be positive",
+			},
+		},
+		{
+			jsonWithInvalidSleepDistribution,
+			ServiceGraph{},
+			dist.InvalidDistributionError{
+				Type:   dist.Uniform,
+				Reason: "min must be non-negative and at most max",
+			},
+		},
+		{
+			jsonWithAmbiguousComputeCommand,
+			ServiceGraph{},
+			script.ErrComputeAmbiguous,
+		},
+		{jsonWithDefaultAfterStep, graphWithDefaultAfterStep, nil},
+		{jsonWithAfterStepInEndpoints, graphWithAfterStepInEndpoints, nil},
+		{jsonWithEndpoints, graphWithEndpoints, nil},
+		{
+			jsonWithRequestToUndefinedEndpoint,
+			ServiceGraph{},
+			ErrRequestToUndefinedEndpoint{"a", "logout"},
+		},
+		{
+			jsonWithDuplicateEndpoint,
+			ServiceGraph{},
+			ErrDuplicateEndpoint{"a", "signin"},
+		},
+		{
+			jsonWithTCPServiceWithEndpoints,
+			ServiceGraph{},
+			ErrTCPServiceWithEndpoints{"a"},
+		},
+		{jsonWithConnectionPool, graphWithConnectionPool, nil},
+		{
+			jsonWithNegativeDefaultConnectionPool,
+			ServiceGraph{},
+			script.NegativeConnectionPoolFieldError{Field: "maxConnections"},
+		},
+		{jsonWithDefaultConnectionPoolToGRPC, graphWithDefaultConnectionPoolToGRPC, nil},
+		{jsonWithStream, graphWithStream, nil},
+		{
+			jsonWithStreamToUndefinedService,
+			ServiceGraph{},
+			ErrRequestToUndefinedService{"b"},
+		},
+		{
+			jsonWithStreamOfNoMessages,
+			ServiceGraph{},
+			script.NonPositiveMessagesError{Messages: 0},
+		},
+		{jsonWithOneOf, graphWithOneOf, nil},
+		{
+			jsonWithOneOfToUndefinedService,
+			ServiceGraph{},
+			ErrRequestToUndefinedService{"c"},
+		},
+		{jsonWithRepeat, graphWithRepeat, nil},
+		{jsonWithSwitch, graphWithSwitch, nil},
+		{
+			jsonWithSwitchToUndefinedService,
+			ServiceGraph{},
+			ErrRequestToUndefinedService{"reviews-v3"},
+		},
+		{
+			jsonWithPathConditionInGRPCService,
+			ServiceGraph{},
+			ErrPathConditionInNonHTTPService{"a"},
+		},
+		{
+			jsonWithRepeatToUndefinedService,
+			ServiceGraph{},
+			ErrRequestToUndefinedService{"c"},
 		},
 	}
 
@@ -66,6 +164,41 @@ func TestServiceGraph_UnmarshalJSON(t *testing.T) {
 	}
 }
 
+// TestServiceGraph_UnmarshalJSON_RoundTrip checks that graphs with defaults
+// parse again, unchanged, once marshalled without them, as in the ConfigMap
+// of the services.
+func TestServiceGraph_UnmarshalJSON_RoundTrip(t *testing.T) {
+	inputs := [][]byte{
+		jsonWithDefaultsAndManyServices,
+		jsonWithConnectionPool,
+		jsonWithDefaultConnectionPoolToGRPC,
+		jsonWithDefaultAfterStep,
+	}
+
+	for _, input := range inputs {
+		input := input
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			var graph ServiceGraph
+			if err := json.Unmarshal(input, &graph); err != nil {
+				t.Fatal(err)
+			}
+			b, err := json.Marshal(graph)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var reparsed ServiceGraph
+			if err := json.Unmarshal(b, &reparsed); err != nil {
+				t.Fatalf("%s: %v", b, err)
+			}
+			if !reflect.DeepEqual(graph, reparsed) {
+				t.Errorf("expected %v; actual %v", graph, reparsed)
+			}
+		})
+	}
+}
+
 var (
 	jsonWithOneService = []byte(`
 		{
@@ -130,9 +263,9 @@ var (
 			Type:         svctype.ServiceHTTP,
 			NumReplicas:  5,
 			ErrorRate:    0.1,
-			ResponseSize: 128,
+			ResponseSize: size.ConstantDistribution(128),
 			Script: script.Script([]script.Command{
-				script.SleepCommand(100 * time.Millisecond),
+				script.ConstantSleepCommand(100 * time.Millisecond),
 			}),
 		},
 		{
@@ -140,10 +273,10 @@ var (
 			Type:         svctype.ServiceHTTP,
 			NumReplicas:  2,
 			ErrorRate:    0.1,
-			ResponseSize: 128,
+			ResponseSize: size.ConstantDistribution(128),
 			Script: script.Script([]script.Command{
 				script.RequestCommand{ServiceName: "a", Size: 1024},
-				script.SleepCommand(10 * time.Millisecond),
+				script.ConstantSleepCommand(10 * time.Millisecond),
 			}),
 		},
 		{
@@ -151,13 +284,15 @@ var (
 			Type:         svctype.ServiceGRPC,
 			NumReplicas:  1,
 			ErrorRate:    0.2,
-			ResponseSize: 1024,
+			ResponseSize: size.ConstantDistribution(1024),
 			Script: script.Script([]script.Command{
 				script.ConcurrentCommand{
-					script.RequestCommand{ServiceName: "a", Size: 516},
-					script.RequestCommand{ServiceName: "b", Size: 516},
+					Commands: []script.Command{
+						script.RequestCommand{ServiceName: "a", Size: 516},
+						script.RequestCommand{ServiceName: "b", Size: 516},
+					},
 				},
-				script.SleepCommand(10 * time.Millisecond),
+				script.ConstantSleepCommand(10 * time.Millisecond),
 			}),
 		},
 	}}
@@ -189,4 +324,821 @@ var (
 			]
 		}
 	`)
-)
+	graphWithNestedConcurrentCommand = ServiceGraph{[]svc.Service{
+		{Name: "a", Type: svctype.ServiceHTTP, NumReplicas: 1},
+		{
+			Name:        "b",
+			Type:        svctype.ServiceHTTP,
+			NumReplicas: 1,
+			Script: script.Script{
+				script.ConcurrentCommand{
+					Commands: []script.Command{
+						script.ConcurrentCommand{
+							Commands: []script.Command{
+								script.RequestCommand{ServiceName: "a"},
+								script.RequestCommand{ServiceName: "a"},
+							},
+						},
+						script.ConstantSleepCommand(10 * time.Millisecond),
+					},
+				},
+			},
+		},
+	}}
+	jsonWithErrors = []byte(`
+		{
+			"defaults": {
+				"errors": {"codes": [503]}
+			},
+			"services": [
+				{
+					"name": "a",
+					"errorRate": "10%"
+				},
+				{
+					"name": "b",
+					"errorRate": "20%",
+					"errors": {
+						"codes": [{"code": 429, "weight": 2}, 500],
+						"afterStep": 1
+					},
+					"script": [{ "call": "a" }, { "sleep": "10ms" }]
+				}
+			]
+		}
+	`)
+	graphWithErrors = ServiceGraph{[]svc.Service{
+		{
+			Name:        "a",
+			Type:        svctype.ServiceHTTP,
+			NumReplicas: 1,
+			ErrorRate:   0.1,
+			Errors: &fault.Injection{
+				Codes: []fault.Code{{Code: 503}},
+			},
+		},
+		{
+			Name:        "b",
+			Type:        svctype.ServiceHTTP,
+			NumReplicas: 1,
+			ErrorRate:   0.2,
+			Errors: &fault.Injection{
+				Codes:     []fault.Code{{Code: 429, Weight: 2}, {Code: 500}},
+				AfterStep: 1,
+			},
+			Script: script.Script([]script.Command{
+				script.RequestCommand{ServiceName: "a"},
+				script.ConstantSleepCommand(10 * time.Millisecond),
+			}),
+		},
+	}}
+	jsonWithCapacity = []byte(`
+		{
+			"defaults": {
+				"capacity": {"maxConcurrency": 100}
+			},
+			"services": [
+				{
+					"name": "a"
+				},
+				{
+					"name": "b",
+					"capacity": {
+						"maxConcurrency": 10,
+						"queueLength": 20,
+						"queueTimeout": "100ms",
+						"shedCode": 429
+					}
+				}
+			]
+		}
+	`)
+	graphWithCapacity = ServiceGraph{[]svc.Service{
+		{
+			Name:        "a",
+			Type:        svctype.ServiceHTTP,
+			NumReplicas: 1,
+			Capacity:    &capacity.Capacity{MaxConcurrency: 100},
+		},
+		{
+			Name:        "b",
+			Type:        svctype.ServiceHTTP,
+			NumReplicas: 1,
+			Capacity: &capacity.Capacity{
+				MaxConcurrency: 10,
+				QueueLength:    20,
+				QueueTimeout:   duration.Duration(100 * time.Millisecond),
+				ShedCode:       429,
+			},
+		},
+	}}
+	jsonWithInvalidCapacity = []byte(`
+		{
+			"services": [
+				{
+					"name": "a",
+					"capacity": {"maxConcurrency": 1, "shedCode": 500}
+				}
+			]
+		}
+	`)
+	jsonWithHeaders = []byte(`
+		{
+			"defaults": {
+				"headers": {"forward": ["x-request-id", "x-user"]}
+			},
+			"services": [
+				{
+					"name": "a"
+				},
+				{
+					"name": "b",
+					"headers": {
+						"set": {"x-version": "v2"},
+						"echo": ["x-user"]
+					}
+				}
+			]
+		}
+	`)
+	graphWithHeaders = ServiceGraph{[]svc.Service{
+		{
+			Name:        "a",
+			Type:        svctype.ServiceHTTP,
+			NumReplicas: 1,
+			Headers: &headers.Policy{
+				Forward: []string{"X-Request-Id", "X-User"},
+			},
+		},
+		{
+			Name:        "b",
+			Type:        svctype.ServiceHTTP,
+			NumReplicas: 1,
+			Headers: &headers.Policy{
+				Set:  map[string]headers.Template{"X-Version": mustTemplate("v2")},
+				Echo: []string{"X-User"},
+			},
+		},
+	}}
+	jsonWithLatencyBuckets = []byte(`
+		{
+			"defaults": {
+				"latencyBuckets": ["1ms", "10ms", "100ms"]
+			},
+			"services": [
+				{
+					"name": "a"
+				},
+				{
+					"name": "b",
+					"latencyBuckets": ["5ms", "1s"]
+				}
+			]
+		}
+	`)
+	graphWithLatencyBuckets = ServiceGraph{[]svc.Service{
+		{
+			Name:        "a",
+			Type:        svctype.ServiceHTTP,
+			NumReplicas: 1,
+			LatencyBuckets: []duration.Duration{
+				duration.Duration(time.Millisecond),
+				duration.Duration(10 * time.Millisecond),
+				duration.Duration(100 * time.Millisecond),
+			},
+		},
+		{
+			Name:        "b",
+			Type:        svctype.ServiceHTTP,
+			NumReplicas: 1,
+			LatencyBuckets: []duration.Duration{
+				duration.Duration(5 * time.Millisecond),
+				duration.Duration(time.Second),
+			},
+		},
+	}}
+	jsonWithUnsortedLatencyBuckets = []byte(`
+		{
+			"services": [
+				{
+					"name": "a",
+					"latencyBuckets": ["10ms", "1ms"]
+				}
+			]
+		}
+	`)
+	jsonWithResponseBody = []byte(`
+		{
+			"defaults": {
+				"responseSize": "1KiB",
+				"responseBody": {"mode": "text"}
+			},
+			"services": [
+				{
+					"name": "a"
+				},
+				{
+					"name": "b",
+					"responseSize": {
+						"distribution": "uniform",
+						"min": "1KiB",
+						"max": "4KiB"
+					},
+					"responseBody": {
+						"mode": "json",
+						"shape": {"depth": 2, "fields": 3},
+						"sizeHeader": "x-response-size"
+					}
+				}
+			]
+		}
+	`)
+	graphWithResponseBody = ServiceGraph{[]svc.Service{
+		{
+			Name:         "a",
+			Type:         svctype.ServiceHTTP,
+			NumReplicas:  1,
+			ResponseSize: size.ConstantDistribution(1024),
+			ResponseBody: &body.Body{Mode: body.Text},
+		},
+		{
+			Name:        "b",
+			Type:        svctype.ServiceHTTP,
+			NumReplicas: 1,
+			ResponseSize: &size.Distribution{Distribution: dist.Distribution{
+				Type: dist.Uniform,
+				Min:  1024,
+				Max:  4096,
+			}},
+			ResponseBody: &body.Body{
+				Mode:       body.JSON,
+				Shape:      &body.Shape{Depth: 2, Fields: 3},
+				SizeHeader: "X-Response-Size",
+			},
+		},
+	}}
+	jsonWithInvalidResponseSizeDistribution = []byte(`
+		{
+			"services": [
+				{
+					"name": "a",
+					"responseSize": {"distribution": "exponential", "mean": 0}
+				}
+			]
+		}
+	`)
+	jsonWithAmbiguousComputeCommand = []byte(`
+		{
+			"services": [
+				{
+					"name": "a",
+					"script": [
+						{ "compute": { "duration": "1ms", "iterations": 100 } }
+					]
+				}
+			]
+		}
+	`)
+	jsonWithDefaultAfterStep = []byte(`
+		{
+			"defaults": { "errors": {"afterStep": 1} },
+			"services": [
+				{ "name": "a" },
+				{ "name": "b", "script": [{ "call": "a" }, { "sleep": "10ms" }] }
+			]
+		}
+	`)
+	graphWithDefaultAfterStep = ServiceGraph{[]svc.Service{
+		{
+			Name:        "a",
+			Type:        svctype.ServiceHTTP,
+			NumReplicas: 1,
+			Errors:      &fault.Injection{AfterStep: 1},
+		},
+		{
+			Name:        "b",
+			Type:        svctype.ServiceHTTP,
+			NumReplicas: 1,
+			Errors:      &fault.Injection{AfterStep: 1},
+			Script: script.Script{
+				script.RequestCommand{ServiceName: "a"},
+				script.ConstantSleepCommand(10 * time.Millisecond),
+			},
+		},
+	}}
+	jsonWithAfterStepInEndpoints = []byte(`
+		{
+			"services": [
+				{
+					"name": "a",
+					"errors": {"afterStep": 2},
+					"endpoints": [
+						{
+							"name": "login",
+							"path": "/login",
+							"script": [{ "sleep": "10ms" }, { "sleep": "10ms" }]
+						}
+					]
+				}
+			]
+		}
+	`)
+	graphWithAfterStepInEndpoints = ServiceGraph{[]svc.Service{
+		{
+			Name:        "a",
+			Type:        svctype.ServiceHTTP,
+			NumReplicas: 1,
+			Errors:      &fault.Injection{AfterStep: 2},
+			Endpoints: []svc.Endpoint{
+				{
+					Name: "login",
+					Path: "/login",
+					Script: script.Script{
+						script.ConstantSleepCommand(10 * time.Millisecond),
+						script.ConstantSleepCommand(10 * time.Millisecond),
+					},
+				},
+			},
+		},
+	}}
+	jsonWithEndpoints = []byte(`
+		{
+			"services": [
+				{
+					"name": "a",
+					"endpoints": [
+						{
+							"name": "login",
+							"method": "POST",
+							"responseSize": "1KiB",
+							"script": [{ "sleep": "10ms" }]
+						},
+						{ "name": "users", "path": "/api/users" }
+					]
+				},
+				{
+					"name": "b",
+					"script": [
+						{ "call": "a/login" },
+						{ "call": { "service": "a", "endpoint": "users" } }
+					]
+				}
+			]
+		}
+	`)
+	graphWithEndpoints = ServiceGraph{[]svc.Service{
+		{
+			Name:        "a",
+			Type:        svctype.ServiceHTTP,
+			NumReplicas: 1,
+			Endpoints: []svc.Endpoint{
+				{
+					Name:         "login",
+					Path:         "/login",
+					Method:       "POST",
+					ResponseSize: size.ConstantDistribution(1024),
+					Script: script.Script{
+						script.ConstantSleepCommand(10 * time.Millisecond),
+					},
+				},
+				{Name: "users", Path: "/api/users"},
+			},
+		},
+		{
+			Name:        "b",
+			Type:        svctype.ServiceHTTP,
+			NumReplicas: 1,
+			Script: script.Script{
+				script.RequestCommand{ServiceName: "a", Endpoint: "login"},
+				script.RequestCommand{ServiceName: "a", Endpoint: "users"},
+			},
+		},
+	}}
+	jsonWithRequestToUndefinedEndpoint = []byte(`
+		{
+			"services": [
+				{
+					"name": "a",
+					"endpoints": [{ "name": "login" }],
+					"script": [{ "call": "a/logout" }]
+				}
+			]
+		}
+	`)
+	jsonWithDuplicateEndpoint = []byte(`
+		{
+			"services": [
+				{
+					"name": "a",
+					"endpoints": [
+						{ "name": "login" },
+						{ "name": "signin", "path": "/login" }
+					]
+				}
+			]
+		}
+	`)
+	jsonWithTCPServiceWithEndpoints = []byte(`
+		{
+			"services": [
+				{
+					"name": "a",
+					"type": "tcp",
+					"endpoints": [{ "name": "login" }]
+				}
+			]
+		}
+	`)
+	jsonWithConnectionPool = []byte(`
+		{
+			"defaults": {
+				"connection": "new",
+				"connectionPool": { "connectTimeout": "1s", "maxConnections": 10 }
+			},
+			"services": [
+				{ "name": "a" },
+				{
+					"name": "b",
+					"script": [
+						{ "call": "a" },
+						{
+							"call": {
+								"service": "a",
+								"connection": "reuse",
+								"connectionPool": { "maxIdle": 5 }
+							}
+						}
+					]
+				}
+			]
+		}
+	`)
+	graphWithConnectionPool = ServiceGraph{[]svc.Service{
+		{Name: "a", Type: svctype.ServiceHTTP, NumReplicas: 1},
+		{
+			Name:        "b",
+			Type:        svctype.ServiceHTTP,
+			NumReplicas: 1,
+			Script: script.Script{
+				script.RequestCommand{
+					ServiceName: "a",
+					Connection:  script.ConnectionNew,
+					ConnectionPool: &script.ConnectionPool{
+						MaxConnections: 10,
+						ConnectTimeout: duration.Duration(time.Second),
+					},
+				},
+				script.RequestCommand{
+					ServiceName: "a",
+					Connection:  script.ConnectionReuse,
+					ConnectionPool: &script.ConnectionPool{
+						MaxIdle:        5,
+						MaxConnections: 10,
+						ConnectTimeout: duration.Duration(time.Second),
+					},
+				},
+			},
+		},
+	}}
+	jsonWithNegativeDefaultConnectionPool = []byte(`
+		{
+			"defaults": { "connectionPool": { "maxConnections": -1 } },
+			"services": [{ "name": "a" }]
+		}
+	`)
+	jsonWithDefaultConnectionPoolToGRPC = []byte(`
+		{
+			"defaults": { "connectionPool": { "maxIdle": 5, "maxConnections": 10 } },
+			"services": [
+				{ "name": "a", "type": "grpc" },
+				{
+					"name": "b",
+					"script": [
+						{
+							"call": {
+								"service": "a",
+								"connectionPool": { "keepAlive": false }
+							}
+						}
+					]
+				}
+			]
+		}
+	`)
+	graphWithDefaultConnectionPoolToGRPC = ServiceGraph{[]svc.Service{
+		{Name: "a", Type: svctype.ServiceGRPC, NumReplicas: 1},
+		{
+			Name:        "b",
+			Type:        svctype.ServiceHTTP,
+			NumReplicas: 1,
+			Script: script.Script{
+				script.RequestCommand{
+					ServiceName: "a",
+					ConnectionPool: &script.ConnectionPool{
+						MaxIdle:        5,
+						MaxConnections: 10,
+						KeepAlive:      new(bool),
+					},
+				},
+			},
+		},
+	}}
+	jsonWithStream = []byte(`
+		{
+			"services": [
+				{ "name": "a" },
+				{
+					"name": "b",
+					"script": [
+						{
+							"stream": {
+								"service": "a",
+								"mode": "sse",
+								"messages": 10,
+								"interval": "100ms",
+								"messageSize": "1KiB"
+							}
+						}
+					]
+				}
+			]
+		}
+	`)
+	graphWithStream = ServiceGraph{[]svc.Service{
+		{Name: "a", Type: svctype.ServiceHTTP, NumReplicas: 1},
+		{
+			Name:        "b",
+			Type:        svctype.ServiceHTTP,
+			NumReplicas: 1,
+			Script: script.Script{
+				script.StreamCommand{
+					ServiceName: "a",
+					Mode:        script.StreamSSE,
+					Messages:    10,
+					Interval:    duration.Duration(100 * time.Millisecond),
+					MessageSize: 1024,
+				},
+			},
+		},
+	}}
+	jsonWithStreamToUndefinedService = []byte(`
+		{
+			"services": [
+				{
+					"name": "a",
+					"script": [{ "stream": { "service": "b", "messages": 1 } }]
+				}
+			]
+		}
+	`)
+	jsonWithStreamOfNoMessages = []byte(`
+		{
+			"services": [
+				{ "name": "a" },
+				{
+					"name": "b",
+					"script": [{ "stream": { "service": "a", "messages": 0 } }]
+				}
+			]
+		}
+	`)
+	jsonWithOneOf = []byte(`
+		{
+			"services": [
+				{ "name": "a" },
+				{
+					"name": "b",
+					"script": [
+						{
+							"oneOf": [
+								{ "weight": 9, "call": "a" },
+								{ "weight": 1, "script": [{ "sleep": "10ms" }] }
+							]
+						}
+					]
+				}
+			]
+		}
+	`)
+	graphWithOneOf = ServiceGraph{[]svc.Service{
+		{Name: "a", Type: svctype.ServiceHTTP, NumReplicas: 1},
+		{
+			Name:        "b",
+			Type:        svctype.ServiceHTTP,
+			NumReplicas: 1,
+			Script: script.Script{
+				script.OneOfCommand{
+					Alternatives: []script.Alternative{
+						{
+							Weight: 9,
+							Script: script.Script{
+								script.RequestCommand{ServiceName: "a"},
+							},
+						},
+						{
+							Weight: 1,
+							Script: script.Script{
+								script.ConstantSleepCommand(10 * time.Millisecond),
+							},
+						},
+					},
+				},
+			},
+		},
+	}}
+	jsonWithOneOfToUndefinedService = []byte(`
+		{
+			"services": [
+				{ "name": "a" },
+				{
+					"name": "b",
+					"script": [{ "oneOf": [{ "call": "a" }, { "call": "c" }] }]
+				}
+			]
+		}
+	`)
+	jsonWithRepeat = []byte(`
+		{
+			"services": [
+				{ "name": "a" },
+				{
+					"name": "b",
+					"script": [
+						[
+							{
+								"repeat": {
+									"count": 20,
+									"concurrent": true,
+									"maxParallelism": 5,
+									"script": [{ "call": "a" }]
+								}
+							},
+							{ "sequence": [{ "sleep": "10ms" }, { "call": "a" }] }
+						]
+					]
+				}
+			]
+		}
+	`)
+	graphWithRepeat = ServiceGraph{[]svc.Service{
+		{Name: "a", Type: svctype.ServiceHTTP, NumReplicas: 1},
+		{
+			Name:        "b",
+			Type:        svctype.ServiceHTTP,
+			NumReplicas: 1,
+			Script: script.Script{
+				script.ConcurrentCommand{
+					Commands: []script.Command{
+						script.RepeatCommand{
+							Count:          20,
+							Concurrent:     true,
+							MaxParallelism: 5,
+							Script: script.Script{
+								script.RequestCommand{ServiceName: "a"},
+							},
+						},
+						script.SequenceCommand{
+							Commands: []script.Command{
+								script.ConstantSleepCommand(10 * time.Millisecond),
+								script.RequestCommand{ServiceName: "a"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}}
+	jsonWithRepeatToUndefinedService = []byte(`
+		{
+			"services": [
+				{ "name": "a" },
+				{
+					"name": "b",
+					"script": [
+						{
+							"repeat": {
+								"count": 2,
+								"script": [{ "sequence": [{ "call": "c" }] }]
+							}
+						}
+					]
+				}
+			]
+		}
+	`)
+	jsonWithSwitch = []byte(`
+		{
+			"services": [
+				{ "name": "reviews-v1" },
+				{ "name": "reviews-v2" },
+				{
+					"name": "productpage",
+					"script": [
+						{
+							"switch": [
+								{
+									"when": { "header": "x-variant", "equals": "canary" },
+									"call": "reviews-v2"
+								},
+								{ "call": "reviews-v1" }
+							]
+						}
+					]
+				}
+			]
+		}
+	`)
+	graphWithSwitch = ServiceGraph{[]svc.Service{
+		{Name: "reviews-v1", Type: svctype.ServiceHTTP, NumReplicas: 1},
+		{Name: "reviews-v2", Type: svctype.ServiceHTTP, NumReplicas: 1},
+		{
+			Name:        "productpage",
+			Type:        svctype.ServiceHTTP,
+			NumReplicas: 1,
+			Script: script.Script{
+				script.SwitchCommand{
+					Cases: []script.Case{
+						{
+							When: &script.Condition{
+								Header: "X-Variant",
+								Equals: "canary",
+							},
+							Script: script.Script{
+								script.RequestCommand{ServiceName: "reviews-v2"},
+							},
+						},
+						{
+							Script: script.Script{
+								script.RequestCommand{ServiceName: "reviews-v1"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}}
+	jsonWithSwitchToUndefinedService = []byte(`
+		{
+			"services": [
+				{ "name": "reviews-v1" },
+				{
+					"name": "productpage",
+					"script": [
+						{
+							"switch": [
+								{ "when": { "cohort": "10%" }, "call": "reviews-v3" },
+								{ "call": "reviews-v1" }
+							]
+						}
+					]
+				}
+			]
+		}
+	`)
+	jsonWithPathConditionInGRPCService = []byte(`
+		{
+			"services": [
+				{ "name": "b" },
+				{
+					"name": "a",
+					"type": "grpc",
+					"script": [
+						{
+							"switch": [
+								{ "when": { "pathPrefix": "/api" }, "call": "b" }
+							]
+						}
+					]
+				}
+			]
+		}
+	`)
+	jsonWithInvalidSleepDistribution = []byte(`
+		{
+			"services": [
+				{
+					"name": "a",
+					"script": [
+						[
+							{
+								"sleep": {
+									"distribution": "uniform",
+									"min": "10ms",
+									"max": "5ms"
+								}
+							}
+						]
+					]
+				}
+			]
+		}
+	`)
+)
+
+func mustTemplate(text string) headers.Template {
+	t, err := headers.NewTemplate(text)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
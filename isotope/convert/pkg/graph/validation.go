@@ -15,57 +15,159 @@
 package graph
 
 import (
-	"errors"
 	"fmt"
 
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/duration"
 	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/script"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/svctype"
 )
 
 // validate returns nil if g is valid.
 // g is valid if a ServiceGraph:
 // - Each of its services only makes requests to other defined services.
-// - ConcurrentCommands do not contain other ConcurrentCommands.
+// - Each of its services only opens streams to other defined services.
+// - Requests to endpoints name endpoints defined by their service.
+// - Endpoints of a service have distinct names and paths.
+// - TCP services declare no endpoints.
+// - Commands nested in concurrent, oneOf, switch, sequence or repeat are valid.
+// - Only HTTP services switch on the path of their requests.
+// - SleepCommands sample from valid distributions.
+// - ComputeCommands set exactly one of a duration or iterations.
+// - StreamCommands stream at least one message.
+// - AllocateCommands allocate between 1 byte and script.MaxAllocationSize.
+// - Response sizes are sampled from valid distributions.
+// - Latency buckets are positive and increasing.
 func validate(g ServiceGraph) error {
-	svcNames := map[string]bool{}
+	s := scope{endpointNames: map[string]map[string]bool{}}
 	for _, svc := range g.Services {
-		svcNames[svc.Name] = true
+		if svc.Type == svctype.ServiceTCP && len(svc.Endpoints) > 0 {
+			return ErrTCPServiceWithEndpoints{svc.Name}
+		}
+		names := map[string]bool{}
+		paths := map[string]bool{}
+		for _, e := range svc.Endpoints {
+			if names[e.Name] || paths[e.Path] {
+				return ErrDuplicateEndpoint{svc.Name, e.Name}
+			}
+			names[e.Name] = true
+			paths[e.Path] = true
+		}
+		s.endpointNames[svc.Name] = names
 	}
 	for _, svc := range g.Services {
-		if err := validateCommands(svc.Script, svcNames); err != nil {
+		s.serviceName = svc.Name
+		s.serviceType = svc.Type
+		if err := validateCommands(svc.Script, s); err != nil {
+			return err
+		}
+		for _, e := range svc.Endpoints {
+			if err := validateCommands(e.Script, s); err != nil {
+				return err
+			}
+			if err := e.ResponseSize.Validate(); err != nil {
+				return err
+			}
+		}
+		if err := svc.ResponseSize.Validate(); err != nil {
 			return err
 		}
+		if !areIncreasing(svc.LatencyBuckets) {
+			return ErrInvalidLatencyBuckets{svc.Name}
+		}
 	}
 	return nil
 }
 
-func validateCommands(cmds []script.Command, svcNames map[string]bool) error {
+// areIncreasing returns true if each of buckets is greater than the previous
+// one, and the first is greater than 0.
+func areIncreasing(buckets []duration.Duration) bool {
+	var prev duration.Duration
+	for _, bucket := range buckets {
+		if bucket <= prev {
+			return false
+		}
+		prev = bucket
+	}
+	return true
+}
+
+// scope is what commands are validated against.
+type scope struct {
+	// serviceName and serviceType are those of the service whose commands
+	// are validated.
+	serviceName string
+	serviceType svctype.ServiceType
+	// endpointNames maps the name of each service to the names of its
+	// endpoints.
+	endpointNames map[string]map[string]bool
+}
+
+// validateCommands validates cmds in scope s.
+func validateCommands(cmds []script.Command, s scope) error {
 	for _, cmd := range cmds {
 		switch cmd := cmd.(type) {
+		case script.SleepCommand:
+			if err := cmd.Validate(); err != nil {
+				return err
+			}
+		case script.ComputeCommand:
+			if err := cmd.Validate(); err != nil {
+				return err
+			}
+		case script.AllocateCommand:
+			if err := cmd.Validate(); err != nil {
+				return err
+			}
 		case script.RequestCommand:
-			if !svcNames[cmd.ServiceName] {
+			names, ok := s.endpointNames[cmd.ServiceName]
+			if !ok {
 				return ErrRequestToUndefinedService{cmd.ServiceName}
 			}
+			if cmd.Endpoint != "" && !names[cmd.Endpoint] {
+				return ErrRequestToUndefinedEndpoint{
+					cmd.ServiceName, cmd.Endpoint}
+			}
+		case script.StreamCommand:
+			if _, ok := s.endpointNames[cmd.ServiceName]; !ok {
+				return ErrRequestToUndefinedService{cmd.ServiceName}
+			}
+			if err := cmd.Validate(); err != nil {
+				return err
+			}
 		case script.ConcurrentCommand:
-			if err := validateCommands(cmd, svcNames); err != nil {
+			if err := validateCommands(cmd.Commands, s); err != nil {
+				return err
+			}
+		case script.SequenceCommand:
+			if err := validateCommands(cmd.Commands, s); err != nil {
+				return err
+			}
+		case script.RepeatCommand:
+			if err := validateCommands(cmd.Script, s); err != nil {
 				return err
 			}
-			if containsConcurrentCommand([]script.Command(cmd)) {
-				return ErrNestedConcurrentCommand
+		case script.OneOfCommand:
+			for _, a := range cmd.Alternatives {
+				if err := validateCommands(a.Script, s); err != nil {
+					return err
+				}
+			}
+		case script.SwitchCommand:
+			for _, c := range cmd.Cases {
+				if c.When != nil &&
+					(c.When.Path != "" || c.When.PathPrefix != "") &&
+					s.serviceType != svctype.ServiceHTTP {
+					return ErrPathConditionInNonHTTPService{s.serviceName}
+				}
+				if err := validateCommands(c.Script, s); err != nil {
+					return err
+				}
 			}
 		}
 	}
 	return nil
 }
 
-func containsConcurrentCommand(cmds []script.Command) bool {
-	for _, cmd := range cmds {
-		if _, ok := cmd.(script.ConcurrentCommand); ok {
-			return true
-		}
-	}
-	return false
-}
-
 // ErrRequestToUndefinedService is returned when a RequestCommand has a
 // ServiceName that is not the name of a defined service.
 type ErrRequestToUndefinedService struct {
@@ -76,7 +178,63 @@ func (e ErrRequestToUndefinedService) Error() string {
 	return fmt.Sprintf(`cannot call undefined service "%s"`, e.ServiceName)
 }
 
-// ErrNestedConcurrentCommand is returned when a ConcurrentCommand contains
-// a ConcurrentCommand.
-var ErrNestedConcurrentCommand = errors.New(
-	"concurrent commands may not be nested")
+// ErrRequestToUndefinedEndpoint is returned when a RequestCommand has an
+// Endpoint that is not the name of an endpoint of its service.
+type ErrRequestToUndefinedEndpoint struct {
+	ServiceName string
+	Endpoint    string
+}
+
+func (e ErrRequestToUndefinedEndpoint) Error() string {
+	return fmt.Sprintf(
+		`cannot call undefined endpoint "%s/%s"`, e.ServiceName, e.Endpoint)
+}
+
+// ErrPathConditionInNonHTTPService is returned when a case of a SwitchCommand
+// in the script of a gRPC or TCP service matches the path of the request,
+// which only HTTP requests have.
+type ErrPathConditionInNonHTTPService struct {
+	ServiceName string
+}
+
+func (e ErrPathConditionInNonHTTPService) Error() string {
+	return fmt.Sprintf(
+		`switch cases of service "%s" cannot match paths, which only HTTP `+
+			`requests have`, e.ServiceName)
+}
+
+// ErrDuplicateEndpoint is returned when an endpoint of a service has the same
+// name or path as another of its endpoints.
+type ErrDuplicateEndpoint struct {
+	ServiceName string
+	Endpoint    string
+}
+
+func (e ErrDuplicateEndpoint) Error() string {
+	return fmt.Sprintf(
+		`endpoint "%s/%s" has the name or path of another endpoint`,
+		e.ServiceName, e.Endpoint)
+}
+
+// ErrTCPServiceWithEndpoints is returned when a TCP service declares
+// endpoints, which its framed protocol cannot address.
+type ErrTCPServiceWithEndpoints struct {
+	ServiceName string
+}
+
+func (e ErrTCPServiceWithEndpoints) Error() string {
+	return fmt.Sprintf(
+		`TCP service "%s" cannot declare endpoints`, e.ServiceName)
+}
+
+// ErrInvalidLatencyBuckets is returned when a service's latency buckets are
+// not positive and increasing.
+type ErrInvalidLatencyBuckets struct {
+	ServiceName string
+}
+
+func (e ErrInvalidLatencyBuckets) Error() string {
+	return fmt.Sprintf(
+		`latency buckets of service "%s" must be positive and increasing`,
+		e.ServiceName)
+}
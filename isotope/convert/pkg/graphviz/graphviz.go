@@ -18,9 +18,12 @@ package graphviz
 import (
 	"bytes"
 	"fmt"
+	"strconv"
+	"strings"
 	"text/template"
 
 	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/fault"
 	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/script"
 	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/svc"
 )
@@ -87,13 +90,26 @@ type Node struct {
 	ErrorRate    string
 	ResponseSize string
 	Steps        [][]string
+	Endpoints    []Endpoint
 }
 
-// Edge represents a directed edge in the Graphviz graph.
+// Endpoint represents an endpoint of a service, rendered below the service's
+// steps with a port of its own which edges to the endpoint point at.
+type Endpoint struct {
+	Name  string
+	Label string
+	Steps [][]string
+}
+
+// Edge represents a directed edge in the Graphviz graph. It starts at the
+// step of FromEndpoint, or of the service's script if FromEndpoint is empty,
+// and ends at ToEndpoint, or at the node if ToEndpoint is empty.
 type Edge struct {
-	From      string
-	To        string
-	StepIndex int
+	From         string
+	To           string
+	StepIndex    int
+	FromEndpoint string
+	ToEndpoint   string
 }
 
 const graphvizTemplate = `digraph {
@@ -115,29 +131,89 @@ const graphvizTemplate = `digraph {
   {{- end -}}
   </TD></TR>
   {{- end }}
+  {{- range $e := .Endpoints }}
+  <TR><TD PORT="endpoint-{{ $e.Name }}"><B>{{ $e.Label }}</B></TD></TR>
+  {{- range $i, $cmds := $e.Steps }}
+  <TR><TD PORT="endpoint-{{ $e.Name }}-{{ $i }}">
+  {{- range $j, $cmd := $cmds -}}
+    {{- if $j -}}<BR />{{- end -}}
+    {{- $cmd -}}
+  {{- end -}}
+  </TD></TR>
+  {{- end }}
+  {{- end }}
 </TABLE>>];
 
   {{ end }}
 
   {{- range .Edges }}
-  "{{ .From -}}":{{- .StepIndex }} -> "{{ .To }}"
+  "{{ .From -}}":
+  {{- if .FromEndpoint -}}
+    "endpoint-{{ .FromEndpoint }}-{{ .StepIndex }}"
+  {{- else -}}
+    {{- .StepIndex }}
+  {{- end }} -> "{{ .To }}"
+  {{- if .ToEndpoint -}}
+    :"endpoint-{{ .ToEndpoint }}"
+  {{- end }}
   {{- end }}
 }
 `
 
 func getEdgesFromExe(
-	exe script.Command, idx int, fromServiceName string) (edges []Edge) {
+	exe script.Command,
+	idx int,
+	fromServiceName string,
+	fromEndpoint string) (edges []Edge) {
 	switch cmd := exe.(type) {
 	case script.ConcurrentCommand:
-		for _, subCmd := range cmd {
-			subEdges := getEdgesFromExe(subCmd, idx, fromServiceName)
+		for _, subCmd := range cmd.Commands {
+			subEdges := getEdgesFromExe(
+				subCmd, idx, fromServiceName, fromEndpoint)
+			edges = append(edges, subEdges...)
+		}
+	case script.SequenceCommand:
+		for _, subCmd := range cmd.Commands {
+			subEdges := getEdgesFromExe(
+				subCmd, idx, fromServiceName, fromEndpoint)
+			edges = append(edges, subEdges...)
+		}
+	case script.RepeatCommand:
+		for _, subCmd := range cmd.Script {
+			subEdges := getEdgesFromExe(
+				subCmd, idx, fromServiceName, fromEndpoint)
 			edges = append(edges, subEdges...)
 		}
+	case script.OneOfCommand:
+		for _, a := range cmd.Alternatives {
+			for _, subCmd := range a.Script {
+				subEdges := getEdgesFromExe(
+					subCmd, idx, fromServiceName, fromEndpoint)
+				edges = append(edges, subEdges...)
+			}
+		}
+	case script.SwitchCommand:
+		for _, c := range cmd.Cases {
+			for _, subCmd := range c.Script {
+				subEdges := getEdgesFromExe(
+					subCmd, idx, fromServiceName, fromEndpoint)
+				edges = append(edges, subEdges...)
+			}
+		}
+	case script.StreamCommand:
+		edges = append(edges, Edge{
+			From:         fromServiceName,
+			To:           cmd.ServiceName,
+			StepIndex:    idx,
+			FromEndpoint: fromEndpoint,
+		})
 	case script.RequestCommand:
 		e := Edge{
-			From:      fromServiceName,
-			To:        cmd.ServiceName,
-			StepIndex: idx,
+			From:         fromServiceName,
+			To:           cmd.ServiceName,
+			StepIndex:    idx,
+			FromEndpoint: fromEndpoint,
+			ToEndpoint:   cmd.Endpoint,
 		}
 		edges = append(edges, e)
 	}
@@ -145,69 +221,283 @@ func getEdgesFromExe(
 }
 
 func toGraphvizNode(service svc.Service) (Node, []Edge, error) {
-	steps := make([][]string, 0, len(service.Script))
-	edges := make([]Edge, 0, len(service.Script))
-	for idx, exe := range service.Script {
-		step, err := executableToStringSlice(exe)
-		if err != nil {
-			return Node{}, nil, err
-		}
-		steps = append(steps, step)
-
-		stepEdges := getEdgesFromExe(exe, idx, service.Name)
-		edges = append(edges, stepEdges...)
+	steps, edges, err := scriptToSteps(service.Script, service.Name, "")
+	if err != nil {
+		return Node{}, nil, err
 	}
 	n := Node{
 		Name:         service.Name,
 		Type:         service.Type.String(),
-		ErrorRate:    service.ErrorRate.String(),
+		ErrorRate:    errorRateToString(service),
 		ResponseSize: service.ResponseSize.String(),
 		Steps:        steps,
 	}
+	for _, e := range service.Endpoints {
+		endpointSteps, endpointEdges, err := scriptToSteps(
+			e.Script, service.Name, e.Name)
+		if err != nil {
+			return Node{}, nil, err
+		}
+		n.Endpoints = append(n.Endpoints, Endpoint{
+			Name:  e.Name,
+			Label: endpointLabel(e),
+			Steps: endpointSteps,
+		})
+		edges = append(edges, endpointEdges...)
+	}
 	return n, edges, nil
 }
 
+// scriptToSteps describes each step of s, run by the endpoint of the service
+// named serviceName, or by the service itself if endpoint is empty, and the
+// edges of its calls.
+func scriptToSteps(
+	s script.Script,
+	serviceName string,
+	endpoint string) ([][]string, []Edge, error) {
+	steps := make([][]string, 0, len(s))
+	edges := make([]Edge, 0, len(s))
+	for idx, exe := range s {
+		step, err := executableToStringSlice(exe)
+		if err != nil {
+			return nil, nil, err
+		}
+		steps = append(steps, step)
+
+		stepEdges := getEdgesFromExe(exe, idx, serviceName, endpoint)
+		edges = append(edges, stepEdges...)
+	}
+	return steps, edges, nil
+}
+
+// endpointLabel describes e by its method, path and name, e.g.
+// "GET /users (users)". An endpoint accepting any method is marked "*".
+func endpointLabel(e svc.Endpoint) string {
+	method := e.Method
+	if method == "" {
+		method = "*"
+	}
+	s := fmt.Sprintf("%s %s (%s)", method, e.Path, e.Name)
+	if e.ResponseSize != nil {
+		s += fmt.Sprintf(" %s", e.ResponseSize)
+	}
+	return s
+}
+
+// errorRateToString describes the service's error rate, followed by the codes
+// and timing of its injected errors if set.
+func errorRateToString(service svc.Service) string {
+	s := service.ErrorRate.String()
+	errs := service.Errors
+	if errs == nil {
+		return s
+	}
+	if len(errs.Codes) > 0 {
+		codes := make([]string, 0, len(errs.Codes))
+		for _, c := range errs.Codes {
+			codes = append(codes, strconv.Itoa(c.Code))
+		}
+		s += fmt.Sprintf(" (%s)", strings.Join(codes, "/"))
+	}
+	switch {
+	case errs.Timing == fault.Before:
+		s += " before script"
+	case errs.AfterStep > 0:
+		s += fmt.Sprintf(" after step %d", errs.AfterStep)
+	}
+	return s
+}
+
 func nonConcurrentCommandToString(exe script.Command) (string, error) {
 	switch cmd := exe.(type) {
 	case script.SleepCommand:
 		return fmt.Sprintf("SLEEP %s", cmd), nil
+	case script.ComputeCommand:
+		return fmt.Sprintf("COMPUTE %s", cmd), nil
+	case script.AllocateCommand:
+		return fmt.Sprintf("ALLOCATE %s", cmd), nil
+	case script.StreamCommand:
+		return fmt.Sprintf("STREAM \"%s\" %s", cmd.ServiceName, cmd), nil
 	case script.RequestCommand:
-		return fmt.Sprintf(
-			"CALL \"%s\" %s",
-			cmd.ServiceName, cmd.Size.String()), nil
+		target := cmd.ServiceName
+		if cmd.Endpoint != "" {
+			target += "/" + cmd.Endpoint
+		}
+		s := fmt.Sprintf("CALL \"%s\" %s", target, cmd.Size.String())
+		if cmd.Method != "" {
+			s += fmt.Sprintf(" method=%s", cmd.Method)
+		}
+		if cmd.Path != nil {
+			s += fmt.Sprintf(" path=%s", cmd.Path)
+		}
+		if cmd.Protocol != "" {
+			s += fmt.Sprintf(" protocol=%s", cmd.Protocol)
+		}
+		if cmd.Connection != "" {
+			s += fmt.Sprintf(" connection=%s", cmd.Connection)
+		}
+		if cmd.ConnectionPool != nil {
+			if pool := cmd.ConnectionPool.String(); pool != "" {
+				s += fmt.Sprintf(" pool(%s)", pool)
+			}
+		}
+		if cmd.Timeout > 0 {
+			s += fmt.Sprintf(" timeout=%s", cmd.Timeout)
+		}
+		if cmd.Retries > 0 {
+			s += fmt.Sprintf(" retries=%d", cmd.Retries)
+		}
+		return s, nil
 	default:
 		return "", fmt.Errorf("unexpected type of executable %T", exe)
 	}
 }
 
 func executableToStringSlice(exe script.Command) ([]string, error) {
-	slice := make([]string, 0, 1)
-	appendNonConcurrentExe := func(exe script.Command) error {
-		s, err := nonConcurrentCommandToString(exe)
+	cmds := []script.Command{exe}
+	if cmd, ok := exe.(script.ConcurrentCommand); ok {
+		cmds = cmd.Commands
+	}
+	slice := make([]string, 0, len(cmds))
+	for _, cmd := range cmds {
+		lines, err := commandToStrings(cmd)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		slice = append(slice, s)
-		return nil
+		slice = append(slice, lines...)
 	}
+	return slice, nil
+}
 
+// commandToStrings describes cmd on the lines of a step: a line per
+// alternative of a OneOfCommand or case of a SwitchCommand, and a single line
+// otherwise.
+func commandToStrings(exe script.Command) ([]string, error) {
+	var s string
+	var err error
 	switch cmd := exe.(type) {
-	case script.SleepCommand:
-		if err := appendNonConcurrentExe(exe); err != nil {
+	case script.OneOfCommand:
+		return oneOfCommandToStrings(cmd)
+	case script.SwitchCommand:
+		return switchCommandToStrings(cmd)
+	case script.SequenceCommand:
+		s, err = scriptToString(cmd.Commands)
+	default:
+		s, err = commandToString(exe)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []string{s}, nil
+}
+
+// oneOfCommandToStrings describes each alternative of cmd on a line of its
+// own, prefixed by the chance it is picked, e.g. `70% CALL "a" 0B`.
+func oneOfCommandToStrings(cmd script.OneOfCommand) ([]string, error) {
+	lines := make([]string, 0, len(cmd.Alternatives))
+	for i, a := range cmd.Alternatives {
+		s, err := scriptToString(a.Script)
+		if err != nil {
 			return nil, err
 		}
-	case script.RequestCommand:
-		if err := appendNonConcurrentExe(exe); err != nil {
+		lines = append(lines, fmt.Sprintf("%.3g%% %s", cmd.Percentage(i), s))
+	}
+	return lines, nil
+}
+
+// switchCommandToStrings describes each case of cmd on a line of its own,
+// prefixed by its condition, e.g. `IF header X-Variant=canary: CALL "a" 0B`,
+// or by "ELSE" for the default case.
+func switchCommandToStrings(cmd script.SwitchCommand) ([]string, error) {
+	lines := make([]string, 0, len(cmd.Cases))
+	for _, c := range cmd.Cases {
+		s, err := scriptToString(c.Script)
+		if err != nil {
 			return nil, err
 		}
+		if c.When == nil {
+			lines = append(lines, fmt.Sprintf("ELSE: %s", s))
+		} else {
+			lines = append(lines, fmt.Sprintf("IF %s: %s", c.When, s))
+		}
+	}
+	return lines, nil
+}
+
+// scriptToString describes the commands of s on a single line, separated by
+// "; ". An empty script is "NOTHING".
+func scriptToString(s []script.Command) (string, error) {
+	if len(s) == 0 {
+		return "NOTHING", nil
+	}
+	parts := make([]string, 0, len(s))
+	for _, exe := range s {
+		part, err := commandToString(exe)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "; "), nil
+}
+
+// commandToString describes exe on a single line. Concurrent commands are
+// enclosed in brackets, sequences in parentheses, the alternatives of a
+// OneOfCommand in "ONEOF(...)" and the cases of a SwitchCommand in
+// "SWITCH(...)".
+func commandToString(exe script.Command) (string, error) {
+	switch cmd := exe.(type) {
 	case script.ConcurrentCommand:
-		for _, exe := range cmd {
-			if err := appendNonConcurrentExe(exe); err != nil {
-				return nil, err
+		parts := make([]string, 0, len(cmd.Commands))
+		for _, subCmd := range cmd.Commands {
+			part, err := commandToString(subCmd)
+			if err != nil {
+				return "", err
 			}
+			parts = append(parts, part)
 		}
+		return "[" + strings.Join(parts, ", ") + "]", nil
+	case script.SequenceCommand:
+		s, err := scriptToString(cmd.Commands)
+		if err != nil {
+			return "", err
+		}
+		return "(" + s + ")", nil
+	case script.RepeatCommand:
+		return repeatCommandToString(cmd)
+	case script.OneOfCommand:
+		lines, err := oneOfCommandToStrings(cmd)
+		if err != nil {
+			return "", err
+		}
+		return "ONEOF(" + strings.Join(lines, " | ") + ")", nil
+	case script.SwitchCommand:
+		lines, err := switchCommandToStrings(cmd)
+		if err != nil {
+			return "", err
+		}
+		return "SWITCH(" + strings.Join(lines, " | ") + ")", nil
 	default:
-		return nil, fmt.Errorf("unexpected type of executable %T", exe)
+		return nonConcurrentCommandToString(exe)
 	}
-	return slice, nil
+}
+
+// repeatCommandToString describes cmd by its count and options, followed by
+// its script, e.g. `REPEAT 20x concurrent maxParallelism=5 (CALL "a" 0B)`.
+func repeatCommandToString(cmd script.RepeatCommand) (string, error) {
+	s := fmt.Sprintf("REPEAT %dx", cmd.Count)
+	if cmd.Concurrent {
+		s += " concurrent"
+	}
+	if cmd.Policy != "" {
+		s += fmt.Sprintf(" policy=%s", cmd.Policy)
+	}
+	if cmd.MaxParallelism > 0 {
+		s += fmt.Sprintf(" maxParallelism=%d", cmd.MaxParallelism)
+	}
+	sub, err := scriptToString(cmd.Script)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s (%s)", s, sub), nil
 }
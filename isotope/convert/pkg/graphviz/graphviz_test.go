@@ -16,11 +16,17 @@ package graphviz
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/dist"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/duration"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/fault"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/headers"
 	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/script"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/size"
 	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/svc"
 	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/svctype"
 )
@@ -114,22 +120,22 @@ func TestServiceGraphToGraph(t *testing.T) {
 				Name:         "a",
 				Type:         svctype.ServiceHTTP,
 				ErrorRate:    0.0001,
-				ResponseSize: 10240,
+				ResponseSize: size.ConstantDistribution(10240),
 				Script: []script.Command{
-					script.SleepCommand(100 * time.Millisecond),
+					script.ConstantSleepCommand(100 * time.Millisecond),
 				},
 			},
 			{
 				Name:         "b",
 				Type:         svctype.ServiceGRPC,
 				ErrorRate:    0,
-				ResponseSize: 10240,
+				ResponseSize: size.ConstantDistribution(10240),
 			},
 			{
 				Name:         "c",
 				Type:         svctype.ServiceHTTP,
 				ErrorRate:    0,
-				ResponseSize: 10240,
+				ResponseSize: size.ConstantDistribution(10240),
 				Script: []script.Command{
 					script.RequestCommand{
 						ServiceName: "a",
@@ -145,19 +151,21 @@ func TestServiceGraphToGraph(t *testing.T) {
 				Name:         "d",
 				Type:         svctype.ServiceHTTP,
 				ErrorRate:    0,
-				ResponseSize: 10240,
+				ResponseSize: size.ConstantDistribution(10240),
 				Script: []script.Command{
-					script.ConcurrentCommand([]script.Command{
-						script.RequestCommand{
-							ServiceName: "a",
-							Size:        1024,
+					script.ConcurrentCommand{
+						Commands: []script.Command{
+							script.RequestCommand{
+								ServiceName: "a",
+								Size:        1024,
+							},
+							script.RequestCommand{
+								ServiceName: "c",
+								Size:        1024,
+							},
 						},
-						script.RequestCommand{
-							ServiceName: "c",
-							Size:        1024,
-						},
-					}),
-					script.SleepCommand(10 * time.Millisecond),
+					},
+					script.ConstantSleepCommand(10 * time.Millisecond),
 					script.RequestCommand{
 						ServiceName: "b",
 						Size:        1024,
@@ -175,6 +183,423 @@ func TestServiceGraphToGraph(t *testing.T) {
 	}
 }
 
+func TestServiceGraphToGraph_Endpoints(t *testing.T) {
+	expected := Graph{
+		Nodes: []Node{
+			{
+				Name:         "a",
+				Type:         "HTTP",
+				ErrorRate:    "0.00%",
+				ResponseSize: "10KiB",
+				Steps:        [][]string{},
+				Endpoints: []Endpoint{
+					{
+						Name:  "login",
+						Label: "POST /login (login) 1KiB",
+						Steps: [][]string{
+							{"CALL \"b\" 0B"},
+						},
+					},
+					{
+						Name:  "users",
+						Label: "* /api/users (users)",
+						Steps: [][]string{},
+					},
+				},
+			},
+			{
+				Name:         "b",
+				Type:         "HTTP",
+				ErrorRate:    "0.00%",
+				ResponseSize: "10KiB",
+				Steps: [][]string{
+					{"CALL \"a/users\" 0B"},
+				},
+			},
+		},
+		Edges: []Edge{
+			{From: "a", To: "b", StepIndex: 0, FromEndpoint: "login"},
+			{From: "b", To: "a", StepIndex: 0, ToEndpoint: "users"},
+		},
+	}
+
+	serviceGraph := graph.ServiceGraph{
+		Services: []svc.Service{
+			{
+				Name:         "a",
+				Type:         svctype.ServiceHTTP,
+				ResponseSize: size.ConstantDistribution(10240),
+				Endpoints: []svc.Endpoint{
+					{
+						Name:         "login",
+						Path:         "/login",
+						Method:       "POST",
+						ResponseSize: size.ConstantDistribution(1024),
+						Script: []script.Command{
+							script.RequestCommand{ServiceName: "b"},
+						},
+					},
+					{Name: "users", Path: "/api/users"},
+				},
+			},
+			{
+				Name:         "b",
+				Type:         svctype.ServiceHTTP,
+				ResponseSize: size.ConstantDistribution(10240),
+				Script: []script.Command{
+					script.RequestCommand{ServiceName: "a", Endpoint: "users"},
+				},
+			},
+		},
+	}
+	actual, err := ServiceGraphToGraph(serviceGraph)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !graphsAreEqual(expected, actual) {
+		t.Errorf("\nexpect: %+v, \nactual: %+v", expected, actual)
+	}
+
+	dotLang, err := GraphToDotLanguage(actual)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		`<TD PORT="endpoint-login"><B>POST /login (login) 1KiB</B></TD>`,
+		`<TD PORT="endpoint-login-0">CALL "b" 0B</TD>`,
+		`"a":"endpoint-login-0" -> "b"`,
+		`"b":0 -> "a":"endpoint-users"`,
+	} {
+		if !strings.Contains(dotLang, s) {
+			t.Errorf("expected %q in\n%s", s, dotLang)
+		}
+	}
+}
+
+func TestServiceGraphToGraph_OneOf(t *testing.T) {
+	expected := Graph{
+		Nodes: []Node{
+			{
+				Name:         "a",
+				Type:         "HTTP",
+				ErrorRate:    "0.00%",
+				ResponseSize: "0B",
+				Steps: [][]string{
+					{
+						"70% CALL \"b\" 0B",
+						"20% SLEEP 10ms; [CALL \"b\" 0B, CALL \"c\" 0B]",
+						"10% NOTHING",
+					},
+				},
+			},
+			{
+				Name:         "b",
+				Type:         "HTTP",
+				ErrorRate:    "0.00%",
+				ResponseSize: "0B",
+				Steps:        [][]string{},
+			},
+			{
+				Name:         "c",
+				Type:         "HTTP",
+				ErrorRate:    "0.00%",
+				ResponseSize: "0B",
+				Steps:        [][]string{},
+			},
+		},
+		Edges: []Edge{
+			{From: "a", To: "b", StepIndex: 0},
+			{From: "a", To: "b", StepIndex: 0},
+			{From: "a", To: "c", StepIndex: 0},
+		},
+	}
+
+	serviceGraph := graph.ServiceGraph{
+		Services: []svc.Service{
+			{
+				Name: "a",
+				Type: svctype.ServiceHTTP,
+				Script: []script.Command{
+					script.OneOfCommand{
+						Alternatives: []script.Alternative{
+							{
+								Weight: 7,
+								Script: script.Script{
+									script.RequestCommand{ServiceName: "b"},
+								},
+							},
+							{
+								Weight: 2,
+								Script: script.Script{
+									script.ConstantSleepCommand(10 * time.Millisecond),
+									script.ConcurrentCommand{
+										Commands: []script.Command{
+											script.RequestCommand{ServiceName: "b"},
+											script.RequestCommand{ServiceName: "c"},
+										},
+									},
+								},
+							},
+							{},
+						},
+					},
+				},
+			},
+			{Name: "b", Type: svctype.ServiceHTTP},
+			{Name: "c", Type: svctype.ServiceHTTP},
+		},
+	}
+	actual, err := ServiceGraphToGraph(serviceGraph)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !graphsAreEqual(expected, actual) {
+		t.Errorf("\nexpect: %+v, \nactual: %+v", expected, actual)
+	}
+}
+
+func TestErrorRateToString(t *testing.T) {
+	tests := []struct {
+		service svc.Service
+		s       string
+	}{
+		{svc.Service{ErrorRate: 0.1}, "10.00%"},
+		{
+			svc.Service{
+				ErrorRate: 0.1,
+				Errors: &fault.Injection{
+					Codes: []fault.Code{{Code: 503}, {Code: 429, Weight: 2}},
+				},
+			},
+			"10.00% (503/429)",
+		},
+		{
+			svc.Service{
+				ErrorRate: 0.1,
+				Errors:    &fault.Injection{Timing: fault.Before},
+			},
+			"10.00% before script",
+		},
+		{
+			svc.Service{
+				ErrorRate: 0.1,
+				Errors: &fault.Injection{
+					Codes:     []fault.Code{{Code: 500}},
+					AfterStep: 2,
+				},
+			},
+			"10.00% (500) after step 2",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			s := errorRateToString(test.service)
+			if test.s != s {
+				t.Errorf("expected %v; actual %v", test.s, s)
+			}
+		})
+	}
+}
+
+func TestNonConcurrentCommandToString(t *testing.T) {
+	path, err := headers.NewTemplate("/users")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		command script.Command
+		s       string
+	}{
+		{script.ConstantSleepCommand(10 * time.Millisecond), "SLEEP 10ms"},
+		{
+			script.SleepCommand{Duration: dist.Distribution{
+				Type: dist.Uniform,
+				Min:  float64(5 * time.Millisecond),
+				Max:  float64(15 * time.Millisecond),
+			}},
+			"SLEEP uniform(min=5ms, max=15ms)",
+		},
+		{
+			script.RequestCommand{ServiceName: "a", Size: 1024},
+			"CALL \"a\" 1KiB",
+		},
+		{
+			script.RequestCommand{
+				ServiceName: "a",
+				Size:        1024,
+				Timeout:     duration.Duration(time.Second),
+				Retries:     2,
+			},
+			"CALL \"a\" 1KiB timeout=1s retries=2",
+		},
+		{
+			script.RequestCommand{
+				ServiceName: "a",
+				Size:        1024,
+				Method:      "POST",
+				Path:        &path,
+				Protocol:    script.ProtocolH2C,
+			},
+			"CALL \"a\" 1KiB method=POST path=/users protocol=h2c",
+		},
+		{
+			script.RequestCommand{ServiceName: "a", Endpoint: "login", Size: 1024},
+			"CALL \"a/login\" 1KiB",
+		},
+		{
+			script.RequestCommand{
+				ServiceName: "a",
+				Size:        1024,
+				Connection:  script.ConnectionNew,
+			},
+			"CALL \"a\" 1KiB connection=new",
+		},
+		{
+			script.RequestCommand{
+				ServiceName: "a",
+				Size:        1024,
+				ConnectionPool: &script.ConnectionPool{
+					MaxIdle:        10,
+					ConnectTimeout: duration.Duration(time.Second),
+				},
+			},
+			"CALL \"a\" 1KiB pool(maxIdle=10 connectTimeout=1s)",
+		},
+		{
+			script.RequestCommand{
+				ServiceName:    "a",
+				Size:           1024,
+				ConnectionPool: &script.ConnectionPool{KeepAlive: new(bool)},
+			},
+			"CALL \"a\" 1KiB pool(keepAlive=false)",
+		},
+		{
+			script.ComputeCommand{Duration: duration.Duration(5 * time.Millisecond)},
+			"COMPUTE 5ms",
+		},
+		{script.ComputeCommand{Iterations: 1000}, "COMPUTE 1000 iterations"},
+		{script.AllocateCommand{Size: 1048576}, "ALLOCATE 1MiB"},
+		{
+			script.StreamCommand{
+				ServiceName: "a",
+				Mode:        script.StreamSSE,
+				Messages:    10,
+				Interval:    duration.Duration(time.Second),
+				MessageSize: 1024,
+			},
+			"STREAM \"a\" 10x1KiB every 1s mode=sse",
+		},
+		{
+			script.StreamCommand{ServiceName: "a", Messages: 3},
+			"STREAM \"a\" 3x0B mode=chunked",
+		},
+		{
+			script.AllocateCommand{Size: 1048576, Retain: true},
+			"ALLOCATE 1MiB retained",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			s, err := nonConcurrentCommandToString(test.command)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.s != s {
+				t.Errorf("expected %v; actual %v", test.s, s)
+			}
+		})
+	}
+}
+
+func TestExecutableToStringSlice(t *testing.T) {
+	a := script.RequestCommand{ServiceName: "a"}
+	b := script.RequestCommand{ServiceName: "b"}
+	tests := []struct {
+		command script.Command
+		slice   []string
+	}{
+		{
+			script.RepeatCommand{
+				Count:          20,
+				Concurrent:     true,
+				MaxParallelism: 5,
+				Script:         script.Script{a},
+			},
+			[]string{`REPEAT 20x concurrent maxParallelism=5 (CALL "a" 0B)`},
+		},
+		{
+			script.SequenceCommand{Commands: []script.Command{a, b}},
+			[]string{`CALL "a" 0B; CALL "b" 0B`},
+		},
+		{
+			script.ConcurrentCommand{
+				Commands: []script.Command{
+					script.ConcurrentCommand{
+						Commands: []script.Command{a, b},
+					},
+					script.SequenceCommand{
+						Commands: []script.Command{
+							script.ConstantSleepCommand(10 * time.Millisecond),
+							script.RepeatCommand{Count: 2, Script: script.Script{a, b}},
+						},
+					},
+				},
+			},
+			[]string{
+				`[CALL "a" 0B, CALL "b" 0B]`,
+				`SLEEP 10ms; REPEAT 2x (CALL "a" 0B; CALL "b" 0B)`,
+			},
+		},
+		{
+			script.SwitchCommand{
+				Cases: []script.Case{
+					{
+						When: &script.Condition{
+							Header: "X-Variant",
+							Equals: "canary",
+						},
+						Script: script.Script{b},
+					},
+					{
+						When:   &script.Condition{PathPrefix: "/api/"},
+						Script: script.Script{},
+					},
+					{Script: script.Script{a}},
+				},
+			},
+			[]string{
+				`IF header X-Variant=canary: CALL "b" 0B`,
+				`IF path prefix /api/: NOTHING`,
+				`ELSE: CALL "a" 0B`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			slice, err := executableToStringSlice(test.command)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(test.slice, slice) {
+				t.Errorf("expected %v; actual %v", test.slice, slice)
+			}
+		})
+	}
+}
+
 func graphsAreEqual(left Graph, right Graph) bool {
 	return reflect.DeepEqual(left, right)
 }
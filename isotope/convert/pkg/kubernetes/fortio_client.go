@@ -25,9 +25,12 @@ import (
 
 var fortioClientLabels = map[string]string{"app": "client"}
 
+// makeFortioDeployment makes the load testing client. If useTLS is set, the
+// client's certificate is mounted in consts.TLSPath.
 func makeFortioDeployment(
 	nodeSelector map[string]string,
-	clientImage string) (deployment appsv1.Deployment) {
+	clientImage string,
+	useTLS bool) (deployment appsv1.Deployment) {
 	deployment.APIVersion = "apps/v1"
 	deployment.Kind = "Deployment"
 	deployment.ObjectMeta.Name = "client"
@@ -61,6 +64,9 @@ func makeFortioDeployment(
 			},
 		},
 	}
+	if useTLS {
+		addTLSVolume(&deployment.Spec.Template.Spec, clientTLSSecretName)
+	}
 	timestamp(&deployment.Spec.Template.ObjectMeta)
 	return
 }
@@ -18,6 +18,7 @@ package kubernetes
 import (
 	"fmt"
 	"math/rand"
+	"strconv"
 	"strings"
 	"time"
 
@@ -25,10 +26,13 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	apiv1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 
 	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/consts"
 	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph"
 	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/svc"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/svctype"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/pki"
 )
 
 const (
@@ -41,6 +45,10 @@ const (
 
 	configVolume           = "config-volume"
 	serviceGraphConfigName = "service-graph-config"
+
+	// defaultTerminationGracePeriod is the termination grace period of pods
+	// in Kubernetes, which services get on top of their drain period.
+	defaultTerminationGracePeriod = 30 * time.Second
 )
 
 var (
@@ -51,12 +59,20 @@ var (
 )
 
 // ServiceGraphToKubernetesManifests converts a ServiceGraph to Kubernetes
-// manifests.
+// manifests. In the "TLS" and "MTLS" environments, services serve and call
+// each other over TLS and mutual TLS, with certificates issued by a CA
+// generated for the manifests. If serviceDrainPeriod is set, services keep
+// serving for that long after being asked to terminate; if
+// serviceReadinessDownstream is set, they are only ready while the services
+// they call can be connected to.
 func ServiceGraphToKubernetesManifests(
 	serviceGraph graph.ServiceGraph,
 	serviceNodeSelector map[string]string,
 	serviceImage string,
 	serviceMaxIdleConnectionsPerHost int,
+	serviceOTLPEndpoint string,
+	serviceDrainPeriod time.Duration,
+	serviceReadinessDownstream bool,
 	clientNodeSelector map[string]string,
 	clientImage string,
 	environmentName string) ([]byte, error) {
@@ -86,12 +102,34 @@ func ServiceGraphToKubernetesManifests(
 		return nil, err
 	}
 
+	tlsMode := tlsModeForEnvironment(environmentName)
+	var ca *pki.CA
+	if tlsMode != "" {
+		ca, err = pki.NewCA(tlsCACommonName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	rand.Seed(time.Now().UTC().UnixNano())
 	hasRbacPolicy := false
 	for _, service := range serviceGraph.Services {
+		if ca != nil {
+			secret, innerErr := makeTLSSecret(
+				ca, service.Name, ServiceGraphNamespace,
+				pki.ServiceDNSNames(service.Name, ServiceGraphNamespace))
+			if innerErr != nil {
+				return nil, innerErr
+			}
+			if innerErr := appendManifest(secret); innerErr != nil {
+				return nil, innerErr
+			}
+		}
+
 		k8sDeployment := makeDeployment(
 			service, serviceNodeSelector, serviceImage,
-			serviceMaxIdleConnectionsPerHost)
+			serviceMaxIdleConnectionsPerHost, serviceOTLPEndpoint,
+			serviceDrainPeriod, serviceReadinessDownstream, tlsMode)
 		innerErr := appendManifest(k8sDeployment)
 		if innerErr != nil {
 			return nil, innerErr
@@ -116,8 +154,19 @@ func ServiceGraphToKubernetesManifests(
 		}
 	}
 
+	if ca != nil {
+		secret, err := makeTLSSecret(
+			ca, clientTLSCommonName, "", []string{clientTLSCommonName})
+		if err != nil {
+			return nil, err
+		}
+		if err := appendManifest(secret); err != nil {
+			return nil, err
+		}
+	}
+
 	fortioDeployment := makeFortioDeployment(
-		clientNodeSelector, clientImage)
+		clientNodeSelector, clientImage, ca != nil)
 	if err := appendManifest(fortioDeployment); err != nil {
 		return nil, err
 	}
@@ -180,15 +229,62 @@ func makeService(service svc.Service) (k8sService apiv1.Service) {
 	k8sService.ObjectMeta.Namespace = ServiceGraphNamespace
 	k8sService.ObjectMeta.Labels = serviceGraphAppLabels
 	timestamp(&k8sService.ObjectMeta)
-	k8sService.Spec.Ports = []apiv1.ServicePort{{Port: consts.ServicePort, Name: consts.ServicePortName}}
+	k8sService.Spec.Ports = []apiv1.ServicePort{{Port: consts.ServicePort, Name: servicePortName(service)}}
 	k8sService.Spec.Selector = map[string]string{"name": service.Name}
 	return
 }
 
+// servicePortName names the service port after the protocol of service so
+// that Istio can detect it.
+func servicePortName(service svc.Service) string {
+	switch service.Type {
+	case svctype.ServiceGRPC:
+		return consts.ServiceGRPCPortName
+	case svctype.ServiceTCP:
+		return consts.ServiceTCPPortName
+	default:
+		return consts.ServicePortName
+	}
+}
+
+// prometheusAnnotations returns the annotations which let Prometheus scrape
+// the pods of service. TCP services expose their metrics on the admin port, as
+// their service port does not speak HTTP.
+func prometheusAnnotations(service svc.Service) map[string]string {
+	if service.Type != svctype.ServiceTCP {
+		return prometheusScrapeAnnotations
+	}
+	return combineLabels(prometheusScrapeAnnotations, map[string]string{
+		"prometheus.io/port": strconv.Itoa(consts.AdminPort),
+	})
+}
+
 func makeDeployment(
 	service svc.Service, nodeSelector map[string]string,
-	serviceImage string, serviceMaxIdleConnectionsPerHost int) (
+	serviceImage string, serviceMaxIdleConnectionsPerHost int,
+	serviceOTLPEndpoint string, serviceDrainPeriod time.Duration,
+	serviceReadinessDownstream bool, tlsMode string) (
 	k8sDeployment appsv1.Deployment) {
+	args := []string{
+		fmt.Sprintf(
+			"--max-idle-connections-per-host=%v",
+			serviceMaxIdleConnectionsPerHost),
+	}
+	if serviceOTLPEndpoint != "" {
+		args = append(args,
+			fmt.Sprintf("--otlp-endpoint=%s", serviceOTLPEndpoint))
+	}
+	if serviceDrainPeriod > 0 {
+		args = append(args,
+			fmt.Sprintf("--drain-period=%s", serviceDrainPeriod))
+	}
+	if serviceReadinessDownstream {
+		args = append(args, "--readiness-downstream")
+	}
+	if tlsMode != "" {
+		args = append(args, fmt.Sprintf("--tls-mode=%s", tlsMode))
+	}
+
 	k8sDeployment.APIVersion = "apps/v1"
 	k8sDeployment.Kind = "Deployment"
 	k8sDeployment.ObjectMeta.Name = service.Name
@@ -209,7 +305,7 @@ func makeDeployment(
 					map[string]string{
 						"name": service.Name,
 					}),
-				Annotations: prometheusScrapeAnnotations,
+				Annotations: prometheusAnnotations(service),
 			},
 			Spec: apiv1.PodSpec{
 				NodeSelector: nodeSelector,
@@ -217,11 +313,7 @@ func makeDeployment(
 					{
 						Name:  consts.ServiceContainerName,
 						Image: serviceImage,
-						Args: []string{
-							fmt.Sprintf(
-								"--max-idle-connections-per-host=%v",
-								serviceMaxIdleConnectionsPerHost),
-						},
+						Args:  args,
 						Env: []apiv1.EnvVar{
 							{Name: consts.ServiceNameEnvKey, Value: service.Name},
 						},
@@ -235,7 +327,13 @@ func makeDeployment(
 							{
 								ContainerPort: consts.ServicePort,
 							},
+							{
+								Name:          consts.AdminPortName,
+								ContainerPort: consts.AdminPort,
+							},
 						},
+						LivenessProbe:  adminProbe("/healthz", 10),
+						ReadinessProbe: adminProbe("/readyz", 2),
 					},
 				},
 				Volumes: []apiv1.Volume{
@@ -259,10 +357,38 @@ func makeDeployment(
 			},
 		},
 	}
+	if serviceDrainPeriod > 0 {
+		// Keep the default time for the requests being served after the
+		// drain period.
+		gracePeriod := int64(
+			(serviceDrainPeriod + defaultTerminationGracePeriod + time.Second - 1) /
+				time.Second)
+		k8sDeployment.Spec.Template.Spec.TerminationGracePeriodSeconds =
+			&gracePeriod
+	}
+	if tlsMode != "" {
+		addTLSVolume(
+			&k8sDeployment.Spec.Template.Spec, service.Name+tlsSecretSuffix)
+	}
 	timestamp(&k8sDeployment.Spec.Template.ObjectMeta)
 	return
 }
 
+// adminProbe probes path on the admin port of the service, which is served
+// over plaintext whatever the TLS mode, every periodSeconds. Readiness is
+// probed often, so that draining services stop getting requests quickly.
+func adminProbe(path string, periodSeconds int32) *apiv1.Probe {
+	return &apiv1.Probe{
+		Handler: apiv1.Handler{
+			HTTPGet: &apiv1.HTTPGetAction{
+				Path: path,
+				Port: intstr.FromString(consts.AdminPortName),
+			},
+		},
+		PeriodSeconds: periodSeconds,
+	}
+}
+
 func timestamp(objectMeta *metav1.ObjectMeta) {
 	objectMeta.CreationTimestamp = metav1.Time{Time: time.Now()}
 }
@@ -0,0 +1,89 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubernetes
+
+import (
+	"strings"
+
+	apiv1 "k8s.io/api/core/v1"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/consts"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/pki"
+)
+
+const (
+	tlsVolume            = "tls-volume"
+	tlsSecretSuffix      = "-tls"
+	clientTLSSecretName  = "client" + tlsSecretSuffix
+	tlsCACommonName      = "isotope"
+	clientTLSCommonName  = "client"
+	tlsModeSimple        = "tls"
+	tlsModeMutual        = "mtls"
+	tlsEnvironmentSimple = "TLS"
+	tlsEnvironmentMutual = "MTLS"
+)
+
+// tlsModeForEnvironment returns the TLS mode of services in the environment
+// named environmentName, or "" if they do not use TLS.
+func tlsModeForEnvironment(environmentName string) string {
+	switch strings.ToUpper(environmentName) {
+	case tlsEnvironmentSimple:
+		return tlsModeSimple
+	case tlsEnvironmentMutual:
+		return tlsModeMutual
+	default:
+		return ""
+	}
+}
+
+// makeTLSSecret issues a certificate for name, valid for dnsNames, and
+// returns it in a Secret alongside the certificate of ca.
+func makeTLSSecret(
+	ca *pki.CA, name string, namespace string, dnsNames []string) (
+	secret apiv1.Secret, err error) {
+	certPEM, keyPEM, err := ca.Issue(name, dnsNames)
+	if err != nil {
+		return
+	}
+	secret.APIVersion = "v1"
+	secret.Kind = "Secret"
+	secret.ObjectMeta.Name = name + tlsSecretSuffix
+	secret.ObjectMeta.Namespace = namespace
+	timestamp(&secret.ObjectMeta)
+	secret.Type = apiv1.SecretTypeTLS
+	secret.Data = map[string][]byte{
+		consts.TLSCertFileName: certPEM,
+		consts.TLSKeyFileName:  keyPEM,
+		consts.TLSCAFileName:   ca.CertPEM,
+	}
+	return
+}
+
+// addTLSVolume mounts the Secret secretName in consts.TLSPath of the first
+// container of podSpec.
+func addTLSVolume(podSpec *apiv1.PodSpec, secretName string) {
+	podSpec.Volumes = append(podSpec.Volumes, apiv1.Volume{
+		Name: tlsVolume,
+		VolumeSource: apiv1.VolumeSource{
+			Secret: &apiv1.SecretVolumeSource{SecretName: secretName},
+		},
+	})
+	container := &podSpec.Containers[0]
+	container.VolumeMounts = append(container.VolumeMounts, apiv1.VolumeMount{
+		Name:      tlsVolume,
+		MountPath: consts.TLSPath,
+		ReadOnly:  true,
+	})
+}
@@ -0,0 +1,80 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pki
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"reflect"
+	"testing"
+)
+
+func TestCA_Issue(t *testing.T) {
+	t.Parallel()
+
+	ca, err := NewCA("isotope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, keyPEM, err := ca.Issue("a", ServiceDNSNames("a", "service-graph"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyPair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(ca.CertPEM) {
+		t.Fatal("expected CA certificate to be valid PEM")
+	}
+	for _, name := range []string{"a", "a.service-graph.svc.cluster.local"} {
+		for _, usage := range []x509.ExtKeyUsage{
+			x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth} {
+			_, err := cert.Verify(x509.VerifyOptions{
+				DNSName:   name,
+				Roots:     roots,
+				KeyUsages: []x509.ExtKeyUsage{usage},
+			})
+			if err != nil {
+				t.Errorf("expected certificate to be valid for %s: %s", name, err)
+			}
+		}
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{DNSName: "b", Roots: roots}); err == nil {
+		t.Error("expected certificate to be invalid for b")
+	}
+}
+
+func TestServiceDNSNames(t *testing.T) {
+	t.Parallel()
+
+	expected := []string{
+		"a",
+		"a.service-graph",
+		"a.service-graph.svc",
+		"a.service-graph.svc.cluster.local",
+	}
+	actual := ServiceDNSNames("a", "service-graph")
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %v; actual %v", expected, actual)
+	}
+}
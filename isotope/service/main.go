@@ -15,18 +15,33 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"path"
 	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
 
 	"istio.io/pkg/log"
 
 	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/consts"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/duration"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/svctype"
+	"github.com/kristofgyuracz/istio-tools/isotope/service/pkg/pb"
 	"github.com/kristofgyuracz/istio-tools/isotope/service/pkg/srv"
 	"github.com/kristofgyuracz/istio-tools/isotope/service/pkg/srv/prometheus"
+	"github.com/kristofgyuracz/istio-tools/isotope/service/pkg/srv/tracing"
 )
 
 const (
@@ -42,9 +57,72 @@ var (
 	maxIdleConnectionsPerHostFlag = flag.Int(
 		"max-idle-connections-per-host", 0,
 		"maximum number of TCP connections to keep open per host")
+
+	tlsModeFlag = flag.String(
+		"tls-mode", string(srv.TLSModeDisabled),
+		`whether to serve and call other services over TLS: "disabled", `+
+			`"tls" or "mtls"`)
+	tlsDirFlag = flag.String(
+		"tls-dir", consts.TLSPath,
+		"directory of the TLS certificate, key and CA certificate; "+
+			"a certificate is issued in-process if it has none")
+
+	latencyBucketsFlag = flag.String(
+		"latency-buckets", "",
+		"comma-separated upper bounds of the buckets of duration histograms, "+
+			`e.g. "1ms,10ms,100ms"; overrides the service's latencyBuckets`)
+
+	adminPortFlag = flag.Int(
+		"admin-port", consts.AdminPort,
+		"port of the probes (/healthz, /readyz) and debug endpoints "+
+			"(/debug/...); 0 disables them")
+
+	configPollIntervalFlag = flag.Duration(
+		"config-poll-interval", 5*time.Second,
+		"how often to check the service graph file for changes to reload; "+
+			"0 disables reloading")
+
+	otlpEndpointFlag = flag.String(
+		"otlp-endpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"),
+		"OTLP/HTTP endpoint of the collector to export spans to; "+
+			"tracing is disabled if empty")
+
+	drainPeriodFlag = flag.Duration(
+		"drain-period", 5*time.Second,
+		"how long to keep serving after SIGTERM while failing readiness, "+
+			"before shutting down")
+	shutdownTimeoutFlag = flag.Duration(
+		"shutdown-timeout", 20*time.Second,
+		"how long to wait for the requests being served after the drain period")
+	accessLogFlag = flag.String(
+		"access-log", "",
+		`file to append JSON access logs of requests and calls to, or "-" `+
+			"for stdout; access logs are disabled if empty")
+	accessLogLevelFlag = flag.String(
+		"access-log-level", string(srv.AccessLogInfo),
+		`lowest level of the access log entries: "info" (all) or "error" `+
+			"(failed requests and calls only)")
+	accessLogSamplingFlag = flag.Float64(
+		"access-log-sampling", 1,
+		"fraction of the successful requests and calls which are logged, "+
+			"from 0 to 1; failed ones are always logged")
+
+	readinessDownstreamFlag = flag.Bool(
+		"readiness-downstream", false,
+		"whether readiness requires a connection to each service the "+
+			"service's scripts call")
 )
 
+// server is a server of the service which is shut down gracefully.
+type server interface {
+	Shutdown(ctx context.Context) error
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == simulateCommand {
+		simulate(os.Args[2:])
+		return
+	}
 	flag.Parse()
 
 	setMaxProcs()
@@ -55,31 +133,340 @@ func main() {
 		log.Fatalf(`env var "%s" is not set`, consts.ServiceNameEnvKey)
 	}
 
-	defaultHandler, err := srv.HandlerFromServiceGraphYAML(
-		serviceGraphYAMLFilePath, serviceName)
+	if *accessLogFlag != "" {
+		accessLog, err := openAccessLog(
+			*accessLogFlag, *accessLogLevelFlag, *accessLogSamplingFlag)
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+		srv.UseAccessLog(accessLog)
+	}
+
+	var (
+		tracer   *tracing.Tracer
+		exporter *tracing.OTLPExporter
+	)
+	if *otlpEndpointFlag != "" {
+		log.Infof(`exporting spans to "%s"`, *otlpEndpointFlag)
+		exporter = tracing.NewOTLPExporter(*otlpEndpointFlag, serviceName)
+		tracer = tracing.NewTracer(exporter)
+	}
+
+	defaultHandler, err := srv.NewReloadingHandler(
+		serviceGraphYAMLFilePath, serviceName, tracer)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	if *configPollIntervalFlag > 0 {
+		go defaultHandler.Watch(context.Background(), *configPollIntervalFlag)
+	}
+
+	serverTLSConfig, clientTLSConfig, err := srv.TLSConfigs(
+		srv.TLSMode(*tlsModeFlag), *tlsDirFlag, serviceName)
 	if err != nil {
 		log.Fatalf("%s", err)
 	}
+	if clientTLSConfig != nil {
+		srv.UseClientTLS(clientTLSConfig)
+	}
 
-	err = serveWithPrometheus(defaultHandler)
+	latencyBuckets, err := parseLatencyBuckets(*latencyBucketsFlag)
 	if err != nil {
 		log.Fatalf("%s", err)
 	}
+	if latencyBuckets == nil {
+		latencyBuckets = defaultHandler.Handler().Service.LatencyBuckets
+	}
+	promHandler := prometheus.Handler(durationBuckets(latencyBuckets))
+
+	health := srv.NewHealth(defaultHandler, *readinessDownstreamFlag)
+	adminHandler := srv.AdminHandler(defaultHandler, health)
+	isTCP := defaultHandler.Handler().Service.Type == svctype.ServiceTCP
+	if isTCP {
+		// The service port of TCP services does not speak HTTP, so their
+		// Prometheus endpoint is served alongside the debug endpoints.
+		adminHandler = withPrometheus(adminHandler, promHandler)
+	}
+	if *adminPortFlag > 0 {
+		go serveAdmin(adminHandler, *adminPortFlag)
+	} else if isTCP {
+		log.Warnf("the Prometheus endpoint is not exposed without an admin port")
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+
+	serveErrs := make(chan error, 1)
+	var s server
+	if isTCP {
+		s, err = serveTCP(defaultHandler, serverTLSConfig, serveErrs)
+	} else {
+		s, err = serveWithPrometheus(
+			defaultHandler, serverTLSConfig, promHandler, serveErrs)
+	}
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	health.SetReady(true)
+
+	select {
+	case err := <-serveErrs:
+		log.Fatalf("%s", err)
+	case sig := <-signals:
+		log.Infof("received %s, draining for %s", sig, *drainPeriodFlag)
+	}
+	health.SetReady(false)
+	shutdown(s, signals, *drainPeriodFlag, *shutdownTimeoutFlag)
+
+	if exporter != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := exporter.Shutdown(ctx); err != nil {
+			log.Warnf("exporting spans: %s", err)
+		}
+	}
+	log.Infof("shut down")
 }
 
-func serveWithPrometheus(defaultHandler http.Handler) error {
+// shutdown keeps s serving for drainPeriod, while the service fails
+// readiness, so that it is removed from the endpoints of its Kubernetes
+// service before it stops accepting connections. It then shuts s down and
+// waits for the requests being served, for up to timeout. Another signal
+// skips the drain period.
+func shutdown(
+	s server, signals <-chan os.Signal, drainPeriod, timeout time.Duration) {
+	if httpServer, ok := s.(*drainingHTTPServer); ok {
+		httpServer.drain()
+	}
+	select {
+	case <-time.After(drainPeriod):
+	case sig := <-signals:
+		log.Infof("received %s, skipping the drain period", sig)
+	}
+
+	log.Infof("shutting down, waiting up to %s for requests", timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		log.Warnf("shutting down: %s", err)
+	}
+	if err := srv.WaitIdle(ctx); err != nil {
+		log.Warnf("waiting for requests: %s", err)
+	}
+}
+
+// openAccessLog opens the access log at path, or on stdout if path is "-",
+// writing the entries at level or above, and a sampling fraction of the
+// successful ones.
+func openAccessLog(
+	path string, level string, sampling float64) (*srv.AccessLog, error) {
+	accessLogLevel, err := srv.ParseAccessLogLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	if sampling < 0 || sampling > 1 {
+		return nil, fmt.Errorf(
+			"access log sampling must be between 0 and 1: %v", sampling)
+	}
+	w := os.Stdout
+	if path != "-" {
+		w, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return srv.NewAccessLog(w, accessLogLevel, sampling), nil
+}
+
+// durationBuckets converts latencyBuckets to the buckets of Prometheus
+// duration histograms, in seconds.
+func durationBuckets(latencyBuckets []duration.Duration) []float64 {
+	buckets := make([]float64, 0, len(latencyBuckets))
+	for _, bucket := range latencyBuckets {
+		buckets = append(buckets, time.Duration(bucket).Seconds())
+	}
+	return buckets
+}
+
+// drainingHTTPServer is an http.Server whose connections can be drained, so
+// that clients reconnect to other replicas, before it shuts down. It serves
+// HTTP/2, h2c included, with its own http2.Server, since http.Server neither
+// tracks h2c connections nor tells HTTP/2 clients to go away until it shuts
+// down.
+type drainingHTTPServer struct {
+	*http.Server
+	// h2Hooks holds the shutdown hooks of the http2.Server, which send GOAWAY
+	// on each of its connections. It has no listeners of its own, so shutting
+	// it down only runs them.
+	h2Hooks *http.Server
+}
+
+// newDrainingHTTPServer returns a server of handler, over TLS if tlsConfig is
+// set, or else over plaintext with h2c alongside HTTP/1.1.
+func newDrainingHTTPServer(
+	handler http.Handler, tlsConfig *tls.Config) (*drainingHTTPServer, error) {
+	h2Server := &http2.Server{}
+	h2Hooks := &http.Server{}
+	if err := http2.ConfigureServer(h2Hooks, h2Server); err != nil {
+		return nil, err
+	}
+	server := &http.Server{Handler: handler}
+	if tlsConfig == nil {
+		// Accept HTTP/2 over plaintext (h2c) alongside HTTP/1.1.
+		server.Handler = h2c.NewHandler(handler, h2Server)
+	} else {
+		// Negotiate HTTP/2 with h2Server rather than the one of net/http.
+		server.TLSConfig = tlsConfig.Clone()
+		server.TLSConfig.NextProtos = append(
+			[]string{http2.NextProtoTLS}, server.TLSConfig.NextProtos...)
+		server.TLSNextProto = h2Hooks.TLSNextProto
+	}
+	return &drainingHTTPServer{Server: server, h2Hooks: h2Hooks}, nil
+}
+
+// drain closes each HTTP/1.1 connection after its next response, and sends
+// GOAWAY on each HTTP/2 connection, which closes once its requests complete.
+func (s *drainingHTTPServer) drain() {
+	s.SetKeepAlivesEnabled(false)
+	_ = s.h2Hooks.Shutdown(context.Background())
+}
+
+// Shutdown drains the connections opened since drain, then shuts the server
+// down like http.Server. It does not wait for the requests of HTTP/2
+// connections, which http.Server does not track.
+func (s *drainingHTTPServer) Shutdown(ctx context.Context) error {
+	s.drain()
+	return s.Server.Shutdown(ctx)
+}
+
+// serveWithPrometheus serves defaultHandler and promHandler, the Prometheus
+// endpoint, over TLS if tlsConfig is set, in the background once listening.
+// Errors serving are sent to errs.
+func serveWithPrometheus(
+	defaultHandler *srv.ReloadingHandler,
+	tlsConfig *tls.Config,
+	promHandler http.Handler,
+	errs chan<- error) (*drainingHTTPServer, error) {
+	mux := withPrometheus(nil, promHandler)
+
+	var handler http.Handler = mux
+	switch defaultHandler.Handler().Service.Type {
+	case svctype.ServiceGRPC:
+		log.Infof(`exposing gRPC service "isotope.Isotope"`)
+		handler = withGRPC(defaultHandler, mux)
+	default:
+		log.Infof(`exposing default endpoint "%s"`, defaultEndpoint)
+		mux.Handle(defaultEndpoint, defaultHandler)
+	}
+	server, err := newDrainingHTTPServer(handler, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", consts.ServicePort))
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		var err error
+		if tlsConfig != nil {
+			log.Infof("listening with TLS on port %v\n", consts.ServicePort)
+			err = server.ServeTLS(listener, "", "")
+		} else {
+			log.Infof("listening on port %v\n", consts.ServicePort)
+			err = server.Serve(listener)
+		}
+		if err != http.ErrServerClosed {
+			errs <- err
+		}
+	}()
+	return server, nil
+}
+
+// serveTCP serves the framed protocol of TCP services with defaultHandler,
+// over TLS if tlsConfig is set, in the background once listening. Errors
+// serving are sent to errs.
+func serveTCP(
+	defaultHandler *srv.ReloadingHandler,
+	tlsConfig *tls.Config,
+	errs chan<- error) (*srv.TCPServer, error) {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", consts.ServicePort))
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+		log.Infof("listening for TCP with TLS on port %v\n", consts.ServicePort)
+	} else {
+		log.Infof("listening for TCP on port %v\n", consts.ServicePort)
+	}
+	server := &srv.TCPServer{Handler: defaultHandler}
+	go func() {
+		if err := server.Serve(listener); err != srv.ErrTCPServerClosed {
+			errs <- err
+		}
+	}()
+	return server, nil
+}
+
+// withPrometheus serves promHandler on the Prometheus endpoint alongside
+// handler, if set, on any other path.
+func withPrometheus(handler http.Handler, promHandler http.Handler) *http.ServeMux {
+	mux := http.NewServeMux()
 	log.Infof(`exposing Prometheus endpoint "%s"`, promEndpoint)
-	http.Handle(promEndpoint, prometheus.Handler())
+	mux.Handle(promEndpoint, promHandler)
+	if handler != nil {
+		mux.Handle("/", handler)
+	}
+	return mux
+}
 
-	log.Infof(`exposing default endpoint "%s"`, defaultEndpoint)
-	http.Handle(defaultEndpoint, defaultHandler)
+// serveAdmin serves adminHandler, the probes and debug endpoints, over
+// plaintext on port, so that they stay reachable by the kubelet and with
+// kubectl port-forward whatever the TLS mode. The service keeps running if
+// they fail.
+func serveAdmin(adminHandler http.Handler, port int) {
+	log.Infof("exposing debug endpoints on port %v", port)
+	err := http.ListenAndServe(fmt.Sprintf(":%d", port), adminHandler)
+	log.Errorf("debug endpoints: %s", err)
+}
 
-	addr := fmt.Sprintf(":%d", consts.ServicePort)
-	log.Infof("listening on port %v\n", consts.ServicePort)
-	if err := http.ListenAndServe(addr, nil); err != nil {
-		return err
+// withGRPC serves the Isotope gRPC service with defaultHandler alongside
+// httpHandler on the same port, so that the Prometheus endpoint stays
+// reachable. gRPC requests are told apart by their protocol and content type.
+func withGRPC(
+	defaultHandler *srv.ReloadingHandler, httpHandler http.Handler) http.Handler {
+	grpcServer := grpc.NewServer()
+	pb.RegisterIsotopeServer(grpcServer, defaultHandler)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		isGRPC := r.ProtoMajor == 2 &&
+			strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+		if isGRPC {
+			grpcServer.ServeHTTP(w, r)
+		} else {
+			httpHandler.ServeHTTP(w, r)
+		}
+	})
+}
+
+// parseLatencyBuckets parses comma-separated durations, or returns nil if s is
+// empty.
+func parseLatencyBuckets(s string) ([]duration.Duration, error) {
+	if s == "" {
+		return nil, nil
+	}
+	parts := strings.Split(s, ",")
+	buckets := make([]duration.Duration, 0, len(parts))
+	for _, part := range parts {
+		bucket, err := duration.FromString(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		if len(buckets) > 0 && bucket <= buckets[len(buckets)-1] {
+			return nil, fmt.Errorf("latency buckets must be increasing: %s", s)
+		}
+		buckets = append(buckets, bucket)
 	}
-	return nil
+	return buckets, nil
 }
 
 func setMaxProcs() {
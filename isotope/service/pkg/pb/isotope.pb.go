@@ -0,0 +1,362 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: isotope.proto
+
+package pb
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+// Request is sent by the caller of an isotope service.
+type Request struct {
+	// Payload is the request body; its size is set by the caller's script.
+	Payload []byte `protobuf:"bytes,1,opt,name=payload,proto3" json:"payload,omitempty"`
+	// Endpoint is the name of the endpoint of the service to invoke. If unset,
+	// the service's own script runs.
+	Endpoint             string   `protobuf:"bytes,2,opt,name=endpoint,proto3" json:"endpoint,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Request) Reset()         { *m = Request{} }
+func (m *Request) String() string { return proto.CompactTextString(m) }
+func (*Request) ProtoMessage()    {}
+func (*Request) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8b5d12611f86821b, []int{0}
+}
+
+func (m *Request) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Request.Unmarshal(m, b)
+}
+func (m *Request) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Request.Marshal(b, m, deterministic)
+}
+func (m *Request) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Request.Merge(m, src)
+}
+func (m *Request) XXX_Size() int {
+	return xxx_messageInfo_Request.Size(m)
+}
+func (m *Request) XXX_DiscardUnknown() {
+	xxx_messageInfo_Request.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Request proto.InternalMessageInfo
+
+func (m *Request) GetPayload() []byte {
+	if m != nil {
+		return m.Payload
+	}
+	return nil
+}
+
+func (m *Request) GetEndpoint() string {
+	if m != nil {
+		return m.Endpoint
+	}
+	return ""
+}
+
+// Response is returned by an isotope service after running its script.
+type Response struct {
+	// Payload is the response body; its size is set by the service's
+	// responseSize.
+	Payload              []byte   `protobuf:"bytes,1,opt,name=payload,proto3" json:"payload,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Response) Reset()         { *m = Response{} }
+func (m *Response) String() string { return proto.CompactTextString(m) }
+func (*Response) ProtoMessage()    {}
+func (*Response) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8b5d12611f86821b, []int{1}
+}
+
+func (m *Response) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Response.Unmarshal(m, b)
+}
+func (m *Response) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Response.Marshal(b, m, deterministic)
+}
+func (m *Response) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Response.Merge(m, src)
+}
+func (m *Response) XXX_Size() int {
+	return xxx_messageInfo_Response.Size(m)
+}
+func (m *Response) XXX_DiscardUnknown() {
+	xxx_messageInfo_Response.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Response proto.InternalMessageInfo
+
+func (m *Response) GetPayload() []byte {
+	if m != nil {
+		return m.Payload
+	}
+	return nil
+}
+
+// StreamRequest asks an isotope service to stream messages back.
+type StreamRequest struct {
+	// Payload is the request body.
+	Payload []byte `protobuf:"bytes,1,opt,name=payload,proto3" json:"payload,omitempty"`
+	// Messages is the number of messages to stream back.
+	Messages int32 `protobuf:"varint,2,opt,name=messages,proto3" json:"messages,omitempty"`
+	// IntervalNanos is the pause between two streamed messages.
+	IntervalNanos int64 `protobuf:"varint,3,opt,name=interval_nanos,json=intervalNanos,proto3" json:"interval_nanos,omitempty"`
+	// MessageSize is the number of bytes in each streamed message.
+	MessageSize          int64    `protobuf:"varint,4,opt,name=message_size,json=messageSize,proto3" json:"message_size,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *StreamRequest) Reset()         { *m = StreamRequest{} }
+func (m *StreamRequest) String() string { return proto.CompactTextString(m) }
+func (*StreamRequest) ProtoMessage()    {}
+func (*StreamRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8b5d12611f86821b, []int{2}
+}
+
+func (m *StreamRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_StreamRequest.Unmarshal(m, b)
+}
+func (m *StreamRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_StreamRequest.Marshal(b, m, deterministic)
+}
+func (m *StreamRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_StreamRequest.Merge(m, src)
+}
+func (m *StreamRequest) XXX_Size() int {
+	return xxx_messageInfo_StreamRequest.Size(m)
+}
+func (m *StreamRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_StreamRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_StreamRequest proto.InternalMessageInfo
+
+func (m *StreamRequest) GetPayload() []byte {
+	if m != nil {
+		return m.Payload
+	}
+	return nil
+}
+
+func (m *StreamRequest) GetMessages() int32 {
+	if m != nil {
+		return m.Messages
+	}
+	return 0
+}
+
+func (m *StreamRequest) GetIntervalNanos() int64 {
+	if m != nil {
+		return m.IntervalNanos
+	}
+	return 0
+}
+
+func (m *StreamRequest) GetMessageSize() int64 {
+	if m != nil {
+		return m.MessageSize
+	}
+	return 0
+}
+
+func init() {
+	proto.RegisterType((*Request)(nil), "isotope.Request")
+	proto.RegisterType((*Response)(nil), "isotope.Response")
+	proto.RegisterType((*StreamRequest)(nil), "isotope.StreamRequest")
+}
+
+func init() { proto.RegisterFile("isotope.proto", fileDescriptor_8b5d12611f86821b) }
+
+var fileDescriptor_8b5d12611f86821b = []byte{
+	// 241 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x90, 0xc1, 0x4a, 0x03, 0x31,
+	0x10, 0x86, 0x49, 0x5b, 0x37, 0x75, 0xec, 0x8a, 0xe6, 0x20, 0xa1, 0xa7, 0x75, 0x51, 0xd8, 0x8b,
+	0x45, 0x14, 0xcf, 0x82, 0xb7, 0x5e, 0x3c, 0xa4, 0x37, 0x2f, 0x25, 0xa5, 0x83, 0x04, 0xdb, 0x4c,
+	0xdc, 0x89, 0x05, 0xfb, 0x12, 0xbe, 0xb2, 0xb8, 0x9b, 0x5d, 0x14, 0x14, 0x3c, 0x7e, 0x5f, 0x32,
+	0x99, 0xfc, 0x3f, 0xe4, 0x8e, 0x29, 0x52, 0xc0, 0x59, 0xa8, 0x29, 0x92, 0x92, 0x09, 0xcb, 0x7b,
+	0x90, 0x06, 0x5f, 0xdf, 0x90, 0xa3, 0xd2, 0x20, 0x83, 0x7d, 0xdf, 0x90, 0x5d, 0x6b, 0x51, 0x88,
+	0x6a, 0x62, 0x3a, 0x54, 0x53, 0x18, 0xa3, 0x5f, 0x07, 0x72, 0x3e, 0xea, 0x41, 0x21, 0xaa, 0x43,
+	0xd3, 0x73, 0x79, 0x01, 0x63, 0x83, 0x1c, 0xc8, 0x33, 0xfe, 0xfd, 0x42, 0xf9, 0x21, 0x20, 0x5f,
+	0xc4, 0x1a, 0xed, 0xf6, 0x5f, 0xdb, 0xb6, 0xc8, 0x6c, 0x9f, 0x91, 0x9b, 0x6d, 0x07, 0xa6, 0x67,
+	0x75, 0x09, 0xc7, 0xce, 0x47, 0xac, 0x77, 0x76, 0xb3, 0xf4, 0xd6, 0x13, 0xeb, 0x61, 0x21, 0xaa,
+	0xa1, 0xc9, 0x3b, 0xfb, 0xf8, 0x25, 0xd5, 0x39, 0x4c, 0xd2, 0xc8, 0x92, 0xdd, 0x1e, 0xf5, 0xa8,
+	0xb9, 0x74, 0x94, 0xdc, 0xc2, 0xed, 0xf1, 0x86, 0x40, 0xce, 0xdb, 0x0e, 0xd4, 0x15, 0x64, 0x73,
+	0xbf, 0xa3, 0x17, 0x54, 0x27, 0xb3, 0xae, 0xa6, 0xf4, 0xcd, 0xe9, 0xe9, 0x37, 0x93, 0x52, 0xde,
+	0x41, 0xd6, 0x46, 0x51, 0x67, 0xfd, 0xe1, 0x8f, 0x6c, 0xbf, 0x0c, 0x5d, 0x8b, 0x87, 0xd1, 0xd3,
+	0x20, 0xac, 0x56, 0x59, 0xd3, 0xff, 0xed, 0xe7, 0x00, 0x75, 0xff, 0x2c, 0xde, 0x90, 0x01, 0x00,
+	0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// IsotopeClient is the client API for Isotope service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type IsotopeClient interface {
+	// Invoke runs the service's script and responds with its payload.
+	Invoke(ctx context.Context, in *Request, opts ...grpc.CallOption) (*Response, error)
+	// Stream runs the service's script, then streams messages back.
+	Stream(ctx context.Context, in *StreamRequest, opts ...grpc.CallOption) (Isotope_StreamClient, error)
+}
+
+type isotopeClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewIsotopeClient(cc *grpc.ClientConn) IsotopeClient {
+	return &isotopeClient{cc}
+}
+
+func (c *isotopeClient) Invoke(ctx context.Context, in *Request, opts ...grpc.CallOption) (*Response, error) {
+	out := new(Response)
+	err := c.cc.Invoke(ctx, "/isotope.Isotope/Invoke", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *isotopeClient) Stream(ctx context.Context, in *StreamRequest, opts ...grpc.CallOption) (Isotope_StreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Isotope_serviceDesc.Streams[0], "/isotope.Isotope/Stream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &isotopeStreamClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Isotope_StreamClient interface {
+	Recv() (*Response, error)
+	grpc.ClientStream
+}
+
+type isotopeStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *isotopeStreamClient) Recv() (*Response, error) {
+	m := new(Response)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// IsotopeServer is the server API for Isotope service.
+type IsotopeServer interface {
+	// Invoke runs the service's script and responds with its payload.
+	Invoke(context.Context, *Request) (*Response, error)
+	// Stream runs the service's script, then streams messages back.
+	Stream(*StreamRequest, Isotope_StreamServer) error
+}
+
+// UnimplementedIsotopeServer can be embedded to have forward compatible implementations.
+type UnimplementedIsotopeServer struct {
+}
+
+func (*UnimplementedIsotopeServer) Invoke(ctx context.Context, req *Request) (*Response, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Invoke not implemented")
+}
+func (*UnimplementedIsotopeServer) Stream(req *StreamRequest, srv Isotope_StreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method Stream not implemented")
+}
+
+func RegisterIsotopeServer(s *grpc.Server, srv IsotopeServer) {
+	s.RegisterService(&_Isotope_serviceDesc, srv)
+}
+
+func _Isotope_Invoke_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IsotopeServer).Invoke(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/isotope.Isotope/Invoke",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IsotopeServer).Invoke(ctx, req.(*Request))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Isotope_Stream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(IsotopeServer).Stream(m, &isotopeStreamServer{stream})
+}
+
+type Isotope_StreamServer interface {
+	Send(*Response) error
+	grpc.ServerStream
+}
+
+type isotopeStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *isotopeStreamServer) Send(m *Response) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+var _Isotope_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "isotope.Isotope",
+	HandlerType: (*IsotopeServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Invoke",
+			Handler:    _Isotope_Invoke_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Stream",
+			Handler:       _Isotope_Stream_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "isotope.proto",
+}
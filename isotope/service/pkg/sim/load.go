@@ -0,0 +1,169 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sim
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/script"
+)
+
+// Load describes requests driven through a Simulation. Load stops after
+// Requests requests or after Duration, whichever comes first, or when the
+// context passed to Drive is done.
+type Load struct {
+	// Request is sent to one of the simulated services, like a call command
+	// of a script.
+	Request script.RequestCommand
+	// QPS is the rate at which requests are sent. If unset, each worker sends
+	// the next request as soon as the previous one is responded to.
+	QPS float64
+	// Concurrency is the number of workers sending requests. If unset, it is
+	// 1.
+	Concurrency int
+	// Requests is the number of requests to send. If unset, it is unlimited.
+	Requests int
+	// Duration bounds the time spent sending requests. If unset, it is
+	// unlimited.
+	Duration time.Duration
+}
+
+// LoadResult summarizes the requests driven by Drive.
+type LoadResult struct {
+	Requests int
+	Errors   int
+	Duration time.Duration
+	// Latencies holds the latency of each request, in increasing order.
+	Latencies []time.Duration
+	// FirstError is the error of the first failed request, if any.
+	FirstError error
+}
+
+// Percentile returns the latency under which p percent of the requests were
+// responded to, or 0 if no request was sent.
+func (r LoadResult) Percentile(p float64) time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	i := int(p / 100 * float64(len(r.Latencies)))
+	if i >= len(r.Latencies) {
+		i = len(r.Latencies) - 1
+	}
+	return r.Latencies[i]
+}
+
+func (r LoadResult) String() string {
+	qps := 0.0
+	if r.Duration > 0 {
+		qps = float64(r.Requests) / r.Duration.Seconds()
+	}
+	return fmt.Sprintf(
+		"%d requests, %d errors in %s (%.1f QPS); "+
+			"latency p50 %s, p90 %s, p99 %s, max %s",
+		r.Requests, r.Errors, r.Duration.Round(time.Millisecond), qps,
+		r.Percentile(50).Round(time.Microsecond),
+		r.Percentile(90).Round(time.Microsecond),
+		r.Percentile(99).Round(time.Microsecond),
+		r.Percentile(100).Round(time.Microsecond))
+}
+
+// Drive sends the requests of load and waits for their responses. Requests
+// cut short by the end of load are not counted.
+func (s *Simulation) Drive(ctx context.Context, load Load) (LoadResult, error) {
+	h, ok := s.handlers[load.Request.ServiceName]
+	if !ok {
+		return LoadResult{}, fmt.Errorf(
+			"service %s is not simulated", load.Request.ServiceName)
+	}
+	if load.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, load.Duration)
+		defer cancel()
+	}
+	concurrency := load.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var ticks <-chan time.Time
+	if load.QPS > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / load.QPS))
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+
+	var (
+		mu     sync.Mutex
+		result LoadResult
+		// started counts the requests started, to stop at load.Requests.
+		started int
+	)
+	start := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if load.Requests > 0 && started >= load.Requests {
+			return false
+		}
+		started++
+		return true
+	}
+	record := func(latency time.Duration, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		result.Requests++
+		result.Latencies = append(result.Latencies, latency)
+		if err != nil {
+			result.Errors++
+			if result.FirstError == nil {
+				result.FirstError = err
+			}
+		}
+	}
+
+	startTime := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for start() {
+				if ticks != nil {
+					select {
+					case <-ticks:
+					case <-ctx.Done():
+						return
+					}
+				}
+				requestStartTime := time.Now()
+				err := h.Handler().Call(ctx, load.Request)
+				if ctx.Err() != nil {
+					return
+				}
+				record(time.Since(requestStartTime), err)
+			}
+		}()
+	}
+	wg.Wait()
+	result.Duration = time.Since(startTime)
+
+	sort.Slice(result.Latencies, func(i, j int) bool {
+		return result.Latencies[i] < result.Latencies[j]
+	})
+	return result, nil
+}
@@ -0,0 +1,200 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sim runs every service of a service graph in a single process, so
+// that topologies and scripts can be tried without a Kubernetes cluster.
+package sim
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ghodss/yaml"
+	multierror "github.com/hashicorp/go-multierror"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+
+	"istio.io/pkg/log"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/svctype"
+	"github.com/kristofgyuracz/istio-tools/isotope/service/pkg/pb"
+	"github.com/kristofgyuracz/istio-tools/isotope/service/pkg/srv"
+)
+
+// Options configures a Simulation.
+type Options struct {
+	// BasePort is the port of the first service of the graph, and the
+	// following services take the following ports. If unset, each service
+	// listens on a free port picked by the system.
+	BasePort int
+}
+
+// Simulation runs each service of a service graph on a port of its own on
+// localhost. Calls between the services are sent to these ports instead of
+// being resolved through DNS. Services run a single replica each, over
+// plaintext.
+type Simulation struct {
+	services []string
+	handlers map[string]*srv.ReloadingHandler
+	addrs    map[string]string
+	closers  []func() error
+	wg       sync.WaitGroup
+}
+
+// Start reads the service graph from the YAML file at path and starts serving
+// each of its services.
+func Start(path string, opts Options) (*Simulation, error) {
+	graphYAML, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var serviceGraph graph.ServiceGraph
+	if err := yaml.Unmarshal(graphYAML, &serviceGraph); err != nil {
+		return nil, err
+	}
+
+	s := &Simulation{
+		handlers: map[string]*srv.ReloadingHandler{},
+		addrs:    map[string]string{},
+	}
+	listeners := make([]net.Listener, 0, len(serviceGraph.Services))
+	for i, service := range serviceGraph.Services {
+		h, err := srv.NewReloadingHandler(path, service.Name, nil)
+		if err != nil {
+			closeAll(listeners)
+			return nil, err
+		}
+		port := 0
+		if opts.BasePort > 0 {
+			port = opts.BasePort + i
+		}
+		listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err != nil {
+			closeAll(listeners)
+			return nil, err
+		}
+		listeners = append(listeners, listener)
+		s.services = append(s.services, service.Name)
+		s.handlers[service.Name] = h
+		s.addrs[service.Name] = listener.Addr().String()
+	}
+
+	// Every address must be known before the first request is served.
+	srv.UseAddresses(s.addrs)
+	for i, name := range s.services {
+		s.serve(s.handlers[name], listeners[i])
+		log.Infof("simulating service %s on %s", name, s.addrs[name])
+	}
+	return s, nil
+}
+
+// serve serves the service emulated by h on listener in the background,
+// according to its type.
+func (s *Simulation) serve(h *srv.ReloadingHandler, listener net.Listener) {
+	var (
+		serve   func() error
+		closing = make(chan struct{})
+	)
+	switch h.Handler().Service.Type {
+	case svctype.ServiceGRPC:
+		grpcServer := grpc.NewServer()
+		pb.RegisterIsotopeServer(grpcServer, h)
+		serve = func() error { return grpcServer.Serve(listener) }
+		s.closers = append(s.closers, func() error {
+			close(closing)
+			grpcServer.Stop()
+			return nil
+		})
+	case svctype.ServiceTCP:
+		server := &srv.TCPServer{Handler: h}
+		serve = func() error { return server.Serve(listener) }
+		s.closers = append(s.closers, func() error {
+			close(closing)
+			return server.Close()
+		})
+	default:
+		// Accept HTTP/2 over plaintext (h2c) alongside HTTP/1.1, like the
+		// service does.
+		server := &http.Server{Handler: h2c.NewHandler(h, &http2.Server{})}
+		serve = func() error { return server.Serve(listener) }
+		s.closers = append(s.closers, func() error {
+			close(closing)
+			return server.Close()
+		})
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		err := serve()
+		select {
+		case <-closing:
+		default:
+			log.Errorf("service %s: %s", h.Handler().Service.Name, err)
+		}
+	}()
+}
+
+// Services returns the names of the simulated services, in the order of the
+// service graph.
+func (s *Simulation) Services() []string {
+	return s.services
+}
+
+// Addr returns the address ("host:port") the service named serviceName
+// listens on, or "" if it is not simulated.
+func (s *Simulation) Addr(serviceName string) string {
+	return s.addrs[serviceName]
+}
+
+// Handler returns the handler emulating the service named serviceName, or nil
+// if it is not simulated.
+func (s *Simulation) Handler(serviceName string) *srv.ReloadingHandler {
+	return s.handlers[serviceName]
+}
+
+// Watch reloads every service whenever the service graph file changes, checking
+// it every interval until ctx is done. Like the service, a change to the
+// services themselves, rather than to their properties, requires a restart.
+func (s *Simulation) Watch(ctx context.Context, interval time.Duration) {
+	for _, h := range s.handlers {
+		go h.Watch(ctx, interval)
+	}
+}
+
+// Close stops serving every service and waits for the servers to return.
+// Requests in flight are cut short.
+func (s *Simulation) Close() error {
+	var errs error
+	for _, closeServer := range s.closers {
+		if err := closeServer(); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+	s.wg.Wait()
+	return errs
+}
+
+func closeAll(listeners []net.Listener) {
+	for _, listener := range listeners {
+		listener.Close()
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sim
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/script"
+)
+
+const graphYAML = `
+services:
+- name: a
+  script:
+  - - call: b
+    - call: c
+  - stream:
+      service: d
+      messages: 2
+- name: b
+  type: grpc
+  script:
+  - call: c
+- name: c
+  type: tcp
+- name: d
+  endpoints:
+  - name: fail
+    script:
+    - call: e
+- name: e
+  errorRate: 100%
+`
+
+func TestSimulation_Drive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "service-graph.yaml")
+	if err := ioutil.WriteFile(path, []byte(graphYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Start(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tests := []struct {
+		request script.RequestCommand
+		errors  int
+	}{
+		{script.RequestCommand{ServiceName: "a"}, 0},
+		{script.RequestCommand{ServiceName: "d", Endpoint: "fail"}, 10},
+	}
+
+	for _, test := range tests {
+		result, err := s.Drive(context.Background(), Load{
+			Request:     test.request,
+			Concurrency: 2,
+			Requests:    10,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Requests != 10 || result.Errors != test.errors {
+			t.Errorf("expected 10 requests and %d errors; actual %s (%v)",
+				test.errors, result, result.FirstError)
+		}
+	}
+
+	if _, err := s.Drive(context.Background(), Load{
+		Request: script.RequestCommand{ServiceName: "z"},
+	}); err == nil {
+		t.Errorf("expected an error driving load to an unknown service")
+	}
+}
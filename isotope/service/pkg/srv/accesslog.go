@@ -0,0 +1,235 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package srv
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"istio.io/pkg/log"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/svctype"
+	"github.com/kristofgyuracz/istio-tools/isotope/service/pkg/srv/prometheus"
+	"github.com/kristofgyuracz/istio-tools/isotope/service/pkg/srv/tracing"
+)
+
+// requestIDHeader is the header of the ID which Envoy gives each request and
+// which its access logs record.
+const requestIDHeader = "X-Request-Id"
+
+// AccessLogLevel is the lowest level of the entries written to an AccessLog.
+type AccessLogLevel string
+
+const (
+	// AccessLogInfo writes every entry.
+	AccessLogInfo AccessLogLevel = "info"
+	// AccessLogError writes the entries of failed requests and attempts only:
+	// those which responded with a 4xx or 5xx status code, or failed before
+	// the destination responded.
+	AccessLogError AccessLogLevel = "error"
+)
+
+// ParseAccessLogLevel converts s to an AccessLogLevel.
+func ParseAccessLogLevel(s string) (AccessLogLevel, error) {
+	switch level := AccessLogLevel(s); level {
+	case AccessLogInfo, AccessLogError:
+		return level, nil
+	default:
+		return "", fmt.Errorf(
+			`unknown access log level: %s (must be "%s" or "%s")`,
+			s, AccessLogInfo, AccessLogError)
+	}
+}
+
+// AccessLog writes a JSON line for each inbound request served and for each
+// attempt of the calls to other services, carrying their request ID and trace
+// ID so that they can be correlated with the access logs of a mesh's proxies.
+// A nil AccessLog writes nothing.
+type AccessLog struct {
+	w     io.Writer
+	mutex sync.Mutex
+	level AccessLogLevel
+	// sampling is the fraction of successful entries written. Failed entries
+	// are always written.
+	sampling float64
+}
+
+// NewAccessLog makes an AccessLog writing to w the entries at level or above,
+// and a sampling fraction, from 0 to 1, of the successful ones.
+func NewAccessLog(
+	w io.Writer, level AccessLogLevel, sampling float64) *AccessLog {
+	return &AccessLog{w: w, level: level, sampling: sampling}
+}
+
+// accessLog is the AccessLog of the service, if any.
+var accessLog *AccessLog
+
+// UseAccessLog writes access logs to l, or stops writing them if l is nil. It
+// must be called before requests are served.
+func UseAccessLog(l *AccessLog) {
+	accessLog = l
+}
+
+// accessLogEntry is the JSON form of an entry of an AccessLog.
+type accessLogEntry struct {
+	Time  time.Time      `json:"time"`
+	Level AccessLogLevel `json:"level"`
+	// Direction is "inbound" for requests served, or "outbound" for attempts
+	// of calls.
+	Direction string `json:"direction"`
+	Service   string `json:"service"`
+	// Destination is the service called, for outbound entries.
+	Destination string `json:"destination,omitempty"`
+	// Endpoint is the endpoint served, or called for outbound entries.
+	Endpoint  string              `json:"endpoint,omitempty"`
+	Protocol  svctype.ServiceType `json:"protocol"`
+	Method    string              `json:"method,omitempty"`
+	Path      string              `json:"path,omitempty"`
+	RequestID string              `json:"requestId,omitempty"`
+	TraceID   string              `json:"traceId,omitempty"`
+	// Step is the index of the top-level step of the script which made the
+	// call, for outbound entries.
+	Step *int `json:"step,omitempty"`
+	// Attempt counts the attempts of the call from 1, for outbound entries.
+	Attempt int `json:"attempt,omitempty"`
+	// Status is the status code responded, unless the attempt failed before
+	// the destination responded, in which case Failure describes how.
+	Status        int     `json:"status,omitempty"`
+	Failure       string  `json:"failure,omitempty"`
+	BytesReceived int     `json:"bytesReceived,omitempty"`
+	BytesSent     int     `json:"bytesSent"`
+	DurationMs    float64 `json:"durationMs"`
+}
+
+// inboundEntry starts the entry of an inbound request to the Service over
+// protocol, with header and a body of bytesReceived bytes. Its trace ID is
+// the one propagated in header, until executeScript sets that of the server
+// span it starts.
+func (h Handler) inboundEntry(
+	protocol svctype.ServiceType,
+	method string,
+	path string,
+	header http.Header,
+	bytesReceived int) accessLogEntry {
+	entry := accessLogEntry{
+		Direction:     "inbound",
+		Service:       h.Service.Name,
+		Protocol:      protocol,
+		Method:        method,
+		Path:          path,
+		RequestID:     header.Get(requestIDHeader),
+		BytesReceived: bytesReceived,
+	}
+	if sc := tracing.Extract(header); sc.IsValid() {
+		entry.TraceID = sc.TraceID.String()
+	}
+	return entry
+}
+
+// responseSent records the response to the inbound request of entry, of size
+// bytes and with code, in the metrics and in the access log.
+func responseSent(
+	entry accessLogEntry, duration time.Duration, size int, code int) {
+	prometheus.RecordResponseSent(duration, size, code)
+	entry.Status = code
+	entry.BytesSent = size
+	accessLog.write(entry, duration)
+}
+
+// outboundEntry starts the entry of the attempts of a call, by the executor's
+// inbound request, to destName's endpoint over protocol. The trace ID is that
+// of the call's span in ctx.
+func (e executor) outboundEntry(
+	ctx context.Context,
+	destName string,
+	endpoint string,
+	protocol svctype.ServiceType,
+	method string,
+	path string,
+	bytesSent int) accessLogEntry {
+	entry := accessLogEntry{
+		Direction:   "outbound",
+		Service:     e.requestData.Service,
+		Destination: destName,
+		Endpoint:    endpoint,
+		Protocol:    protocol,
+		Method:      method,
+		Path:        path,
+		RequestID:   e.requestData.Header.Get(requestIDHeader),
+		BytesSent:   bytesSent,
+	}
+	if sc := tracing.SpanContextFromContext(ctx); sc.IsValid() {
+		entry.TraceID = sc.TraceID.String()
+	}
+	if e.step >= 0 {
+		step := e.step
+		entry.Step = &step
+	}
+	return entry
+}
+
+// attemptDone records the outcome of the attempt numbered attempt, from 1, of
+// the call of entry in the access log.
+func attemptDone(
+	entry accessLogEntry, attempt int, outcome string, duration time.Duration) {
+	if accessLog == nil {
+		return
+	}
+	entry.Attempt = attempt
+	if code, err := strconv.Atoi(outcome); err == nil {
+		entry.Status = code
+	} else {
+		entry.Failure = outcome
+	}
+	accessLog.write(entry, duration)
+}
+
+// write writes entry, which took duration, unless it is below l's level or
+// not sampled.
+func (l *AccessLog) write(entry accessLogEntry, duration time.Duration) {
+	if l == nil {
+		return
+	}
+	entry.Level = AccessLogInfo
+	if entry.Failure != "" || entry.Status >= 400 {
+		entry.Level = AccessLogError
+	}
+	if entry.Level == AccessLogInfo {
+		if l.level == AccessLogError || rand.Float64() >= l.sampling {
+			return
+		}
+	}
+	entry.Time = time.Now()
+	entry.DurationMs = float64(duration) / float64(time.Millisecond)
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Errorf("%s", err)
+		return
+	}
+	line = append(line, '\n')
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if _, err := l.w.Write(line); err != nil {
+		log.Errorf("writing access log: %s", err)
+	}
+}
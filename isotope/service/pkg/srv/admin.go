@@ -0,0 +1,123 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/ghodss/yaml"
+
+	"istio.io/pkg/log"
+)
+
+var startTime = time.Now()
+
+// buildInfo is the JSON form of the build of this binary.
+type buildInfo struct {
+	GoVersion  string    `json:"goVersion"`
+	Platform   string    `json:"platform"`
+	Path       string    `json:"path,omitempty"`
+	Version    string    `json:"version,omitempty"`
+	Sum        string    `json:"sum,omitempty"`
+	StartTime  time.Time `json:"startTime"`
+	NumCPU     int       `json:"numCPU"`
+	GOMAXPROCS int       `json:"gomaxprocs"`
+}
+
+// AdminHandler returns an http.Handler for probing and debugging the service
+// emulated by h, meant to be served on a port separate from the service's:
+//
+//   - /healthz: the liveness of the service, per health
+//   - /readyz: the readiness of the service, per health
+//   - /debug/service: the effective Service, after defaults, as YAML
+//   - /debug/graph: the service graph in use, as YAML
+//   - /debug/generation: the generation of the service graph in use
+//   - /debug/inflight: the requests being served and the calls in flight to
+//     each destination, as JSON
+//   - /debug/build: the Go version and module of the binary, as JSON
+//   - /debug/pprof/: the runtime profiles of net/http/pprof
+func AdminHandler(h *ReloadingHandler, health *Health) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", health.ServeLive)
+	mux.HandleFunc("/readyz", health.ServeReady)
+	mux.HandleFunc("/debug/service", func(w http.ResponseWriter, _ *http.Request) {
+		writeYAML(w, h.Handler().Service)
+	})
+	mux.HandleFunc("/debug/graph", func(w http.ResponseWriter, _ *http.Request) {
+		writeYAML(w, h.ServiceGraph())
+	})
+	mux.HandleFunc("/debug/generation", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, h.Generation())
+	})
+	mux.HandleFunc("/debug/inflight", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, inFlight.snapshot())
+	})
+	mux.HandleFunc("/debug/build", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, readBuildInfo())
+	})
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+func readBuildInfo() buildInfo {
+	info := buildInfo{
+		GoVersion:  runtime.Version(),
+		Platform:   runtime.GOOS + "/" + runtime.GOARCH,
+		StartTime:  startTime,
+		NumCPU:     runtime.NumCPU(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		info.Path = bi.Main.Path
+		info.Version = bi.Main.Version
+		info.Sum = bi.Main.Sum
+	}
+	return info
+}
+
+func writeYAML(w http.ResponseWriter, v interface{}) {
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	if _, err := w.Write(b); err != nil {
+		log.Errorf("%s", err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(b); err != nil {
+		log.Errorf("%s", err)
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package srv
+
+import (
+	"bytes"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"istio.io/pkg/log"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/body"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/size"
+)
+
+// words make up compressible text.
+var words = []string{
+	"lorem", "ipsum", "dolor", "sit", "amet", "consectetur", "adipiscing",
+	"elit", "sed", "do", "eiusmod", "tempor", "incididunt", "ut", "labore",
+	"et", "dolore", "magna", "aliqua", "enim", "ad", "minim", "veniam", "quis",
+	"nostrud", "exercitation", "ullamco", "laboris", "nisi", "aliquip", "ex",
+	"ea", "commodo", "consequat",
+}
+
+// maxBodySize bounds the size of response bodies and streamed messages, so
+// that a large sampled or requested size cannot exhaust the service's memory.
+const maxBodySize = 64 << 20
+
+// maxCachedPayloadSize bounds the buffers payloads keep. Larger bodies are
+// generated for each response.
+const maxCachedPayloadSize = 4 << 20
+
+// payloads fills response bodies. Random bytes and text are sliced from
+// buffers which grow to the largest size requested so far, up to
+// maxCachedPayloadSize, so that bodies of a constant size are only generated
+// once.
+type payloads struct {
+	mutex  sync.RWMutex
+	random []byte
+	text   []byte
+}
+
+// responseBody returns the body of a response to a request with header and
+// requestBody, according to the service's ResponseBody and responseSize.
+func (h Handler) responseBody(
+	header http.Header,
+	requestBody []byte,
+	responseSize *size.Distribution) []byte {
+	spec := h.Service.ResponseBody
+	mode := spec.BodyMode()
+	if mode == body.Echo {
+		return requestBody
+	}
+
+	z := responseSize.Sample()
+	if name := spec.SizeHeaderName(); name != "" {
+		if value := header.Get(name); value != "" {
+			if requested, err := size.FromString(value); err == nil {
+				z = requested
+			} else {
+				log.Debugf("ignoring %s: %s", name, err)
+			}
+		}
+	}
+	if z > maxBodySize {
+		log.Debugf("clamping response size %s to %d bytes", z, maxBodySize)
+		z = maxBodySize
+	}
+	n := int(z)
+
+	switch mode {
+	case body.Text:
+		return h.payloads.get(&h.payloads.text, makeText, n)
+	case body.JSON:
+		text := h.payloads.get(&h.payloads.text, makeText, n)
+		return makeJSONDocument(spec.BodyShape(), n, text)
+	default:
+		return h.payloads.get(&h.payloads.random, makeRandomBytes, n)
+	}
+}
+
+// responseContentType returns the Content-Type of bodies filled in mode, or
+// "" to let it be detected.
+func responseContentType(mode body.Mode) string {
+	switch mode {
+	case body.Text:
+		return "text/plain; charset=utf-8"
+	case body.JSON:
+		return "application/json"
+	default:
+		return ""
+	}
+}
+
+// get returns the first n bytes of *buffer, replacing it with a larger one
+// made by makeBuffer first if it is too short. Sizes above
+// maxCachedPayloadSize are made without replacing *buffer, and negative ones
+// are empty. Returned slices must not be modified.
+func (p *payloads) get(
+	buffer *[]byte, makeBuffer func(n int) []byte, n int) []byte {
+	if n < 0 {
+		n = 0
+	}
+	if n > maxCachedPayloadSize {
+		return makeBuffer(n)
+	}
+	p.mutex.RLock()
+	b := *buffer
+	p.mutex.RUnlock()
+	if len(b) >= n {
+		return b[:n]
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if len(*buffer) < n {
+		*buffer = makeBuffer(n)
+	}
+	return (*buffer)[:n]
+}
+
+func makeRandomBytes(n int) []byte {
+	b := make([]byte, n)
+	// math/rand.Read always returns len(b) and a nil error.
+	_, _ = rand.Read(b)
+	return b
+}
+
+// makeText returns n bytes of random words separated by spaces.
+func makeText(n int) []byte {
+	var buf bytes.Buffer
+	buf.Grow(n + len("consectetur "))
+	for buf.Len() < n {
+		buf.WriteString(words[rand.Intn(len(words))])
+		buf.WriteByte(' ')
+	}
+	return buf.Bytes()[:n]
+}
+
+// makeJSONDocument returns a JSON document of shape whose string fields are
+// sliced from text so that it is n bytes long, or as short as shape allows.
+// text must be at least n bytes long and must not contain characters which
+// need escaping in JSON strings.
+func makeJSONDocument(shape body.Shape, n int, text []byte) []byte {
+	var skeleton bytes.Buffer
+	writeJSONValue(&skeleton, shape, shape.Depth, func() []byte { return nil })
+
+	numLeaves := shape.NumLeaves()
+	remaining := n - skeleton.Len()
+	if remaining < 0 {
+		remaining = 0
+	}
+	leafLen, numLongerLeaves := remaining/numLeaves, remaining%numLeaves
+
+	doc := bytes.NewBuffer(make([]byte, 0, skeleton.Len()+remaining))
+	leaf, offset := 0, 0
+	writeJSONValue(doc, shape, shape.Depth, func() []byte {
+		length := leafLen
+		if leaf < numLongerLeaves {
+			length++
+		}
+		leaf++
+		s := text[offset : offset+length]
+		offset += length
+		return s
+	})
+	return doc.Bytes()
+}
+
+// writeJSONValue writes an object of shape nested depth levels deep to buf,
+// or a string from nextLeaf if depth is 0.
+func writeJSONValue(
+	buf *bytes.Buffer, shape body.Shape, depth int, nextLeaf func() []byte) {
+	if depth == 0 {
+		buf.WriteByte('"')
+		buf.Write(nextLeaf())
+		buf.WriteByte('"')
+		return
+	}
+	buf.WriteByte('{')
+	for i := 0; i < shape.Fields; i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(`"f`)
+		buf.WriteString(strconv.Itoa(i))
+		buf.WriteString(`":`)
+		writeJSONValue(buf, shape, depth-1, nextLeaf)
+	}
+	buf.WriteByte('}')
+}
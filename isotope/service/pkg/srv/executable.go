@@ -15,51 +15,150 @@
 package srv
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"math/rand"
 	"net/http"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	multierror "github.com/hashicorp/go-multierror"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"istio.io/pkg/log"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/headers"
 	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/script"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/svc"
 	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/svctype"
 	"github.com/kristofgyuracz/istio-tools/isotope/service/pkg/srv/prometheus"
+	"github.com/kristofgyuracz/istio-tools/isotope/service/pkg/srv/tracing"
 )
 
 func init() {
 	rand.Seed(time.Now().UnixNano())
 }
 
-func execute(
-	step interface{},
-	forwardableHeader http.Header,
-	serviceTypes map[string]svctype.ServiceType) error {
+// executor runs the steps of a Service's script on behalf of a single inbound
+// request.
+type executor struct {
+	requestData       headers.Data
+	headerPolicy      *headers.Policy
+	forwardableHeader http.Header
+	serviceTypes      map[string]svctype.ServiceType
+	endpoints         map[string]map[string]svc.Endpoint
+	tracer            *tracing.Tracer
+	// step is the index of the top-level step being run, or -1 outside of a
+	// script.
+	step int
+}
+
+// execute runs step, returning early with ctx's error if ctx is cancelled.
+func (e executor) execute(ctx context.Context, step script.Command) error {
 	switch cmd := step.(type) {
 	case script.SleepCommand:
-		executeSleepCommand(cmd)
+		return e.traced(ctx, "sleep", func(ctx context.Context) error {
+			return sleep(ctx, cmd.Sample())
+		})
+	case script.ComputeCommand:
+		return e.traced(ctx, "compute", func(ctx context.Context) error {
+			return compute(ctx, cmd)
+		})
+	case script.AllocateCommand:
+		return e.traced(ctx, "allocate", func(ctx context.Context) error {
+			allocate(cmd)
+			return nil
+		})
 	case script.RequestCommand:
-		if err := executeRequestCommand(
-			cmd, forwardableHeader, serviceTypes); err != nil {
-			return err
-		}
+		return e.executeRequestCommand(ctx, cmd)
+	case script.StreamCommand:
+		return e.executeStreamCommand(ctx, cmd)
 	case script.ConcurrentCommand:
-		if err := executeConcurrentCommand(
-			cmd, forwardableHeader, serviceTypes); err != nil {
-			return err
-		}
+		return e.traced(ctx, "concurrent", func(ctx context.Context) error {
+			return e.executeConcurrentCommand(ctx, cmd)
+		})
+	case script.OneOfCommand:
+		return e.traced(ctx, "oneOf", func(ctx context.Context) error {
+			return e.executeSequence(ctx, cmd.Pick().Script)
+		})
+	case script.SwitchCommand:
+		return e.traced(ctx, "switch", func(ctx context.Context) error {
+			c, ok := cmd.Match(e.requestData)
+			if !ok {
+				return nil
+			}
+			return e.executeSequence(ctx, c.Script)
+		})
+	case script.SequenceCommand:
+		return e.traced(ctx, "sequence", func(ctx context.Context) error {
+			return e.executeSequence(ctx, cmd.Commands)
+		})
+	case script.RepeatCommand:
+		return e.traced(ctx, "repeat", func(ctx context.Context) error {
+			return e.executeRepeatCommand(ctx, cmd)
+		})
 	default:
 		log.Fatalf("unknown command type in script: %T", cmd)
 	}
 	return nil
 }
 
-func executeSleepCommand(cmd script.SleepCommand) {
-	time.Sleep(time.Duration(cmd))
+// traced runs f within a new internal span named name.
+func (e executor) traced(
+	ctx context.Context, name string, f func(context.Context) error) error {
+	ctx, span := e.tracer.Start(ctx, name, tracing.SpanKindInternal)
+	defer span.End()
+	err := f(ctx)
+	span.SetError(err)
+	return err
+}
+
+// commandKind names the kind of step, as in the script's YAML.
+func commandKind(step script.Command) string {
+	switch step.(type) {
+	case script.SleepCommand:
+		return "sleep"
+	case script.ComputeCommand:
+		return "compute"
+	case script.AllocateCommand:
+		return "allocate"
+	case script.RequestCommand:
+		return "call"
+	case script.StreamCommand:
+		return "stream"
+	case script.ConcurrentCommand:
+		return "concurrent"
+	case script.OneOfCommand:
+		return "oneOf"
+	case script.SwitchCommand:
+		return "switch"
+	case script.SequenceCommand:
+		return "sequence"
+	case script.RepeatCommand:
+		return "repeat"
+	default:
+		return "unknown"
+	}
+}
+
+// sleep pauses for d or until ctx is done, whichever comes first.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func shouldSkipRequest(cmd script.RequestCommand) bool {
@@ -70,39 +169,151 @@ func shouldSkipRequest(cmd script.RequestCommand) bool {
 	return rand.Intn(100) < (100 - cmd.Probability)
 }
 
-// Execute sends an HTTP request to another service. Assumes DNS is available
-// which maps exe.ServiceName to the relevant URL to reach the service.
-func executeRequestCommand(
-	cmd script.RequestCommand,
-	forwardableHeader http.Header,
-	serviceTypes map[string]svctype.ServiceType) error {
+// Execute sends an HTTP, gRPC or TCP request, depending on the destination's
+// service type, to another service. Assumes DNS is available which maps
+// exe.ServiceName to the relevant URL to reach the service, unless
+// UseAddresses maps it. Failed attempts
+// are retried according to cmd. The call is traced by a client span whose
+// context is sent to the destination.
+func (e executor) executeRequestCommand(
+	ctx context.Context, cmd script.RequestCommand) error {
 
 	if shouldSkipRequest(cmd) {
 		return nil
 	}
 
 	destName := cmd.ServiceName
-	_, ok := serviceTypes[destName]
+	destType, ok := e.serviceTypes[destName]
 	if !ok {
 		return fmt.Errorf("service %s does not exist", destName)
 	}
-	response, err := sendRequest(destName, cmd.Size, forwardableHeader)
+	if cmd.Endpoint != "" {
+		if _, ok := e.endpoints[destName][cmd.Endpoint]; !ok {
+			return fmt.Errorf(
+				"service %s has no endpoint %s", destName, cmd.Endpoint)
+		}
+	}
+
+	header, err := e.callHeader(destName)
+	if err != nil {
+		return err
+	}
+	target, err := e.callTarget(cmd)
 	if err != nil {
 		return err
 	}
 
+	ctx, span := e.tracer.Start(ctx, "call "+destName, tracing.SpanKindClient)
+	defer span.End()
+	span.SetAttribute("peer.service", destName)
+	if cmd.Endpoint != "" {
+		span.SetAttribute("isotope.endpoint", cmd.Endpoint)
+	}
+	if span != nil {
+		header = tracing.Inject(header, span.SpanContext())
+	}
+
+	var (
+		attempt attemptFunc
+		entry   accessLogEntry
+	)
+	switch destType {
+	case svctype.ServiceGRPC:
+		attempt = func(ctx context.Context) (string, error) {
+			return attemptGRPCRequest(ctx, cmd, header)
+		}
+		entry = e.outboundEntry(ctx, destName, cmd.Endpoint, destType,
+			http.MethodPost, "/isotope.Isotope/Invoke", int(cmd.Size))
+	case svctype.ServiceTCP:
+		attempt = func(ctx context.Context) (string, error) {
+			return attemptTCPRequest(ctx, cmd, header)
+		}
+		entry = e.outboundEntry(
+			ctx, destName, cmd.Endpoint, destType, "", "", int(cmd.Size))
+	default:
+		call := httpCall{
+			destName:   destName,
+			method:     e.callMethod(cmd),
+			target:     target,
+			protocol:   cmd.Protocol,
+			connection: cmd.Connection,
+			pool:       cmd.ConnectionPool,
+			size:       cmd.Size,
+			header:     header,
+		}
+		attempt = func(ctx context.Context) (string, error) {
+			return attemptHTTPRequest(ctx, call)
+		}
+		entry = e.outboundEntry(ctx, destName, cmd.Endpoint, destType,
+			call.method, call.target, int(cmd.Size))
+	}
+
+	defer prometheus.RecordRequestSent(destName, uint64(cmd.Size))
+	defer inFlight.startOutbound(destName)()
+	err = executeWithRetries(ctx, cmd, attempt, entry)
+	span.SetError(err)
+	return err
+}
+
+// Call sends a request to another service as cmd, like a call in the
+// Service's script but outside of any inbound request, so that load can be
+// driven from within the process.
+func (h Handler) Call(ctx context.Context, cmd script.RequestCommand) error {
+	e := executor{
+		serviceTypes: h.ServiceTypes,
+		endpoints:    h.Endpoints,
+		tracer:       h.Tracer,
+		step:         -1,
+	}
+	return e.executeRequestCommand(ctx, cmd)
+}
+
+func attemptHTTPRequest(ctx context.Context, call httpCall) (string, error) {
+	destName := call.destName
+	response, err := sendRequest(ctx, call)
+	if err != nil {
+		return failureOutcome(ctx, err), err
+	}
+
 	// Necessary for reusing HTTP/1.x "keep-alive" TCP connections.
 	// https://golang.org/pkg/net/http/#Response
 	defer readAllAndClose(response.Body)
-	defer prometheus.RecordRequestSent(destName, uint64(cmd.Size))
 
 	log.Debugf("%s responded with %s", destName, response.Status)
+	outcome := strconv.Itoa(response.StatusCode)
 	if response.StatusCode != http.StatusOK {
-		return fmt.Errorf(
+		return outcome, fmt.Errorf(
 			"service %s responded with %s", destName, response.Status)
 	}
 
-	return nil
+	return outcome, nil
+}
+
+func attemptGRPCRequest(
+	ctx context.Context,
+	cmd script.RequestCommand,
+	forwardableHeader http.Header) (string, error) {
+	destName := cmd.ServiceName
+	ctx, progress := withGRPCProgress(ctx)
+	_, err := sendGRPCRequest(ctx, cmd, forwardableHeader)
+	if err != nil {
+		outcome := strconv.Itoa(httpStatusFromGRPCCode(status.Code(err)))
+		switch {
+		case ctx.Err() == context.DeadlineExceeded:
+			outcome = outcomeTimeout
+		case atomic.LoadInt32(&progress.responded) == 0 &&
+			status.Code(err) == codes.Unavailable:
+			// The destination did not respond, so gRPC made the status up.
+			outcome = outcomeReset
+			if atomic.LoadInt32(&progress.sent) == 0 {
+				outcome = outcomeConnectFailure
+			}
+		}
+		return outcome, fmt.Errorf(
+			"service %s responded with %s", destName, err)
+	}
+	log.Debugf("%s responded with %s", destName, codes.OK)
+	return strconv.Itoa(http.StatusOK), nil
 }
 
 func readAllAndClose(r io.ReadCloser) error {
@@ -112,25 +323,107 @@ func readAllAndClose(r io.ReadCloser) error {
 	return r.Close()
 }
 
-// executeConcurrentCommand calls each command in exe.Commands asynchronously
-// and waits for each to complete.
-func executeConcurrentCommand(
-	cmd script.ConcurrentCommand,
-	forwardableHeader http.Header,
-	serviceTypes map[string]svctype.ServiceType) (errs error) {
-	numSubCmds := len(cmd)
-	wg := sync.WaitGroup{}
-	wg.Add(numSubCmds)
-	for _, subCmd := range cmd {
-		go func(step interface{}) {
-			defer wg.Done()
+// executeSequence runs each of steps in order, stopping at the first error.
+func (e executor) executeSequence(
+	ctx context.Context, steps []script.Command) error {
+	for _, step := range steps {
+		if err := e.execute(ctx, step); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// executeRepeatCommand runs cmd's script cmd.Count times. Concurrent
+// repetitions run like the commands of a ConcurrentCommand; sequential ones
+// stop at the first error.
+func (e executor) executeRepeatCommand(
+	ctx context.Context, cmd script.RepeatCommand) error {
+	if cmd.Concurrent {
+		repetition := cmd.Repetition()
+		return e.executeConcurrently(ctx, cmd.Count,
+			func(int) script.Command { return repetition },
+			cmd.Policy, cmd.MaxParallelism)
+	}
+	for i := 0; i < cmd.Count; i++ {
+		if err := e.executeSequence(ctx, cmd.Script); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-			err := execute(step, forwardableHeader, serviceTypes)
-			if err != nil {
-				errs = multierror.Append(errs, err)
+// executeConcurrentCommand runs each command in cmd.Commands in its own
+// goroutine, at most cmd.MaxParallelism at a time, and waits for all of them to
+// return. With the FailFast policy, the first error cancels the other commands
+// and is returned alone. Otherwise, the errors of every command are returned.
+func (e executor) executeConcurrentCommand(
+	ctx context.Context, cmd script.ConcurrentCommand) error {
+	return e.executeConcurrently(ctx, len(cmd.Commands),
+		func(i int) script.Command { return cmd.Commands[i] },
+		cmd.Policy, cmd.MaxParallelism)
+}
+
+// executeConcurrently runs the n commands returned by command, for 0 to n-1,
+// like those of a ConcurrentCommand with policy and maxParallelism.
+func (e executor) executeConcurrently(
+	ctx context.Context,
+	n int,
+	command func(i int) script.Command,
+	policy script.ConcurrencyPolicy,
+	maxParallelism int) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	failFast := policy == script.FailFast
+	var (
+		mu       sync.Mutex
+		firstErr error
+		errs     error
+	)
+	recordErr := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+			if failFast {
+				cancel()
 			}
-		}(subCmd)
+		}
+		errs = multierror.Append(errs, err)
+	}
+
+	var slots chan struct{}
+	if maxParallelism > 0 {
+		slots = make(chan struct{}, maxParallelism)
+	}
+
+	var wg sync.WaitGroup
+launch:
+	for i := 0; i < n; i++ {
+		if slots != nil {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				recordErr(ctx.Err())
+				break launch
+			}
+		}
+		wg.Add(1)
+		go func(step script.Command) {
+			defer wg.Done()
+			if slots != nil {
+				defer func() { <-slots }()
+			}
+			if err := e.execute(ctx, step); err != nil {
+				recordErr(err)
+			}
+		}(command(i))
 	}
 	wg.Wait()
-	return
+
+	if failFast {
+		return firstErr
+	}
+	return errs
 }
@@ -16,7 +16,6 @@ package srv
 
 import (
 	"fmt"
-	"io/ioutil"
 	"math/rand"
 
 	"github.com/ghodss/yaml"
@@ -29,16 +28,10 @@ import (
 	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/svctype"
 )
 
-// HandlerFromServiceGraphYAML makes a handler to emulate the service with name
-// serviceName in the service graph represented by the YAML file at path.
-func HandlerFromServiceGraphYAML(
-	path string, serviceName string) (Handler, error) {
-
-	serviceGraph, err := serviceGraphFromYAMLFile(path)
-	if err != nil {
-		return Handler{}, err
-	}
-
+// handlerFromServiceGraph makes a handler to emulate the service with name
+// serviceName in serviceGraph.
+func handlerFromServiceGraph(
+	serviceGraph graph.ServiceGraph, serviceName string) (Handler, error) {
 	service, err := extractService(serviceGraph, serviceName)
 	if err != nil {
 		return Handler{}, err
@@ -46,16 +39,14 @@ func HandlerFromServiceGraphYAML(
 	_ = logService(service)
 
 	serviceTypes := extractServiceTypes(serviceGraph)
-
-	responsePayload, err := makeRandomByteArray(service.ResponseSize)
-	if err != nil {
-		return Handler{}, err
-	}
+	endpoints := extractEndpoints(serviceGraph)
 
 	return Handler{
-		Service:         service,
-		ServiceTypes:    serviceTypes,
-		responsePayload: responsePayload,
+		Service:      service,
+		ServiceTypes: serviceTypes,
+		Endpoints:    endpoints,
+		payloads:     &payloads{},
+		limiter:      newLimiter(service.Capacity),
 	}, nil
 }
 
@@ -78,13 +69,10 @@ func logService(service svc.Service) error {
 	return nil
 }
 
-// serviceGraphFromYAMLFile unmarshals the ServiceGraph from the YAML at path.
-func serviceGraphFromYAMLFile(
-	path string) (serviceGraph graph.ServiceGraph, err error) {
-	graphYAML, err := ioutil.ReadFile(path)
-	if err != nil {
-		return
-	}
+// serviceGraphFromYAML unmarshals and validates the ServiceGraph in
+// graphYAML.
+func serviceGraphFromYAML(
+	graphYAML []byte) (serviceGraph graph.ServiceGraph, err error) {
 	log.Debugf("unmarshalling\n%s", graphYAML)
 	err = yaml.Unmarshal(graphYAML, &serviceGraph)
 	if err != nil {
@@ -118,3 +106,21 @@ func extractServiceTypes(
 	}
 	return types
 }
+
+// extractEndpoints builds a map from service name to its endpoints by name.
+func extractEndpoints(
+	serviceGraph graph.ServiceGraph) map[string]map[string]svc.Endpoint {
+	endpoints := make(
+		map[string]map[string]svc.Endpoint, len(serviceGraph.Services))
+	for _, service := range serviceGraph.Services {
+		if len(service.Endpoints) == 0 {
+			continue
+		}
+		byName := make(map[string]svc.Endpoint, len(service.Endpoints))
+		for _, e := range service.Endpoints {
+			byName[e.Name] = e
+		}
+		endpoints[service.Name] = byName
+	}
+	return endpoints
+}
@@ -0,0 +1,217 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package srv
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"istio.io/pkg/log"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/headers"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/svctype"
+	"github.com/kristofgyuracz/istio-tools/isotope/service/pkg/pb"
+	"github.com/kristofgyuracz/istio-tools/isotope/service/pkg/srv/prometheus"
+)
+
+// Invoke handles the Isotope gRPC service by emulating its Service. It runs
+// the same script as ServeHTTP, or that of the endpoint named by the request,
+// taking the headers from the incoming metadata and echoing them in the
+// outgoing metadata.
+func (h Handler) Invoke(
+	ctx context.Context, request *pb.Request) (*pb.Response, error) {
+	startTime := time.Now()
+
+	prometheus.RecordRequestReceived()
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	header := headerFromMetadata(md)
+	method, _ := grpc.Method(ctx)
+	entry := h.inboundEntry(svctype.ServiceGRPC, http.MethodPost, method,
+		header, len(request.Payload))
+	entry.Endpoint = request.Endpoint
+
+	r := h.serviceRoute()
+	if request.Endpoint != "" {
+		e, ok := h.Service.EndpointByName(request.Endpoint)
+		if !ok {
+			responseSent(
+				entry, time.Since(startTime), 0, http.StatusNotFound)
+			return nil, status.Errorf(
+				codes.NotFound, "service %s has no endpoint %s",
+				h.Service.Name, request.Endpoint)
+		}
+		r = h.endpointRoute(e)
+	}
+
+	if echoed := echoedHeader(header, h.Service.Headers); len(echoed) > 0 {
+		if err := grpc.SetHeader(ctx, metadataFromHeader(echoed)); err != nil {
+			log.Errorf("%s", err)
+		}
+	}
+	code := h.executeScript(ctx, r, headers.Data{
+		Service: h.Service.Name,
+		Method:  http.MethodPost,
+		Path:    method,
+		Header:  header,
+	}, &entry)
+
+	if code != http.StatusOK {
+		responseSent(entry, time.Since(startTime), 0, code)
+		return nil, status.Errorf(
+			grpcCodeFromHTTPStatus(code), "%s", http.StatusText(code))
+	}
+	payload := h.responseBody(header, request.Payload, r.responseSize)
+
+	stopTime := time.Now()
+	duration := stopTime.Sub(startTime)
+	responseSent(entry, duration, len(payload), code)
+
+	return &pb.Response{Payload: payload}, nil
+}
+
+// Stream handles the Isotope gRPC service by running the Service's script like
+// Invoke, then streaming the messages asked for by request.
+func (h Handler) Stream(
+	request *pb.StreamRequest, stream pb.Isotope_StreamServer) error {
+	startTime := time.Now()
+
+	prometheus.RecordRequestReceived()
+
+	ctx := stream.Context()
+	md, _ := metadata.FromIncomingContext(ctx)
+	header := headerFromMetadata(md)
+	method, _ := grpc.Method(ctx)
+	entry := h.inboundEntry(svctype.ServiceGRPC, http.MethodPost, method,
+		header, len(request.Payload))
+	spec, err := streamSpecFromRequest(request)
+	if err != nil {
+		log.Debugf("%s", err)
+		responseSent(entry, time.Since(startTime), 0, http.StatusBadRequest)
+		return status.Errorf(codes.InvalidArgument, "%s", err)
+	}
+	if echoed := echoedHeader(header, h.Service.Headers); len(echoed) > 0 {
+		if err := stream.SetHeader(metadataFromHeader(echoed)); err != nil {
+			log.Errorf("%s", err)
+		}
+	}
+	code := h.executeScript(ctx, h.serviceRoute(), headers.Data{
+		Service: h.Service.Name,
+		Method:  http.MethodPost,
+		Path:    method,
+		Header:  header,
+	}, &entry)
+
+	if code != http.StatusOK {
+		responseSent(entry, time.Since(startTime), 0, code)
+		return status.Errorf(
+			grpcCodeFromHTTPStatus(code), "%s", http.StatusText(code))
+	}
+	n, err := h.stream(ctx, spec,
+		func(message []byte) error {
+			return stream.Send(&pb.Response{Payload: message})
+		})
+	responseSent(entry, time.Since(startTime), n, code)
+	return err
+}
+
+// headerFromMetadata converts gRPC metadata, whose keys are lower case, to an
+// http.Header with canonical keys.
+func headerFromMetadata(md metadata.MD) http.Header {
+	header := make(http.Header, len(md))
+	for key, values := range md {
+		header[http.CanonicalHeaderKey(key)] = values
+	}
+	return header
+}
+
+// metadataFromHeader converts an http.Header to gRPC metadata.
+func metadataFromHeader(header http.Header) metadata.MD {
+	md := make(metadata.MD, len(header))
+	for key, values := range header {
+		md[strings.ToLower(key)] = values
+	}
+	return md
+}
+
+// grpcCodeFromHTTPStatus maps an HTTP status code to the gRPC code with the
+// closest meaning.
+func grpcCodeFromHTTPStatus(code int) codes.Code {
+	switch code {
+	case http.StatusOK:
+		return codes.OK
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case statusClientClosedRequest:
+		return codes.Canceled
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	case http.StatusInternalServerError:
+		return codes.Internal
+	default:
+		return codes.Unknown
+	}
+}
+
+// httpStatusFromGRPCCode is the inverse of grpcCodeFromHTTPStatus.
+func httpStatusFromGRPCCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.Aborted:
+		return http.StatusConflict
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Canceled:
+		return statusClientClosedRequest
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -15,21 +15,42 @@
 package srv
 
 import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"time"
 
 	"istio.io/pkg/log"
 
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/body"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/headers"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/script"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/size"
 	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/svc"
 	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/svctype"
 	"github.com/kristofgyuracz/istio-tools/isotope/service/pkg/srv/prometheus"
+	"github.com/kristofgyuracz/istio-tools/isotope/service/pkg/srv/tracing"
 )
 
-// Handler handles the default endpoint by emulating its Service.
+// statusClientClosedRequest is the non-standard status code, borrowed from
+// nginx, recorded for requests whose client went away before the script
+// completed.
+const statusClientClosedRequest = 499
+
+// Handler handles the default endpoint, and the endpoints declared by its
+// Service, by emulating its Service.
 type Handler struct {
-	Service         svc.Service
-	ServiceTypes    map[string]svctype.ServiceType
-	responsePayload []byte
+	Service      svc.Service
+	ServiceTypes map[string]svctype.ServiceType
+	// Endpoints maps the name of each service in the graph to its endpoints by
+	// name, so that calls to them use their path and method.
+	Endpoints map[string]map[string]svc.Endpoint
+	// Tracer, if set, traces each request and the steps of its script.
+	Tracer   *tracing.Tracer
+	payloads *payloads
+	limiter  *limiter
 }
 
 func (h Handler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
@@ -37,26 +58,208 @@ func (h Handler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
 
 	prometheus.RecordRequestReceived()
 
+	bytesReceived := int(request.ContentLength)
+	if bytesReceived < 0 {
+		bytesReceived = 0
+	}
+	entry := h.inboundEntry(svctype.ServiceHTTP, request.Method,
+		request.URL.Path, request.Header, bytesReceived)
+
+	r := h.serviceRoute()
+	if e, ok := h.Service.EndpointByPath(request.URL.Path); ok {
+		entry.Endpoint = e.Name
+		if e.Method != "" && e.Method != request.Method {
+			writer.Header().Set("Allow", e.Method)
+			writer.WriteHeader(http.StatusMethodNotAllowed)
+			responseSent(
+				entry, time.Since(startTime), 0, http.StatusMethodNotAllowed)
+			return
+		}
+		r = h.endpointRoute(e)
+	}
+
+	spec, isStream, err := streamSpecFromHeader(request.Header)
+	if err == nil && isStream {
+		switch script.StreamMode(spec.mode) {
+		case script.StreamChunked, script.StreamSSE, script.StreamWebSocket:
+		default:
+			err = fmt.Errorf("unknown stream mode: %s", spec.mode)
+		}
+	}
+	if err != nil {
+		log.Debugf("%s", err)
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		responseSent(entry, time.Since(startTime), 0, http.StatusBadRequest)
+		return
+	}
+
+	var requestBody []byte
+	if h.Service.ResponseBody.BodyMode() == body.Echo {
+		var err error
+		requestBody, err = ioutil.ReadAll(request.Body)
+		if err != nil {
+			log.Errorf("%s", err)
+		}
+		entry.BytesReceived = len(requestBody)
+	}
+
 	respond := func(status int) {
+		for key, values := range echoedHeader(
+			request.Header, h.Service.Headers) {
+			writer.Header()[key] = values
+		}
+		responseBody := h.responseBody(
+			request.Header, requestBody, r.responseSize)
+		if contentType := responseContentType(
+			h.Service.ResponseBody.BodyMode()); contentType != "" {
+			writer.Header().Set("Content-Type", contentType)
+		}
 		writer.WriteHeader(status)
-		if _, err := writer.Write(h.responsePayload); err != nil {
+		if _, err := writer.Write(responseBody); err != nil {
 			log.Errorf("%s", err)
 		}
 
 		stopTime := time.Now()
 		duration := stopTime.Sub(startTime)
-		prometheus.RecordResponseSent(duration, len(h.responsePayload), status)
+		responseSent(entry, duration, len(responseBody), status)
+	}
+
+	code := h.executeScript(request.Context(), r, headers.Data{
+		Service: h.Service.Name,
+		Method:  request.Method,
+		Path:    request.URL.Path,
+		Header:  request.Header,
+	}, &entry)
+	if isStream && code == http.StatusOK {
+		n := h.serveHTTPStream(writer, request, spec,
+			echoedHeader(request.Header, h.Service.Headers))
+		responseSent(entry, time.Since(startTime), n, code)
+		return
+	}
+	respond(code)
+}
+
+// route is what an inbound request is served with: the script and response
+// size of the endpoint it targets, or of the Service if it targets none.
+type route struct {
+	endpoint     string
+	script       script.Script
+	responseSize *size.Distribution
+}
+
+// serviceRoute routes to the Service's own script.
+func (h Handler) serviceRoute() route {
+	return route{
+		script:       h.Service.Script,
+		responseSize: h.Service.ResponseSize,
+	}
+}
+
+// endpointRoute routes to e, which falls back to the Service's response size.
+func (h Handler) endpointRoute(e svc.Endpoint) route {
+	r := route{
+		endpoint:     e.Name,
+		script:       e.Script,
+		responseSize: e.ResponseSize,
+	}
+	if r.responseSize == nil {
+		r.responseSize = h.Service.ResponseSize
 	}
+	return r
+}
+
+// executeScript runs each step of r's script for an inbound request with data
+// and returns the HTTP status code to respond with. If the Service's Capacity
+// sheds the request, the script does not run and the shed code is returned.
+// If the Service's ErrorRate is hit, the script is cut short according to its
+// Errors and the injected error code is returned. Cancelling ctx cancels the
+// outstanding steps. The trace ID of entry is set to that of the request's
+// server span.
+func (h Handler) executeScript(
+	ctx context.Context,
+	r route,
+	data headers.Data,
+	entry *accessLogEntry) (code int) {
+	defer inFlight.startInbound()()
+
+	ctx = tracing.ContextWithSpanContext(ctx, tracing.Extract(data.Header))
+	ctx, span := h.Tracer.Start(ctx, h.Service.Name, tracing.SpanKindServer)
+	if sc := span.SpanContext(); sc.IsValid() {
+		entry.TraceID = sc.TraceID.String()
+	}
+	span.SetAttribute("http.method", data.Method)
+	span.SetAttribute("http.target", data.Path)
+	if r.endpoint != "" {
+		span.SetAttribute("isotope.endpoint", r.endpoint)
+	}
+	defer func() {
+		span.SetAttribute("http.status_code", code)
+		span.End()
+	}()
 
-	for _, step := range h.Service.Script {
-		forwardableHeader := extractForwardableHeader(request.Header)
-		err := execute(step, forwardableHeader, h.ServiceTypes)
+	release, err := h.limiter.admit(ctx)
+	if err != nil {
+		span.SetError(err)
+		if shed, ok := err.(shedError); ok {
+			log.Debugf("%s", err)
+			return shed.code
+		}
+		log.Debugf("request cancelled while queued: %s", err)
+		if err == context.DeadlineExceeded {
+			return http.StatusGatewayTimeout
+		}
+		return statusClientClosedRequest
+	}
+	defer release()
+
+	steps := r.script
+	injectedCode := h.pickInjectedErrorCode()
+	if injectedCode != 0 {
+		steps = steps[:h.Service.Errors.NumStepsBeforeAbort(len(steps))]
+	}
+
+	e := executor{
+		requestData:       data,
+		headerPolicy:      h.Service.Headers,
+		forwardableHeader: forwardedHeader(data.Header, h.Service.Headers),
+		serviceTypes:      h.ServiceTypes,
+		endpoints:         h.Endpoints,
+		tracer:            h.Tracer,
+	}
+	for i, step := range steps {
+		e.step = i
+		stepStartTime := time.Now()
+		err := e.execute(ctx, step)
+		prometheus.RecordStepExecuted(
+			i, commandKind(step), time.Since(stepStartTime))
 		if err != nil {
+			span.SetError(err)
+			switch ctx.Err() {
+			case context.Canceled:
+				log.Debugf("request cancelled: %s", err)
+				return statusClientClosedRequest
+			case context.DeadlineExceeded:
+				log.Debugf("request deadline exceeded: %s", err)
+				return http.StatusGatewayTimeout
+			}
 			log.Errorf("%s", err)
-			respond(http.StatusInternalServerError)
-			return
+			return http.StatusInternalServerError
 		}
 	}
 
-	respond(http.StatusOK)
+	if injectedCode != 0 {
+		span.SetAttribute("isotope.injected_error", true)
+		prometheus.RecordErrorInjected(injectedCode)
+		return injectedCode
+	}
+	return http.StatusOK
+}
+
+// pickInjectedErrorCode returns the error code to respond with if the
+// Service's ErrorRate is hit, or 0 otherwise.
+func (h Handler) pickInjectedErrorCode() int {
+	if rand.Float64() >= float64(h.Service.ErrorRate) {
+		return 0
+	}
+	return h.Service.Errors.PickCode()
 }
@@ -16,33 +16,113 @@ package srv
 
 import (
 	"net/http"
-)
+	"net/url"
+	"strings"
 
-var (
-	forwardableHeaders = []string{
-		"X-Request-Id",
-		"X-B3-Traceid",
-		"X-B3-Spanid",
-		"X-B3-Parentspanid",
-		"X-B3-Sampled",
-		"X-B3-Flags",
-		"X-Ot-Span-Context",
-	}
-	forwardableHeadersSet = make(map[string]bool, len(forwardableHeaders))
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/headers"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/script"
+	"github.com/kristofgyuracz/istio-tools/isotope/service/pkg/srv/tracing"
 )
 
-func init() {
-	for _, key := range forwardableHeaders {
-		forwardableHeadersSet[key] = true
+// forwardableHeaders are forwarded to every call unless the Service's header
+// policy lists others.
+var forwardableHeaders = append([]string{
+	"X-Request-Id",
+	"X-Ot-Span-Context",
+}, tracing.Headers...)
+
+// forwardedHeader returns the headers of inbound which are forwarded to every
+// call.
+func forwardedHeader(inbound http.Header, policy *headers.Policy) http.Header {
+	names := forwardableHeaders
+	if policy != nil && policy.Forward != nil {
+		names = policy.Forward
+	}
+	return extractHeader(inbound, names)
+}
+
+// echoedHeader returns the headers of inbound which are copied into the
+// response.
+func echoedHeader(inbound http.Header, policy *headers.Policy) http.Header {
+	if policy == nil {
+		return nil
 	}
+	return extractHeader(inbound, policy.Echo)
 }
 
-func extractForwardableHeader(header http.Header) http.Header {
-	forwardableHeader := make(http.Header, len(forwardableHeaders))
-	for key := range forwardableHeadersSet {
+// extractHeader returns the headers of header with the given canonical names.
+func extractHeader(header http.Header, names []string) http.Header {
+	extracted := make(http.Header, len(names))
+	for _, key := range names {
 		if values, ok := header[key]; ok {
-			forwardableHeader[key] = values
+			extracted[key] = values
+		}
+	}
+	return extracted
+}
+
+// callTarget returns the path and query of cmd's call, rendered for the
+// inbound request. Calls to an endpoint use its path. The path is escaped, so
+// that the values it renders cannot add a query or fragment.
+func (e executor) callTarget(cmd script.RequestCommand) (string, error) {
+	data := e.requestData
+	data.Destination = cmd.ServiceName
+	path := "/"
+	if cmd.Endpoint != "" {
+		path = e.endpoints[cmd.ServiceName][cmd.Endpoint].Path
+	} else if cmd.Path != nil {
+		var err error
+		path, err = cmd.Path.Execute(data)
+		if err != nil {
+			return "", err
+		}
+		if !strings.HasPrefix(path, "/") {
+			return "", script.InvalidPathError{Path: path}
+		}
+	}
+	target := (&url.URL{Path: path}).EscapedPath()
+	if len(cmd.Query) == 0 {
+		return target, nil
+	}
+	query := make(url.Values, len(cmd.Query))
+	for key, value := range cmd.Query {
+		s, err := value.Execute(data)
+		if err != nil {
+			return "", err
+		}
+		query.Set(key, s)
+	}
+	return target + "?" + query.Encode(), nil
+}
+
+// callMethod returns the HTTP method of cmd's call: its own if set, or else
+// that of the endpoint it calls.
+func (e executor) callMethod(cmd script.RequestCommand) string {
+	if cmd.Method != "" || cmd.Endpoint == "" {
+		return cmd.Method
+	}
+	return e.endpoints[cmd.ServiceName][cmd.Endpoint].Method
+}
+
+// callHeader returns the header of a call to destName: the forwarded headers,
+// overlaid with the headers set by the Service's policy.
+func (e executor) callHeader(destName string) (http.Header, error) {
+	if e.headerPolicy == nil || len(e.headerPolicy.Set) == 0 {
+		return e.forwardableHeader, nil
+	}
+	header := make(
+		http.Header, len(e.forwardableHeader)+len(e.headerPolicy.Set))
+	for key, values := range e.forwardableHeader {
+		header[key] = values
+	}
+	data := e.requestData
+	data.Destination = destName
+	for key, value := range e.headerPolicy.Set {
+		s, err := value.Execute(data)
+		if err != nil {
+			return nil, err
 		}
+		header[key] = []string{s}
 	}
-	return forwardableHeader
+	return header, nil
 }
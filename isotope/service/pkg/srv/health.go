@@ -0,0 +1,168 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package srv
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/script"
+)
+
+// downstreamDialTimeout bounds the connection to each downstream service
+// when readiness is checked.
+const downstreamDialTimeout = time.Second
+
+// Health tracks whether the service emulated by a ReloadingHandler is ready
+// to serve, and serves the liveness and readiness probes of the kubelet.
+type Health struct {
+	handler *ReloadingHandler
+	// checkDownstream makes readiness require a connection to each service
+	// called by the script.
+	checkDownstream bool
+	ready           int32
+}
+
+// NewHealth makes a Health for the service emulated by h, which is not ready
+// until SetReady is called. If checkDownstream is true, the service is also
+// not ready while a service its scripts call cannot be connected to.
+func NewHealth(h *ReloadingHandler, checkDownstream bool) *Health {
+	return &Health{handler: h, checkDownstream: checkDownstream}
+}
+
+// SetReady sets whether the service accepts requests, i.e. whether it has
+// started listening and is not draining.
+func (s *Health) SetReady(ready bool) {
+	var v int32
+	if ready {
+		v = 1
+	}
+	atomic.StoreInt32(&s.ready, v)
+}
+
+// ServeLive responds 200 as long as the service runs, including while it
+// drains.
+func (s *Health) ServeLive(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+// ServeReady responds 200 if the service is ready, or 503 with the reason it
+// is not.
+func (s *Health) ServeReady(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if atomic.LoadInt32(&s.ready) == 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, "not ready")
+		return
+	}
+	if s.checkDownstream {
+		if unreachable := s.unreachableDownstream(); len(unreachable) > 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(w, "unreachable: %s\n", strings.Join(unreachable, ", "))
+			return
+		}
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// unreachableDownstream returns the sorted names of the services called by
+// the scripts which cannot be connected to.
+func (s *Health) unreachableDownstream() []string {
+	destNames := downstreamServices(s.handler.Handler())
+	var (
+		mutex       sync.Mutex
+		unreachable []string
+		wg          sync.WaitGroup
+	)
+	for _, destName := range destNames {
+		wg.Add(1)
+		go func(destName string) {
+			defer wg.Done()
+			conn, err := net.DialTimeout(
+				"tcp", serviceAddr(destName), downstreamDialTimeout)
+			if err != nil {
+				mutex.Lock()
+				unreachable = append(unreachable, destName)
+				mutex.Unlock()
+				return
+			}
+			conn.Close()
+		}(destName)
+	}
+	wg.Wait()
+	sort.Strings(unreachable)
+	return unreachable
+}
+
+// downstreamServices returns the names of the services called or streamed
+// from by the scripts of h's Service and of its endpoints.
+func downstreamServices(h Handler) []string {
+	seen := map[string]bool{}
+	var destNames []string
+	var visit func(cmd script.Command)
+	visit = func(cmd script.Command) {
+		var destName string
+		switch cmd := cmd.(type) {
+		case script.RequestCommand:
+			destName = cmd.ServiceName
+		case script.StreamCommand:
+			destName = cmd.ServiceName
+		case script.ConcurrentCommand:
+			for _, subCmd := range cmd.Commands {
+				visit(subCmd)
+			}
+		case script.SequenceCommand:
+			for _, subCmd := range cmd.Commands {
+				visit(subCmd)
+			}
+		case script.RepeatCommand:
+			for _, subCmd := range cmd.Script {
+				visit(subCmd)
+			}
+		case script.OneOfCommand:
+			for _, a := range cmd.Alternatives {
+				for _, subCmd := range a.Script {
+					visit(subCmd)
+				}
+			}
+		case script.SwitchCommand:
+			for _, c := range cmd.Cases {
+				for _, subCmd := range c.Script {
+					visit(subCmd)
+				}
+			}
+		}
+		if destName != "" && !seen[destName] {
+			seen[destName] = true
+			destNames = append(destNames, destName)
+		}
+	}
+	for _, cmd := range h.Service.Script {
+		visit(cmd)
+	}
+	for _, e := range h.Service.Endpoints {
+		for _, cmd := range e.Script {
+			visit(cmd)
+		}
+	}
+	return destNames
+}
@@ -0,0 +1,90 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package srv
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// inFlight counts the requests being served by this service and the calls
+// to other services awaiting their response, including retries.
+var inFlight = inFlightCounter{outbound: map[string]int{}}
+
+type inFlightCounter struct {
+	mutex    sync.Mutex
+	inbound  int
+	outbound map[string]int
+}
+
+// inFlightSnapshot is the JSON form of an inFlightCounter at an instant.
+type inFlightSnapshot struct {
+	Inbound  int            `json:"inbound"`
+	Outbound map[string]int `json:"outbound"`
+}
+
+// startInbound counts a request as being served until the returned function
+// is called.
+func (c *inFlightCounter) startInbound() (done func()) {
+	c.mutex.Lock()
+	c.inbound++
+	c.mutex.Unlock()
+	return func() {
+		c.mutex.Lock()
+		c.inbound--
+		c.mutex.Unlock()
+	}
+}
+
+// startOutbound counts a call to destName as in flight until the returned
+// function is called.
+func (c *inFlightCounter) startOutbound(destName string) (done func()) {
+	c.mutex.Lock()
+	c.outbound[destName]++
+	c.mutex.Unlock()
+	return func() {
+		c.mutex.Lock()
+		c.outbound[destName]--
+		c.mutex.Unlock()
+	}
+}
+
+// WaitIdle waits until the scripts of the requests being served have
+// completed, or until ctx is done, in which case ctx's error is returned.
+// Unlike the servers' own shutdown, it covers requests on connections taken
+// over from the HTTP server, such as HTTP/2 over plaintext.
+func WaitIdle(ctx context.Context) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for inFlight.snapshot().Inbound > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (c *inFlightCounter) snapshot() inFlightSnapshot {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	outbound := make(map[string]int, len(c.outbound))
+	for destName, n := range c.outbound {
+		outbound[destName] = n
+	}
+	return inFlightSnapshot{Inbound: c.inbound, Outbound: outbound}
+}
@@ -0,0 +1,113 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package srv
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/capacity"
+	"github.com/kristofgyuracz/istio-tools/isotope/service/pkg/srv/prometheus"
+)
+
+// Reasons for shedding requests, as recorded in metrics.
+const (
+	shedQueueFull    = "queue-full"
+	shedQueueTimeout = "queue-timeout"
+)
+
+// shedError is returned by limiter.admit when a request is shed.
+type shedError struct {
+	reason string
+	code   int
+}
+
+func (e shedError) Error() string {
+	return fmt.Sprintf("request shed (%s)", e.reason)
+}
+
+// limiter admits the requests to a service according to its Capacity. It is
+// kept across reloads which leave the Capacity unchanged.
+type limiter struct {
+	capacity capacity.Capacity
+	// slots holds a value for each request being served.
+	slots  chan struct{}
+	mutex  sync.Mutex
+	queued int
+}
+
+// newLimiter makes a limiter for c, or returns nil if c is nil.
+func newLimiter(c *capacity.Capacity) *limiter {
+	if c == nil {
+		return nil
+	}
+	return &limiter{
+		capacity: *c,
+		slots:    make(chan struct{}, c.MaxConcurrency),
+	}
+}
+
+// admit waits for a request to be served, and returns a function to call
+// once it is. A request which cannot be queued, or waits in the queue for
+// longer than the queue timeout, is shed with a shedError. If ctx is done
+// first, its error is returned. A nil limiter admits every request.
+func (l *limiter) admit(ctx context.Context) (release func(), err error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	release = func() { <-l.slots }
+	select {
+	case l.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	l.mutex.Lock()
+	if l.queued >= l.capacity.QueueLength {
+		l.mutex.Unlock()
+		return nil, l.shed(shedQueueFull)
+	}
+	l.queued++
+	l.mutex.Unlock()
+	prometheus.RecordRequestQueued()
+	defer func() {
+		l.mutex.Lock()
+		l.queued--
+		l.mutex.Unlock()
+		prometheus.RecordRequestDequeued()
+	}()
+
+	var timeout <-chan time.Time
+	if l.capacity.QueueTimeout > 0 {
+		timer := time.NewTimer(time.Duration(l.capacity.QueueTimeout))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return release, nil
+	case <-timeout:
+		return nil, l.shed(shedQueueTimeout)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (l *limiter) shed(reason string) error {
+	prometheus.RecordRequestShed(reason)
+	return shedError{reason: reason, code: l.capacity.Code()}
+}
@@ -0,0 +1,166 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package srv
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/capacity"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/duration"
+)
+
+// admitQueued admits a request to l in the background, once l serves as many
+// requests as it can, and returns the result once l has queued it.
+func admitQueued(ctx context.Context, l *limiter) <-chan error {
+	l.mutex.Lock()
+	queued := l.queued
+	l.mutex.Unlock()
+	errs := make(chan error, 1)
+	go func() {
+		release, err := l.admit(ctx)
+		if err == nil {
+			release()
+		}
+		errs <- err
+	}()
+	for {
+		l.mutex.Lock()
+		n := l.queued
+		l.mutex.Unlock()
+		if n > queued {
+			return errs
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLimiter_Nil(t *testing.T) {
+	t.Parallel()
+
+	l := newLimiter(nil)
+	if l != nil {
+		t.Fatalf("expected no limiter without a capacity; actual %v", l)
+	}
+	release, err := l.admit(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+}
+
+func TestLimiter_QueueFull(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		capacity capacity.Capacity
+		code     int
+	}{
+		{
+			capacity.Capacity{MaxConcurrency: 1},
+			http.StatusServiceUnavailable,
+		},
+		{
+			capacity.Capacity{
+				MaxConcurrency: 1,
+				QueueLength:    1,
+				ShedCode:       http.StatusTooManyRequests,
+			},
+			http.StatusTooManyRequests,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			l := newLimiter(&test.capacity)
+			ctx := context.Background()
+			release, err := l.admit(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			queued := make([]<-chan error, test.capacity.QueueLength)
+			for i := range queued {
+				queued[i] = admitQueued(ctx, l)
+			}
+
+			expected := shedError{reason: shedQueueFull, code: test.code}
+			if _, err := l.admit(ctx); err != expected {
+				t.Errorf("expected %v; actual %v", expected, err)
+			}
+
+			release()
+			for _, errs := range queued {
+				if err := <-errs; err != nil {
+					t.Errorf("expected the queued request to be admitted; actual %v",
+						err)
+				}
+			}
+		})
+	}
+}
+
+func TestLimiter_QueueTimeout(t *testing.T) {
+	t.Parallel()
+
+	l := newLimiter(&capacity.Capacity{
+		MaxConcurrency: 1,
+		QueueLength:    1,
+		QueueTimeout:   duration.Duration(20 * time.Millisecond),
+	})
+	ctx := context.Background()
+	release, err := l.admit(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	start := time.Now()
+	expected := shedError{
+		reason: shedQueueTimeout,
+		code:   http.StatusServiceUnavailable,
+	}
+	if err := <-admitQueued(ctx, l); err != expected {
+		t.Errorf("expected %v; actual %v", expected, err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("expected to wait for the queue timeout; waited %s", elapsed)
+	}
+	if l.queued != 0 {
+		t.Errorf("expected the shed request to leave the queue")
+	}
+}
+
+func TestLimiter_ContextDone(t *testing.T) {
+	t.Parallel()
+
+	l := newLimiter(&capacity.Capacity{MaxConcurrency: 1, QueueLength: 1})
+	release, err := l.admit(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := admitQueued(ctx, l)
+	cancel()
+	if err := <-errs; err != context.Canceled {
+		t.Errorf("expected %v; actual %v", context.Canceled, err)
+	}
+}
@@ -23,15 +23,23 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// DefaultDurationBuckets are the buckets of duration histograms, in seconds,
+// unless others are passed to Handler.
+var DefaultDurationBuckets = []float64{
+	0.0005, 0.001, 0.002, 0.003, 0.004, 0.005, 0.006,
+	0.007, 0.008, 0.009, 0.01, 0.011, 0.012, 0.014, 0.016, 0.018, 0.02, 0.025,
+	0.03, 0.035, 0.04, 0.045, 0.05, 0.06, 0.07, 0.08, 0.09, 0.1, 0.12, 0.14,
+	0.16, 0.18, 0.2, 0.25, 0.3, 0.35, 0.4, 0.45, 0.5, 0.75, 1, 2.5, 5, 10}
+
 var (
-	durationBuckets = []float64{
-		0.007, 0.008, 0.009, 0.01, 0.011, 0.012, 0.014, 0.016, 0.018, 0.02, 0.025,
-		0.03, 0.035, 0.04, 0.045, 0.05, 0.06, 0.07, 0.08, 0.09, 0.1, 0.12, 0.14,
-		0.16, 0.18, 0.2, 0.25, 0.3, 0.35, 0.4, 0.45, 0.5}
 	sizeBuckets = []float64{
 		// 1, 10, 100, 1,000, ..., 1,000,000,000
 		1e+00, 1e+01, 1e+02, 1e+03, 1e+04, 1e+05, 1e+06, 1e+07, 1e+08, 1e+09}
 
+	// streamDurationBuckets span 10ms to about 22 minutes, since streams
+	// outlast requests by far.
+	streamDurationBuckets = prom.ExponentialBuckets(0.01, 2, 18)
+
 	serviceIncomingRequestsTotal = prom.NewCounter(
 		prom.CounterOpts{
 			Name: "service_incoming_requests_total",
@@ -41,7 +49,19 @@ var (
 	serviceOutgoingRequestsTotal = prom.NewCounterVec(
 		prom.CounterOpts{
 			Name: "service_outgoing_requests_total",
-			Help: "Number of requests sent from this service.",
+			Help: "Number of requests sent from this service, excluding retries.",
+		}, []string{"destination_service"})
+
+	serviceOutgoingRequestAttemptsTotal = prom.NewCounterVec(
+		prom.CounterOpts{
+			Name: "service_outgoing_request_attempts_total",
+			Help: "Number of attempts, including retries, of requests sent from this service.",
+		}, []string{"destination_service", "outcome"})
+
+	serviceOutgoingConnectionsTotal = prom.NewCounterVec(
+		prom.CounterOpts{
+			Name: "service_outgoing_connections_total",
+			Help: "Number of connections opened by this service to other services.",
 		}, []string{"destination_service"})
 
 	serviceOutgoingRequestSize = prom.NewHistogramVec(
@@ -51,31 +71,136 @@ var (
 			Buckets: sizeBuckets,
 		}, []string{"destination_service"})
 
-	serviceRequestDurationSeconds = prom.NewHistogramVec(
-		prom.HistogramOpts{
-			Name:    "service_request_duration_seconds",
-			Help:    "Duration in seconds it took to serve requests to this service.",
-			Buckets: durationBuckets,
-		}, []string{"code"})
-
 	serviceResponseSize = prom.NewHistogramVec(
 		prom.HistogramOpts{
 			Name:    "service_response_size",
 			Help:    "Size in bytes of responses sent from this service.",
 			Buckets: sizeBuckets,
 		}, []string{"code"})
+
+	serviceInjectedErrorsTotal = prom.NewCounterVec(
+		prom.CounterOpts{
+			Name: "service_injected_errors_total",
+			Help: "Number of errors injected by this service's error rate.",
+		}, []string{"code"})
+
+	serviceIncomingStreamMessagesTotal = prom.NewCounterVec(
+		prom.CounterOpts{
+			Name: "service_incoming_stream_messages_total",
+			Help: "Number of messages streamed by this service to its callers.",
+		}, []string{"mode"})
+
+	serviceIncomingStreamDurationSeconds = prom.NewHistogramVec(
+		prom.HistogramOpts{
+			Name:    "service_incoming_stream_duration_seconds",
+			Help:    "Duration in seconds of streams served by this service, after its script.",
+			Buckets: streamDurationBuckets,
+		}, []string{"mode"})
+
+	serviceOutgoingStreamMessagesTotal = prom.NewCounterVec(
+		prom.CounterOpts{
+			Name: "service_outgoing_stream_messages_total",
+			Help: "Number of messages received on streams opened by this service.",
+		}, []string{"destination_service", "mode"})
+
+	serviceOutgoingStreamDurationSeconds = prom.NewHistogramVec(
+		prom.HistogramOpts{
+			Name:    "service_outgoing_stream_duration_seconds",
+			Help:    "Duration in seconds of streams opened by this service.",
+			Buckets: streamDurationBuckets,
+		}, []string{"destination_service", "mode"})
+
+	serviceQueuedRequests = prom.NewGauge(
+		prom.GaugeOpts{
+			Name: "service_queued_requests",
+			Help: "Number of requests waiting for this service's capacity to serve them.",
+		})
+
+	serviceShedRequestsTotal = prom.NewCounterVec(
+		prom.CounterOpts{
+			Name: "service_shed_requests_total",
+			Help: "Number of requests shed by this service's capacity.",
+		}, []string{"reason"})
+
+	serviceConfigGeneration = prom.NewGauge(
+		prom.GaugeOpts{
+			Name: "service_config_generation",
+			Help: "Generation of the service graph in use, counting from 1 " +
+				"and incremented by each reload.",
+		})
+
+	serviceConfigReloadFailuresTotal = prom.NewCounter(
+		prom.CounterOpts{
+			Name: "service_config_reload_failures_total",
+			Help: "Number of changes to the service graph which were rejected.",
+		})
+
+	// The duration histograms are replaced by Handler to observe its buckets.
+	serviceRequestDurationSeconds,
+	serviceOutgoingRequestDurationSeconds,
+	serviceStepDurationSeconds = newDurationHistograms(DefaultDurationBuckets)
 )
 
+func newDurationHistograms(buckets []float64) (
+	request *prom.HistogramVec,
+	outgoingRequest *prom.HistogramVec,
+	step *prom.HistogramVec) {
+	request = prom.NewHistogramVec(
+		prom.HistogramOpts{
+			Name:    "service_request_duration_seconds",
+			Help:    "Duration in seconds it took to serve requests to this service.",
+			Buckets: buckets,
+		}, []string{"code"})
+	outgoingRequest = prom.NewHistogramVec(
+		prom.HistogramOpts{
+			Name:    "service_outgoing_request_duration_seconds",
+			Help:    "Duration in seconds of each attempt of requests sent from this service.",
+			Buckets: buckets,
+		}, []string{"destination_service", "code"})
+	step = prom.NewHistogramVec(
+		prom.HistogramOpts{
+			Name:    "service_step_duration_seconds",
+			Help:    "Duration in seconds of each step of this service's script.",
+			Buckets: buckets,
+		}, []string{"step", "command"})
+	return
+}
+
 // Handler returns an http.Handler which should be attached to a "/metrics"
-// endpoint for Prometheus to ingest.
-func Handler() http.Handler {
+// endpoint for Prometheus to ingest. Durations are observed in
+// durationBuckets, in seconds, or DefaultDurationBuckets if it is empty. It
+// must be called once, before any metric is recorded.
+func Handler(durationBuckets []float64) http.Handler {
+	if len(durationBuckets) > 0 {
+		serviceRequestDurationSeconds,
+			serviceOutgoingRequestDurationSeconds,
+			serviceStepDurationSeconds = newDurationHistograms(durationBuckets)
+	}
+
 	prom.MustRegister(serviceIncomingRequestsTotal)
 
 	prom.MustRegister(serviceOutgoingRequestsTotal)
+	prom.MustRegister(serviceOutgoingRequestAttemptsTotal)
 	prom.MustRegister(serviceOutgoingRequestSize)
+	prom.MustRegister(serviceOutgoingConnectionsTotal)
+	prom.MustRegister(serviceOutgoingRequestDurationSeconds)
 
 	prom.MustRegister(serviceRequestDurationSeconds)
 	prom.MustRegister(serviceResponseSize)
+	prom.MustRegister(serviceStepDurationSeconds)
+
+	prom.MustRegister(serviceIncomingStreamMessagesTotal)
+	prom.MustRegister(serviceIncomingStreamDurationSeconds)
+	prom.MustRegister(serviceOutgoingStreamMessagesTotal)
+	prom.MustRegister(serviceOutgoingStreamDurationSeconds)
+
+	prom.MustRegister(serviceQueuedRequests)
+	prom.MustRegister(serviceShedRequestsTotal)
+
+	prom.MustRegister(serviceConfigGeneration)
+	prom.MustRegister(serviceConfigReloadFailuresTotal)
+
+	prom.MustRegister(serviceInjectedErrorsTotal)
 
 	return promhttp.Handler()
 }
@@ -87,13 +212,38 @@ func RecordRequestReceived() {
 }
 
 // RecordRequestSent increments the Prometheus counter for outgoing requests
-// and records an outgoing request size.
+// and records an outgoing request size. A request is recorded once, however
+// many attempts it took.
 func RecordRequestSent(destinationService string, size uint64) {
 	serviceOutgoingRequestsTotal.WithLabelValues(destinationService).Inc()
 	serviceOutgoingRequestSize.WithLabelValues(destinationService).Observe(
 		float64(size))
 }
 
+// RecordRequestAttempt increments the Prometheus counter for attempts of
+// outgoing requests and observes their duration with their outcome: the HTTP
+// status code of the response or the kind of connection failure.
+func RecordRequestAttempt(
+	destinationService string, outcome string, duration time.Duration) {
+	serviceOutgoingRequestAttemptsTotal.WithLabelValues(
+		destinationService, outcome).Inc()
+	serviceOutgoingRequestDurationSeconds.WithLabelValues(
+		destinationService, outcome).Observe(duration.Seconds())
+}
+
+// RecordConnectionOpened increments the Prometheus counter for connections
+// opened to destinationService.
+func RecordConnectionOpened(destinationService string) {
+	serviceOutgoingConnectionsTotal.WithLabelValues(destinationService).Inc()
+}
+
+// RecordStepExecuted observes the duration of the step with index step of the
+// script, whose command is of the given kind (e.g. "call").
+func RecordStepExecuted(step int, command string, duration time.Duration) {
+	serviceStepDurationSeconds.WithLabelValues(
+		strconv.Itoa(step), command).Observe(duration.Seconds())
+}
+
 // RecordResponseSent observes the time-to-response duration and size for the
 // HTTP status code.
 func RecordResponseSent(duration time.Duration, size int, code int) {
@@ -102,3 +252,59 @@ func RecordResponseSent(duration time.Duration, size int, code int) {
 		duration.Seconds())
 	serviceResponseSize.WithLabelValues(strCode).Observe(float64(size))
 }
+
+// RecordStreamServed counts the messages of a stream served in mode (e.g.
+// "sse") and observes its duration.
+func RecordStreamServed(mode string, messages int, duration time.Duration) {
+	serviceIncomingStreamMessagesTotal.WithLabelValues(mode).Add(
+		float64(messages))
+	serviceIncomingStreamDurationSeconds.WithLabelValues(mode).Observe(
+		duration.Seconds())
+}
+
+// RecordStreamReceived counts the messages of a stream received from
+// destinationService in mode and observes its duration.
+func RecordStreamReceived(
+	destinationService string, mode string, messages int,
+	duration time.Duration) {
+	serviceOutgoingStreamMessagesTotal.WithLabelValues(
+		destinationService, mode).Add(float64(messages))
+	serviceOutgoingStreamDurationSeconds.WithLabelValues(
+		destinationService, mode).Observe(duration.Seconds())
+}
+
+// RecordErrorInjected increments the Prometheus counter for errors injected
+// with the HTTP status code.
+func RecordErrorInjected(code int) {
+	serviceInjectedErrorsTotal.WithLabelValues(strconv.Itoa(code)).Inc()
+}
+
+// RecordRequestQueued increments the Prometheus gauge for requests waiting
+// to be served.
+func RecordRequestQueued() {
+	serviceQueuedRequests.Inc()
+}
+
+// RecordRequestDequeued decrements the Prometheus gauge for requests waiting
+// to be served.
+func RecordRequestDequeued() {
+	serviceQueuedRequests.Dec()
+}
+
+// RecordRequestShed increments the Prometheus counter for requests shed for
+// reason.
+func RecordRequestShed(reason string) {
+	serviceShedRequestsTotal.WithLabelValues(reason).Inc()
+}
+
+// RecordConfigGeneration sets the Prometheus gauge for the generation of the
+// service graph in use.
+func RecordConfigGeneration(generation int) {
+	serviceConfigGeneration.Set(float64(generation))
+}
+
+// RecordConfigReloadFailed increments the Prometheus counter for rejected
+// changes to the service graph.
+func RecordConfigReloadFailed() {
+	serviceConfigReloadFailuresTotal.Inc()
+}
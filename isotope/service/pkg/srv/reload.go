@@ -0,0 +1,200 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package srv
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"istio.io/pkg/log"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph"
+	"github.com/kristofgyuracz/istio-tools/isotope/service/pkg/pb"
+	"github.com/kristofgyuracz/istio-tools/isotope/service/pkg/srv/prometheus"
+	"github.com/kristofgyuracz/istio-tools/isotope/service/pkg/srv/tracing"
+)
+
+// ReloadingHandler emulates a service with the Handler built from the latest
+// valid version of a service graph file. Requests in flight keep the Handler
+// they started with.
+type ReloadingHandler struct {
+	path        string
+	serviceName string
+
+	// current holds the current generation.
+	current atomic.Value
+
+	// reloadMutex serializes reloads and guards graphYAML, the contents of
+	// the file last read.
+	reloadMutex sync.Mutex
+	graphYAML   []byte
+}
+
+// generation is a version of the service graph and the Handler built from
+// it.
+type generation struct {
+	number       int
+	serviceGraph graph.ServiceGraph
+	handler      Handler
+}
+
+// NewReloadingHandler makes a handler to emulate the service with name
+// serviceName in the service graph represented by the YAML file at path,
+// traced by tracer if it is set. The file is read again by Watch.
+func NewReloadingHandler(
+	path string,
+	serviceName string,
+	tracer *tracing.Tracer) (*ReloadingHandler, error) {
+	graphYAML, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	serviceGraph, err := serviceGraphFromYAML(graphYAML)
+	if err != nil {
+		return nil, err
+	}
+	handler, err := handlerFromServiceGraph(serviceGraph, serviceName)
+	if err != nil {
+		return nil, err
+	}
+	handler.Tracer = tracer
+
+	h := &ReloadingHandler{
+		path:        path,
+		serviceName: serviceName,
+		graphYAML:   graphYAML,
+	}
+	h.use(generation{1, serviceGraph, handler})
+	return h, nil
+}
+
+func (h *ReloadingHandler) use(g generation) {
+	h.current.Store(g)
+	prometheus.RecordConfigGeneration(g.number)
+	log.Infof("using service graph generation %d", g.number)
+}
+
+func (h *ReloadingHandler) currentGeneration() generation {
+	return h.current.Load().(generation)
+}
+
+// Handler returns the current Handler.
+func (h *ReloadingHandler) Handler() Handler {
+	return h.currentGeneration().handler
+}
+
+// ServiceGraph returns the current service graph.
+func (h *ReloadingHandler) ServiceGraph() graph.ServiceGraph {
+	return h.currentGeneration().serviceGraph
+}
+
+// Generation returns the number of the current version of the service graph,
+// counting from 1 at startup.
+func (h *ReloadingHandler) Generation() int {
+	return h.currentGeneration().number
+}
+
+func (h *ReloadingHandler) ServeHTTP(
+	writer http.ResponseWriter, request *http.Request) {
+	h.Handler().ServeHTTP(writer, request)
+}
+
+// Invoke handles the Isotope gRPC service with the current Handler.
+func (h *ReloadingHandler) Invoke(
+	ctx context.Context, request *pb.Request) (*pb.Response, error) {
+	return h.Handler().Invoke(ctx, request)
+}
+
+// Stream handles the streaming method of the Isotope gRPC service with the
+// current Handler.
+func (h *ReloadingHandler) Stream(
+	request *pb.StreamRequest, stream pb.Isotope_StreamServer) error {
+	return h.Handler().Stream(request, stream)
+}
+
+// Watch reads the service graph file every interval until ctx is done, and
+// swaps in a new Handler each time it changes to a valid service graph.
+// Invalid service graphs are logged and counted, and the current Handler is
+// kept.
+func (h *ReloadingHandler) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := h.Reload(); err != nil {
+				prometheus.RecordConfigReloadFailed()
+				log.Errorf("keeping service graph generation %d: %s",
+					h.Generation(), err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Reload reads the service graph file and, if it has changed, swaps in a new
+// Handler built from it. The tracer and response buffers of the current
+// Handler are carried over. A service graph which changes the type of the
+// service is rejected, since the server cannot switch protocols.
+func (h *ReloadingHandler) Reload() error {
+	h.reloadMutex.Lock()
+	defer h.reloadMutex.Unlock()
+
+	graphYAML, err := ioutil.ReadFile(h.path)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(graphYAML, h.graphYAML) {
+		return nil
+	}
+	// Remember the file even if it is invalid, so that it is reported once.
+	h.graphYAML = graphYAML
+
+	serviceGraph, err := serviceGraphFromYAML(graphYAML)
+	if err != nil {
+		return err
+	}
+	next, err := handlerFromServiceGraph(serviceGraph, h.serviceName)
+	if err != nil {
+		return err
+	}
+	current := h.Handler()
+	if next.Service.Type != current.Service.Type {
+		return fmt.Errorf(
+			"cannot change the type of service %s from %s to %s without "+
+				"restarting", h.serviceName, current.Service.Type,
+			next.Service.Type)
+	}
+	if !reflect.DeepEqual(
+		next.Service.LatencyBuckets, current.Service.LatencyBuckets) {
+		log.Warnf("latency buckets take effect after restarting")
+	}
+	next.Tracer = current.Tracer
+	next.payloads = current.payloads
+	if reflect.DeepEqual(next.Service.Capacity, current.Service.Capacity) {
+		next.limiter = current.limiter
+	}
+
+	h.use(generation{h.Generation() + 1, serviceGraph, next})
+	return nil
+}
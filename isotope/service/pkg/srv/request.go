@@ -16,36 +16,185 @@ package srv
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
 	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/http2"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/stats"
 
 	"istio.io/pkg/log"
 
 	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/consts"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/script"
 	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/size"
+	"github.com/kristofgyuracz/istio-tools/isotope/service/pkg/pb"
+	"github.com/kristofgyuracz/istio-tools/isotope/service/pkg/srv/prometheus"
 )
 
-func sendRequest(
+// dialTimeout bounds connecting to another service, unless the connection
+// pool of the call sets another timeout, like http.DefaultTransport does.
+const dialTimeout = 30 * time.Second
+
+var (
+	// grpcClients caches a gRPC client per destination service and connection
+	// pool so that its underlying HTTP/2 connection is reused across
+	// requests.
+	grpcClients      = map[clientKey]pb.IsotopeClient{}
+	grpcClientsMutex sync.Mutex
+
+	// httpClients caches a client per destination service, protocol and
+	// connection pool, so that each has connections of its own.
+	httpClients      = map[clientKey]*http.Client{}
+	httpClientsMutex sync.Mutex
+
+	// scheme, grpcTransportOption and clientTLSConfig are changed by
+	// UseClientTLS.
+	scheme              = "http"
+	grpcTransportOption = grpc.WithInsecure()
+	clientTLSConfig     *tls.Config
+
+	// addrs maps service names to the addresses they are reached at, as set
+	// by UseAddresses.
+	addrs      map[string]string
+	addrsMutex sync.RWMutex
+)
+
+// clientKey identifies the clients of calls, and thereby the connections
+// they share.
+type clientKey struct {
+	destName string
+	protocol script.Protocol
+	// pool has no KeepAlive, which keepAlive holds by value for the key to
+	// compare equal across calls.
+	pool      script.ConnectionPool
+	keepAlive bool
+}
+
+// newClientKey identifies the client of calls to destName over protocol with
+// pool, which may be nil.
+func newClientKey(
 	destName string,
-	size size.ByteSize,
-	requestHeader http.Header) (*http.Response, error) {
-	url := fmt.Sprintf("http://%s:%v", destName, consts.ServicePort)
-	request, err := buildRequest(url, size, requestHeader)
+	protocol script.Protocol,
+	pool *script.ConnectionPool) clientKey {
+	key := clientKey{destName: destName, protocol: protocol, keepAlive: true}
+	if pool != nil {
+		key.pool = *pool
+		key.keepAlive = pool.KeepsAlive()
+		key.pool.KeepAlive = nil
+	}
+	return key
+}
+
+// dialContext returns a function which connects to addr for the client
+// identified by key, within the connect timeout of its pool, and counts the
+// connections it opens.
+func (key clientKey) dialContext() func(
+	ctx context.Context, network string, addr string) (net.Conn, error) {
+	timeout := time.Duration(key.pool.ConnectTimeout)
+	if timeout == 0 {
+		timeout = dialTimeout
+	}
+	dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+	return func(
+		ctx context.Context, network string, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		prometheus.RecordConnectionOpened(key.destName)
+		log.Debugf("opened connection to %s (%s)", key.destName, addr)
+		return conn, nil
+	}
+}
+
+// UseClientTLS makes calls to other services over TLS with config. It must be
+// called before handling any request.
+func UseClientTLS(config *tls.Config) {
+	scheme = "https"
+	http.DefaultTransport.(*http.Transport).TLSClientConfig = config
+	grpcTransportOption = grpc.WithTransportCredentials(
+		credentials.NewTLS(config))
+	clientTLSConfig = config
+}
+
+// UseAddresses makes calls to the services named in serviceAddrs go to their
+// address ("host:port") in it, instead of to the service port of their name
+// resolved through DNS. It replaces the addresses of any previous call.
+func UseAddresses(serviceAddrs map[string]string) {
+	addrsMutex.Lock()
+	defer addrsMutex.Unlock()
+	addrs = serviceAddrs
+}
+
+// serviceAddr returns the address destName is reached at.
+func serviceAddr(destName string) string {
+	addrsMutex.RLock()
+	addr, ok := addrs[destName]
+	addrsMutex.RUnlock()
+	if ok {
+		return addr
+	}
+	return fmt.Sprintf("%s:%v", destName, consts.ServicePort)
+}
+
+// httpCall describes an HTTP request to another service.
+type httpCall struct {
+	destName string
+	// method defaults to GET.
+	method string
+	// target is the path and query of the request.
+	target     string
+	protocol   script.Protocol
+	connection script.Connection
+	pool       *script.ConnectionPool
+	size       size.ByteSize
+	header     http.Header
+}
+
+func sendRequest(ctx context.Context, call httpCall) (*http.Response, error) {
+	key := newClientKey(call.destName, call.protocol, call.pool)
+	client, err := httpClient(key)
+	if err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf(
+		"%s://%s%s", scheme, serviceAddr(call.destName), call.target)
+	request, err := buildRequest(ctx, call.method, url, call.size, call.header)
 	if err != nil {
 		return nil, err
 	}
-	log.Debugf("sending request to %s (%s)", destName, url)
-	return http.DefaultClient.Do(request)
+	// Closing the connection after the response keeps it from being reused.
+	request.Close = call.connection == script.ConnectionNew || !key.keepAlive
+	log.Debugf("sending %s request to %s (%s)",
+		request.Method, call.destName, url)
+	return client.Do(request)
 }
 
 func buildRequest(
-	url string, size size.ByteSize, requestHeader http.Header) (
-	*http.Request, error) {
+	ctx context.Context,
+	method string,
+	url string,
+	size size.ByteSize,
+	requestHeader http.Header) (*http.Request, error) {
 	payload, err := makeRandomByteArray(size)
 	if err != nil {
 		return nil, err
 	}
-	request, err := http.NewRequest("GET", url, bytes.NewBuffer(payload))
+	if method == "" {
+		method = http.MethodGet
+	}
+	request, err := http.NewRequestWithContext(
+		ctx, method, url, bytes.NewBuffer(payload))
 	if err != nil {
 		return nil, err
 	}
@@ -58,3 +207,186 @@ func copyHeader(request *http.Request, header http.Header) {
 		request.Header[key] = values
 	}
 }
+
+// httpClient returns the client identified by key. Its transport is a clone
+// of http.DefaultTransport, configured by the key's pool, unless the key's
+// protocol is HTTP/2, whose calls share a single connection.
+func httpClient(key clientKey) (*http.Client, error) {
+	httpClientsMutex.Lock()
+	defer httpClientsMutex.Unlock()
+	if client, ok := httpClients[key]; ok {
+		return client, nil
+	}
+
+	defaultTransport := http.DefaultTransport.(*http.Transport)
+	dial := key.dialContext()
+	var transport http.RoundTripper
+	switch key.protocol {
+	case "", script.ProtocolHTTP1:
+		t := defaultTransport.Clone()
+		t.DialContext = dial
+		if key.pool.MaxIdle > 0 {
+			t.MaxIdleConnsPerHost = key.pool.MaxIdle
+		}
+		if key.pool.IdleTimeout > 0 {
+			t.IdleConnTimeout = time.Duration(key.pool.IdleTimeout)
+		}
+		t.MaxConnsPerHost = key.pool.MaxConnections
+		t.DisableKeepAlives = !key.keepAlive
+		if key.protocol == script.ProtocolHTTP1 {
+			// A non-nil, empty TLSNextProto disables HTTP/2.
+			t.ForceAttemptHTTP2 = false
+			t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		}
+		transport = t
+	case script.ProtocolH2C:
+		if scheme != "http" {
+			return nil, fmt.Errorf(
+				"protocol %s cannot be used with TLS", key.protocol)
+		}
+		transport = &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+				return dial(context.Background(), network, addr)
+			},
+		}
+	case script.ProtocolH2:
+		if scheme != "https" {
+			return nil, fmt.Errorf("protocol %s requires TLS", key.protocol)
+		}
+		transport = &http2.Transport{
+			TLSClientConfig: defaultTransport.TLSClientConfig,
+			DialTLS: func(
+				network, addr string, config *tls.Config) (net.Conn, error) {
+				conn, err := dial(context.Background(), network, addr)
+				if err != nil {
+					return nil, err
+				}
+				tlsConn := tls.Client(conn, config)
+				if err := tlsConn.Handshake(); err != nil {
+					conn.Close()
+					return nil, err
+				}
+				return tlsConn, nil
+			},
+		}
+	default:
+		return nil, fmt.Errorf("unknown protocol: %s", key.protocol)
+	}
+	client := &http.Client{Transport: transport}
+	httpClients[key] = client
+	return client, nil
+}
+
+// sendGRPCRequest calls the Invoke method of the Isotope gRPC service of
+// cmd's destination, for its endpoint if set. The call shares the connection
+// of its pool, unless cmd asks for a new connection or its pool does not keep
+// connections alive. Assumes DNS is available
+// which maps the destination to the service, unless UseAddresses maps it.
+func sendGRPCRequest(
+	ctx context.Context,
+	cmd script.RequestCommand,
+	requestHeader http.Header) (*pb.Response, error) {
+	destName := cmd.ServiceName
+	key := newClientKey(destName, "", cmd.ConnectionPool)
+	var client pb.IsotopeClient
+	if cmd.Connection == script.ConnectionNew || !key.keepAlive {
+		conn, err := dialGRPC(key)
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+		client = pb.NewIsotopeClient(conn)
+	} else {
+		var err error
+		client, err = grpcClient(key)
+		if err != nil {
+			return nil, err
+		}
+	}
+	payload, err := makeRandomByteArray(cmd.Size)
+	if err != nil {
+		return nil, err
+	}
+	ctx = metadata.NewOutgoingContext(ctx, metadataFromHeader(requestHeader))
+	log.Debugf("sending gRPC request to %s", destName)
+	return client.Invoke(
+		ctx, &pb.Request{Payload: payload, Endpoint: cmd.Endpoint})
+}
+
+// grpcClient returns the cached client identified by key.
+func grpcClient(key clientKey) (pb.IsotopeClient, error) {
+	grpcClientsMutex.Lock()
+	defer grpcClientsMutex.Unlock()
+	if client, ok := grpcClients[key]; ok {
+		return client, nil
+	}
+	conn, err := dialGRPC(key)
+	if err != nil {
+		return nil, err
+	}
+	client := pb.NewIsotopeClient(conn)
+	grpcClients[key] = client
+	return client, nil
+}
+
+// dialGRPC opens a gRPC connection to the destination of key.
+func dialGRPC(key clientKey) (*grpc.ClientConn, error) {
+	dial := key.dialContext()
+	return grpc.Dial(
+		serviceAddr(key.destName),
+		grpcTransportOption,
+		grpc.WithStatsHandler(grpcProgressHandler{}),
+		grpc.WithContextDialer(
+			func(ctx context.Context, addr string) (net.Conn, error) {
+				return dial(ctx, "tcp", addr)
+			}))
+}
+
+// grpcProgress records how far a gRPC call got, to tell failures to connect
+// and failures of the connection apart from errors its destination responded
+// with, which gRPC reports alike.
+type grpcProgress struct {
+	// sent is set once the call's headers are written on a connection.
+	sent int32
+	// responded is set once response headers or trailers are received.
+	responded int32
+}
+
+type grpcProgressKey struct{}
+
+// withGRPCProgress returns a copy of ctx in which the progress of a gRPC call
+// is recorded, and the progress.
+func withGRPCProgress(ctx context.Context) (context.Context, *grpcProgress) {
+	progress := &grpcProgress{}
+	return context.WithValue(ctx, grpcProgressKey{}, progress), progress
+}
+
+// grpcProgressHandler records the progress of the gRPC calls whose contexts
+// carry one.
+type grpcProgressHandler struct{}
+
+func (grpcProgressHandler) TagRPC(
+	ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (grpcProgressHandler) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	progress, ok := ctx.Value(grpcProgressKey{}).(*grpcProgress)
+	if !ok {
+		return
+	}
+	switch s.(type) {
+	case *stats.OutHeader:
+		atomic.StoreInt32(&progress.sent, 1)
+	case *stats.InHeader, *stats.InTrailer:
+		atomic.StoreInt32(&progress.responded, 1)
+	}
+}
+
+func (grpcProgressHandler) TagConn(
+	ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (grpcProgressHandler) HandleConn(context.Context, stats.ConnStats) {}
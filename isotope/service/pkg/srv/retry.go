@@ -0,0 +1,132 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package srv
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"time"
+
+	"istio.io/pkg/log"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/script"
+	"github.com/kristofgyuracz/istio-tools/isotope/service/pkg/srv/prometheus"
+)
+
+// Outcomes of attempts which failed before the destination responded. Other
+// outcomes are HTTP status codes.
+const (
+	outcomeConnectFailure = string(script.RetryOnConnectFailure)
+	outcomeReset          = string(script.RetryOnReset)
+	outcomeTimeout        = string(script.RetryOnTimeout)
+)
+
+// attemptFunc sends a single attempt of a call and returns its outcome: the
+// HTTP status code of the response or the kind of connection failure.
+type attemptFunc func(ctx context.Context) (outcome string, err error)
+
+// executeWithRetries calls attempt until it succeeds, its outcome is not
+// retried by cmd, or cmd's retries are exhausted. Each attempt is bounded by
+// cmd's timeout and separated from the previous one by its backoff, and
+// logged with entry. Nothing is retried once ctx is done.
+func executeWithRetries(
+	ctx context.Context,
+	cmd script.RequestCommand,
+	attempt attemptFunc,
+	entry accessLogEntry) error {
+	retryOn := cmd.RetryOn
+	if len(retryOn) == 0 {
+		retryOn = script.DefaultRetryOn
+	}
+	backoff := script.DefaultBackoff
+	if cmd.Backoff != nil {
+		backoff = *cmd.Backoff
+	}
+
+	for retry := 0; ; retry++ {
+		startTime := time.Now()
+		outcome, err := attemptWithTimeout(
+			ctx, time.Duration(cmd.Timeout), attempt)
+		duration := time.Since(startTime)
+		prometheus.RecordRequestAttempt(cmd.ServiceName, outcome, duration)
+		attemptDone(entry, retry+1, outcome, duration)
+		if err == nil || ctx.Err() != nil ||
+			retry >= cmd.Retries || !matchesAny(retryOn, outcome) {
+			return err
+		}
+		log.Debugf("retrying call to %s after %s: %s",
+			cmd.ServiceName, outcome, err)
+		if err := sleep(ctx, backoffInterval(backoff, retry+1)); err != nil {
+			return err
+		}
+	}
+}
+
+func attemptWithTimeout(
+	ctx context.Context,
+	timeout time.Duration,
+	attempt attemptFunc) (string, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return attempt(ctx)
+}
+
+func matchesAny(conditions []script.RetryCondition, outcome string) bool {
+	for _, c := range conditions {
+		if c.Matches(outcome) {
+			return true
+		}
+	}
+	return false
+}
+
+// backoffInterval returns a random pause before the nth retry, up to
+// BaseInterval * 2^(n-1) and at most MaxInterval.
+func backoffInterval(backoff script.Backoff, n int) time.Duration {
+	base := time.Duration(backoff.BaseInterval)
+	max := time.Duration(backoff.MaxInterval)
+	if max == 0 {
+		max = 10 * base
+	}
+	interval := base
+	for i := 1; i < n && interval < max; i++ {
+		interval *= 2
+	}
+	if interval > max {
+		interval = max
+	}
+	if interval <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(interval) + 1))
+}
+
+// failureOutcome classifies an error returned before the destination
+// responded.
+func failureOutcome(ctx context.Context, err error) string {
+	if ctx.Err() == context.DeadlineExceeded {
+		return outcomeTimeout
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return outcomeConnectFailure
+	}
+	return outcomeReset
+}
@@ -0,0 +1,212 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package srv
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/duration"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/script"
+)
+
+func TestBackoffInterval(t *testing.T) {
+	t.Parallel()
+
+	ms := func(n int) duration.Duration {
+		return duration.Duration(time.Duration(n) * time.Millisecond)
+	}
+
+	tests := []struct {
+		backoff script.Backoff
+		n       int
+		longest time.Duration
+	}{
+		{script.Backoff{BaseInterval: ms(10)}, 1, 10 * time.Millisecond},
+		{script.Backoff{BaseInterval: ms(10)}, 2, 20 * time.Millisecond},
+		{script.Backoff{BaseInterval: ms(10)}, 4, 80 * time.Millisecond},
+		{script.Backoff{BaseInterval: ms(10)}, 5, 100 * time.Millisecond},
+		{script.Backoff{BaseInterval: ms(10)}, 1000, 100 * time.Millisecond},
+		{script.Backoff{BaseInterval: ms(10), MaxInterval: ms(30)}, 2,
+			20 * time.Millisecond},
+		{script.Backoff{BaseInterval: ms(10), MaxInterval: ms(30)}, 3,
+			30 * time.Millisecond},
+		{script.Backoff{BaseInterval: ms(10), MaxInterval: ms(5)}, 1,
+			5 * time.Millisecond},
+		{script.Backoff{}, 3, 0},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			// The pause is random, so it is sampled until one lands in the
+			// upper half of the longest pause.
+			var longest time.Duration
+			for i := 0; i < 1000; i++ {
+				interval := backoffInterval(test.backoff, test.n)
+				if interval < 0 || interval > test.longest {
+					t.Fatalf("expected a pause up to %s; actual %s",
+						test.longest, interval)
+				}
+				if interval > longest {
+					longest = interval
+				}
+			}
+			if longest < test.longest/2 {
+				t.Errorf("expected pauses up to %s; longest %s",
+					test.longest, longest)
+			}
+		})
+	}
+}
+
+func TestFailureOutcome(t *testing.T) {
+	t.Parallel()
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Unix(1, 0))
+	defer cancel()
+
+	tests := []struct {
+		ctx     context.Context
+		err     error
+		outcome string
+	}{
+		{expired, errors.New("failed"), outcomeTimeout},
+		{
+			context.Background(),
+			&net.OpError{Op: "dial", Err: errors.New("connection refused")},
+			outcomeConnectFailure,
+		},
+		{
+			context.Background(),
+			&net.OpError{Op: "read", Err: errors.New("connection reset")},
+			outcomeReset,
+		},
+		{context.Background(), errors.New("EOF"), outcomeReset},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			if outcome := failureOutcome(test.ctx, test.err); outcome != test.outcome {
+				t.Errorf("expected %s; actual %s", test.outcome, outcome)
+			}
+		})
+	}
+}
+
+func TestExecuteWithRetries(t *testing.T) {
+	t.Parallel()
+
+	backoff := &script.Backoff{BaseInterval: duration.Duration(time.Millisecond)}
+
+	tests := []struct {
+		cmd      script.RequestCommand
+		outcomes []string
+		attempts int
+		err      bool
+	}{
+		{
+			script.RequestCommand{Retries: 2, Backoff: backoff},
+			[]string{"503", "200"},
+			2,
+			false,
+		},
+		{
+			script.RequestCommand{Retries: 2, Backoff: backoff},
+			[]string{"503", outcomeReset, outcomeConnectFailure},
+			3,
+			true,
+		},
+		{
+			script.RequestCommand{Retries: 2, Backoff: backoff},
+			[]string{"404", "200"},
+			1,
+			true,
+		},
+		{
+			script.RequestCommand{
+				Retries: 2,
+				RetryOn: []script.RetryCondition{script.RetryOn4xx},
+				Backoff: backoff,
+			},
+			[]string{"404", "503"},
+			2,
+			true,
+		},
+		{
+			script.RequestCommand{Backoff: backoff},
+			[]string{"503", "200"},
+			1,
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			attempts := 0
+			attempt := func(context.Context) (string, error) {
+				outcome := test.outcomes[attempts]
+				attempts++
+				if outcome != "200" {
+					return outcome, errors.New(outcome)
+				}
+				return outcome, nil
+			}
+			err := executeWithRetries(
+				context.Background(), test.cmd, attempt, accessLogEntry{})
+			if attempts != test.attempts {
+				t.Errorf("expected %d attempts; actual %d", test.attempts, attempts)
+			}
+			if (err != nil) != test.err {
+				t.Errorf("expected an error: %v; actual %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestExecuteWithRetries_Timeout(t *testing.T) {
+	t.Parallel()
+
+	cmd := script.RequestCommand{
+		Timeout: duration.Duration(10 * time.Millisecond),
+		Retries: 1,
+		Backoff: &script.Backoff{BaseInterval: duration.Duration(time.Millisecond)},
+	}
+	attempts := 0
+	attempt := func(ctx context.Context) (string, error) {
+		attempts++
+		<-ctx.Done()
+		return failureOutcome(ctx, ctx.Err()), ctx.Err()
+	}
+	err := executeWithRetries(
+		context.Background(), cmd, attempt, accessLogEntry{})
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected %v; actual %v", context.DeadlineExceeded, err)
+	}
+	if attempts != 2 {
+		t.Errorf("expected 2 attempts, each timing out; actual %d", attempts)
+	}
+}
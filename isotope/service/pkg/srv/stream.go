@@ -0,0 +1,482 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package srv
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/websocket"
+	"google.golang.org/grpc/metadata"
+
+	"istio.io/pkg/log"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/script"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/size"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/svctype"
+	"github.com/kristofgyuracz/istio-tools/isotope/service/pkg/pb"
+	"github.com/kristofgyuracz/istio-tools/isotope/service/pkg/srv/prometheus"
+	"github.com/kristofgyuracz/istio-tools/isotope/service/pkg/srv/tracing"
+)
+
+// The headers with which HTTP and TCP services are asked for a stream. gRPC
+// services are asked with a pb.StreamRequest instead.
+const (
+	streamModeHeader        = "X-Isotope-Stream"
+	streamMessagesHeader    = "X-Isotope-Stream-Messages"
+	streamIntervalHeader    = "X-Isotope-Stream-Interval"
+	streamMessageSizeHeader = "X-Isotope-Stream-Message-Size"
+)
+
+// The modes of streams from gRPC and TCP services, which complete the
+// script.StreamModes of HTTP services in metrics.
+const (
+	streamModeGRPC = "grpc"
+	streamModeTCP  = "tcp"
+)
+
+// maxStreamMessages bounds the number of messages a stream may be asked for.
+const maxStreamMessages = 1000000
+
+// streamSpec describes the messages of a stream.
+type streamSpec struct {
+	mode        string
+	messages    int
+	interval    time.Duration
+	messageSize int
+}
+
+// newStreamSpec returns the spec of the stream cmd opens to a service of
+// destType.
+func newStreamSpec(
+	cmd script.StreamCommand, destType svctype.ServiceType) streamSpec {
+	spec := streamSpec{
+		mode:        string(cmd.Mode),
+		messages:    cmd.Messages,
+		interval:    time.Duration(cmd.Interval),
+		messageSize: int(cmd.MessageSize),
+	}
+	switch {
+	case destType == svctype.ServiceGRPC:
+		spec.mode = streamModeGRPC
+	case destType == svctype.ServiceTCP:
+		spec.mode = streamModeTCP
+	case spec.mode == "":
+		spec.mode = string(script.StreamChunked)
+	}
+	return spec
+}
+
+// streamSpecFromRequest returns the spec of the stream asked for by request.
+func streamSpecFromRequest(request *pb.StreamRequest) (streamSpec, error) {
+	if request.MessageSize < 0 || request.MessageSize > maxBodySize {
+		return streamSpec{}, invalidMessageSizeError(request.MessageSize)
+	}
+	spec := streamSpec{
+		mode:        streamModeGRPC,
+		messages:    int(request.Messages),
+		interval:    time.Duration(request.IntervalNanos),
+		messageSize: int(request.MessageSize),
+	}
+	if err := spec.validate(); err != nil {
+		return streamSpec{}, err
+	}
+	return spec, nil
+}
+
+// validate returns an error if spec asks for a negative or excessive number
+// of messages, a negative interval, or a negative or excessive message size.
+func (spec streamSpec) validate() error {
+	if spec.messages < 0 || spec.messages > maxStreamMessages {
+		return fmt.Errorf("invalid stream messages: %d (must be between 0 and %d)",
+			spec.messages, maxStreamMessages)
+	}
+	if spec.interval < 0 {
+		return fmt.Errorf("invalid stream interval: %s (must be non-negative)",
+			spec.interval)
+	}
+	if spec.messageSize < 0 || spec.messageSize > maxBodySize {
+		return invalidMessageSizeError(int64(spec.messageSize))
+	}
+	return nil
+}
+
+func invalidMessageSizeError(n int64) error {
+	return fmt.Errorf(
+		"invalid stream message size: %d (must be between 0 and %d)",
+		n, maxBodySize)
+}
+
+// setHeader asks for the stream of spec in header.
+func (spec streamSpec) setHeader(header http.Header) http.Header {
+	streamHeader := make(http.Header, len(header)+4)
+	for key, values := range header {
+		streamHeader[key] = values
+	}
+	streamHeader.Set(streamModeHeader, spec.mode)
+	streamHeader.Set(streamMessagesHeader, strconv.Itoa(spec.messages))
+	streamHeader.Set(streamIntervalHeader, spec.interval.String())
+	streamHeader.Set(streamMessageSizeHeader, strconv.Itoa(spec.messageSize))
+	return streamHeader
+}
+
+// streamSpecFromHeader returns the spec of the stream asked for in header, and
+// whether one is asked for at all.
+func streamSpecFromHeader(header http.Header) (streamSpec, bool, error) {
+	mode := header.Get(streamModeHeader)
+	if mode == "" {
+		return streamSpec{}, false, nil
+	}
+	spec := streamSpec{mode: mode}
+	var err error
+	spec.messages, err = strconv.Atoi(header.Get(streamMessagesHeader))
+	if err != nil {
+		return streamSpec{}, true, fmt.Errorf(
+			"invalid %s: %s", streamMessagesHeader, err)
+	}
+	spec.interval, err = time.ParseDuration(header.Get(streamIntervalHeader))
+	if err != nil {
+		return streamSpec{}, true, fmt.Errorf(
+			"invalid %s: %s", streamIntervalHeader, err)
+	}
+	spec.messageSize, err = strconv.Atoi(header.Get(streamMessageSizeHeader))
+	if err != nil {
+		return streamSpec{}, true, fmt.Errorf(
+			"invalid %s: %q", streamMessageSizeHeader,
+			header.Get(streamMessageSizeHeader))
+	}
+	if err := spec.validate(); err != nil {
+		return streamSpec{}, true, err
+	}
+	return spec, true, nil
+}
+
+// stream calls send with each message of spec, pausing between them, until
+// all are sent or ctx is done. It returns the number of bytes sent.
+func (h Handler) stream(
+	ctx context.Context, spec streamSpec, send func([]byte) error) (
+	int, error) {
+	startTime := time.Now()
+	message := h.payloads.get(&h.payloads.text, makeText, spec.messageSize)
+	sent := 0
+	defer func() {
+		prometheus.RecordStreamServed(spec.mode, sent, time.Since(startTime))
+	}()
+	for sent < spec.messages {
+		if sent > 0 {
+			if err := sleep(ctx, spec.interval); err != nil {
+				return sent * len(message), err
+			}
+		}
+		if err := send(message); err != nil {
+			return sent * len(message), err
+		}
+		sent++
+	}
+	return sent * len(message), nil
+}
+
+// serveHTTPStream streams the messages of spec in response to request, whose
+// script has run, and returns the number of bytes streamed.
+func (h Handler) serveHTTPStream(
+	writer http.ResponseWriter,
+	request *http.Request,
+	spec streamSpec,
+	header http.Header) int {
+	ctx := request.Context()
+	var (
+		n   int
+		err error
+	)
+	switch script.StreamMode(spec.mode) {
+	case script.StreamWebSocket:
+		server := websocket.Server{
+			// Accept any origin: callers are other services.
+			Handshake: func(*websocket.Config, *http.Request) error { return nil },
+			Handler: func(conn *websocket.Conn) {
+				conn.PayloadType = websocket.BinaryFrame
+				n, err = h.stream(ctx, spec, func(message []byte) error {
+					_, err := conn.Write(message)
+					return err
+				})
+			},
+		}
+		server.ServeHTTP(writer, request)
+	default:
+		flusher, _ := writer.(http.Flusher)
+		for key, values := range header {
+			writer.Header()[key] = values
+		}
+		format := "%s\n"
+		if script.StreamMode(spec.mode) == script.StreamSSE {
+			format = "data: %s\n\n"
+			writer.Header().Set("Content-Type", "text/event-stream")
+			writer.Header().Set("Cache-Control", "no-cache")
+		} else {
+			writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		}
+		writer.WriteHeader(http.StatusOK)
+		n, err = h.stream(ctx, spec, func(message []byte) error {
+			if _, err := fmt.Fprintf(writer, format, message); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		log.Debugf("stream ended early: %s", err)
+	}
+	return n
+}
+
+// executeStreamCommand opens a stream to another service, which streams back
+// the messages of cmd after running its script, and receives them. The stream
+// is traced by a client span whose context is sent to the destination.
+func (e executor) executeStreamCommand(
+	ctx context.Context, cmd script.StreamCommand) error {
+	destName := cmd.ServiceName
+	destType, ok := e.serviceTypes[destName]
+	if !ok {
+		return fmt.Errorf("service %s does not exist", destName)
+	}
+
+	header, err := e.callHeader(destName)
+	if err != nil {
+		return err
+	}
+
+	ctx, span := e.tracer.Start(ctx, "stream "+destName, tracing.SpanKindClient)
+	defer span.End()
+	span.SetAttribute("peer.service", destName)
+	if span != nil {
+		header = tracing.Inject(header, span.SpanContext())
+	}
+	if cmd.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(cmd.Timeout))
+		defer cancel()
+	}
+
+	spec := newStreamSpec(cmd, destType)
+	startTime := time.Now()
+	defer prometheus.RecordRequestSent(destName, uint64(cmd.Size))
+	defer inFlight.startOutbound(destName)()
+	var received int
+	switch {
+	case destType == svctype.ServiceGRPC:
+		received, err = receiveGRPCStream(ctx, destName, spec, cmd.Size, header)
+	case destType == svctype.ServiceTCP:
+		received, err = receiveTCPStream(ctx, destName, spec, cmd.Size, header)
+	case spec.mode == string(script.StreamWebSocket):
+		received, err = receiveWebSocketStream(ctx, destName, spec, header)
+	default:
+		received, err = receiveHTTPStream(ctx, destName, spec, cmd.Size, header)
+	}
+	prometheus.RecordStreamReceived(
+		destName, spec.mode, received, time.Since(startTime))
+	if err == nil && received < spec.messages {
+		err = fmt.Errorf("service %s ended the stream after %d of %d messages",
+			destName, received, spec.messages)
+	}
+	span.SetError(err)
+	return err
+}
+
+// receiveHTTPStream asks the HTTP service destName for a chunked or SSE
+// stream and returns the number of messages received.
+func receiveHTTPStream(
+	ctx context.Context,
+	destName string,
+	spec streamSpec,
+	size size.ByteSize,
+	header http.Header) (int, error) {
+	response, err := sendRequest(ctx, httpCall{
+		destName: destName,
+		target:   "/",
+		size:     size,
+		header:   spec.setHeader(header),
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer readAllAndClose(response.Body)
+	if response.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf(
+			"service %s responded with %s", destName, response.Status)
+	}
+
+	// Messages are lines, or events ended by an empty line with SSE.
+	isSSE := spec.mode == string(script.StreamSSE)
+	reader := bufio.NewReader(response.Body)
+	received, lineLength := 0, 0
+	for {
+		line, err := reader.ReadSlice('\n')
+		lineLength += len(line)
+		switch err {
+		case nil:
+		case bufio.ErrBufferFull:
+			continue
+		case io.EOF:
+			return received, nil
+		default:
+			return received, err
+		}
+		if !isSSE || lineLength == 1 {
+			received++
+		}
+		lineLength = 0
+	}
+}
+
+// receiveWebSocketStream opens a WebSocket to the HTTP service destName and
+// returns the number of messages received before it is closed.
+func receiveWebSocketStream(
+	ctx context.Context,
+	destName string,
+	spec streamSpec,
+	header http.Header) (int, error) {
+	wsScheme := "ws"
+	if clientTLSConfig != nil {
+		wsScheme = "wss"
+	}
+	config, err := websocket.NewConfig(
+		fmt.Sprintf("%s://%s/", wsScheme, serviceAddr(destName)),
+		fmt.Sprintf("%s://%s/", scheme, destName))
+	if err != nil {
+		return 0, err
+	}
+	config.Header = spec.setHeader(header)
+
+	conn, _, err := getTCPPool(newClientKey(destName, "", nil)).get(ctx, false)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	unwatch, err := watchContext(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+	defer unwatch()
+
+	ws, err := websocket.NewClient(config, conn)
+	if err != nil {
+		return 0, err
+	}
+	received := 0
+	for {
+		var message []byte
+		if err := websocket.Message.Receive(ws, &message); err != nil {
+			if err == io.EOF {
+				return received, nil
+			}
+			return received, err
+		}
+		received++
+	}
+}
+
+// receiveGRPCStream calls the Stream method of the gRPC service destName and
+// returns the number of messages received.
+func receiveGRPCStream(
+	ctx context.Context,
+	destName string,
+	spec streamSpec,
+	size size.ByteSize,
+	header http.Header) (int, error) {
+	client, err := grpcClient(newClientKey(destName, "", nil))
+	if err != nil {
+		return 0, err
+	}
+	payload, err := makeRandomByteArray(size)
+	if err != nil {
+		return 0, err
+	}
+	ctx = metadata.NewOutgoingContext(ctx, metadataFromHeader(header))
+	stream, err := client.Stream(ctx, &pb.StreamRequest{
+		Payload:       payload,
+		Messages:      int32(spec.messages),
+		IntervalNanos: int64(spec.interval),
+		MessageSize:   int64(spec.messageSize),
+	})
+	if err != nil {
+		return 0, err
+	}
+	received := 0
+	for {
+		if _, err := stream.Recv(); err != nil {
+			if err == io.EOF {
+				return received, nil
+			}
+			return received, fmt.Errorf(
+				"service %s responded with %s", destName, err)
+		}
+		received++
+	}
+}
+
+// receiveTCPStream asks the TCP service destName for a stream, on a
+// connection of its own, and returns the number of messages received.
+func receiveTCPStream(
+	ctx context.Context,
+	destName string,
+	spec streamSpec,
+	size size.ByteSize,
+	header http.Header) (int, error) {
+	payload, err := makeRandomByteArray(size)
+	if err != nil {
+		return 0, err
+	}
+	conn, _, err := getTCPPool(newClientKey(destName, "", nil)).get(ctx, false)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	unwatch, err := watchContext(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+	defer unwatch()
+
+	writer := bufio.NewWriter(conn)
+	if err := writeTCPRequest(writer, spec.setHeader(header), payload); err != nil {
+		return 0, err
+	}
+	if err := writer.Flush(); err != nil {
+		return 0, err
+	}
+	reader := bufio.NewReader(conn)
+	received := 0
+	for received < spec.messages {
+		code, err := readTCPResponse(reader)
+		if err != nil {
+			return received, err
+		}
+		if code != http.StatusOK {
+			return received, fmt.Errorf(
+				"service %s responded with %d %s",
+				destName, code, http.StatusText(code))
+		}
+		received++
+	}
+	return received, nil
+}
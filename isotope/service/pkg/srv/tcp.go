@@ -0,0 +1,696 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package srv
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"istio.io/pkg/log"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/headers"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/script"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/svctype"
+	"github.com/kristofgyuracz/istio-tools/isotope/service/pkg/srv/prometheus"
+)
+
+// TCP services speak a framed request/response protocol. Each request is a
+// header and a payload, each written as a big-endian uint32 length followed
+// by that many bytes; the header is in the format of HTTP/1.1 headers. Each
+// response is a big-endian uint16 status code, followed by a header and a
+// payload like a request's. A connection carries any number of requests, one
+// at a time.
+
+// maxTCPSectionSize bounds the header and payload of a frame, so that a
+// corrupt length cannot exhaust memory.
+const maxTCPSectionSize = 1 << 28
+
+// errTCPSectionTooLarge is returned when a frame exceeds maxTCPSectionSize.
+var errTCPSectionTooLarge = errors.New("TCP frame section too large")
+
+var (
+	// tcpPools keeps the connections to each TCP service, per connection
+	// pool.
+	tcpPools      = map[clientKey]*tcpPool{}
+	tcpPoolsMutex sync.Mutex
+)
+
+// ErrTCPServerClosed is returned by TCPServer.Serve after Shutdown or Close.
+var ErrTCPServerClosed = errors.New("TCP server closed")
+
+// TCPServer serves the framed protocol of TCP services with Handler on each
+// connection accepted.
+type TCPServer struct {
+	Handler *ReloadingHandler
+
+	mutex     sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]*tcpConnState
+	closed    bool
+	connsWG   sync.WaitGroup
+}
+
+// tcpConnState is the state of a connection open to a TCPServer.
+type tcpConnState struct {
+	// active is whether a request is being served on the connection.
+	active bool
+	// cancel cancels the context of the requests served on the connection.
+	cancel context.CancelFunc
+}
+
+// Serve accepts connections on listener until it fails or the server is shut
+// down, and serves each in its own goroutine.
+func (s *TCPServer) Serve(listener net.Listener) error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		listener.Close()
+		return ErrTCPServerClosed
+	}
+	if s.listeners == nil {
+		s.listeners = map[net.Listener]struct{}{}
+	}
+	s.listeners[listener] = struct{}{}
+	s.mutex.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrTCPServerClosed
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Temporary() {
+				log.Errorf("accepting TCP connection: %s", err)
+				time.Sleep(5 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		if !s.track(conn, cancel) {
+			cancel()
+			conn.Close()
+			return ErrTCPServerClosed
+		}
+		go s.serveConn(ctx, cancel, conn)
+	}
+}
+
+// Shutdown stops accepting connections, closes the idle ones, and waits for
+// the requests being served to complete, closing their connections
+// afterwards, or for ctx to be done, in which case the remaining connections
+// are closed and ctx's error is returned.
+func (s *TCPServer) Shutdown(ctx context.Context) error {
+	s.close(false)
+	done := make(chan struct{})
+	go func() {
+		s.connsWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.close(true)
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting connections and closes every connection, cutting the
+// requests being served short.
+func (s *TCPServer) Close() error {
+	s.close(true)
+	return nil
+}
+
+// close closes the listeners and the idle connections, or every connection,
+// cancelling the requests served on them, if all is true.
+func (s *TCPServer) close(all bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.closed = true
+	for listener := range s.listeners {
+		listener.Close()
+		delete(s.listeners, listener)
+	}
+	for conn, state := range s.conns {
+		if all {
+			state.cancel()
+		}
+		if all || !state.active {
+			conn.Close()
+		}
+	}
+}
+
+func (s *TCPServer) isClosed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.closed
+}
+
+// track records conn as open and idle, with cancel cancelling the context of
+// its requests, or returns false if the server is closed.
+func (s *TCPServer) track(conn net.Conn, cancel context.CancelFunc) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return false
+	}
+	if s.conns == nil {
+		s.conns = map[net.Conn]*tcpConnState{}
+	}
+	s.conns[conn] = &tcpConnState{cancel: cancel}
+	s.connsWG.Add(1)
+	return true
+}
+
+// setActive records whether a request is being served on conn, and returns
+// false once the server is shut down, in which case conn is to be closed
+// when idle.
+func (s *TCPServer) setActive(conn net.Conn, active bool) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.conns[conn].active = active
+	return !s.closed
+}
+
+func (s *TCPServer) untrack(conn net.Conn) {
+	s.mutex.Lock()
+	delete(s.conns, conn)
+	s.mutex.Unlock()
+	s.connsWG.Done()
+}
+
+// serveConn responds to the requests on conn until it is closed, or until
+// the server is shut down. The requests are served under ctx, which cancel
+// cancels once conn is closed, by either end, or the server is closed.
+func (s *TCPServer) serveConn(
+	ctx context.Context, cancel context.CancelFunc, conn net.Conn) {
+	defer s.untrack(conn)
+	defer conn.Close()
+	defer cancel()
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+	for {
+		header, payload, err := readTCPRequest(reader)
+		if err != nil {
+			if err != io.EOF {
+				log.Debugf("closing TCP connection from %s: %s",
+					conn.RemoteAddr(), err)
+			}
+			return
+		}
+		// A request read before the server was shut down is still served.
+		s.setActive(conn, true)
+		respond := func(code int, header http.Header, payload []byte) error {
+			err := writeTCPResponse(writer, code, header, payload)
+			if err != nil {
+				return err
+			}
+			return writer.Flush()
+		}
+		stopWatching := watchTCPConn(conn, reader, cancel)
+		err = s.Handler.Handler().serveTCPRequest(
+			ctx, header, payload, respond)
+		stopWatching()
+		if err != nil {
+			log.Debugf("closing TCP connection from %s: %s",
+				conn.RemoteAddr(), err)
+			return
+		}
+		if !s.setActive(conn, false) {
+			return
+		}
+	}
+}
+
+// watchTCPConn calls cancel if the client closes conn while a request read
+// from reader is served, and returns a function which stops watching. Like
+// net/http, it waits for the next request in the background, without
+// consuming it, and is stopped by a read deadline in the past.
+func watchTCPConn(
+	conn net.Conn,
+	reader *bufio.Reader,
+	cancel context.CancelFunc) (stop func()) {
+	var stopping int32
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := reader.Peek(1); err != nil &&
+			atomic.LoadInt32(&stopping) == 0 {
+			cancel()
+		}
+	}()
+	return func() {
+		atomic.StoreInt32(&stopping, 1)
+		_ = conn.SetReadDeadline(time.Unix(1, 0))
+		<-done
+		_ = conn.SetReadDeadline(time.Time{})
+	}
+}
+
+// serveTCPRequest runs the Service's script for a request with header and
+// payload, like ServeHTTP, and writes the response with respond. If the
+// request asks for a stream, a response is written for each message instead.
+func (h Handler) serveTCPRequest(
+	ctx context.Context,
+	header http.Header,
+	payload []byte,
+	respond func(code int, header http.Header, payload []byte) error) error {
+	startTime := time.Now()
+
+	prometheus.RecordRequestReceived()
+
+	entry := h.inboundEntry(svctype.ServiceTCP, "", "", header, len(payload))
+
+	spec, isStream, err := streamSpecFromHeader(header)
+	if err != nil {
+		log.Debugf("%s", err)
+		responseSent(entry, time.Since(startTime), 0, http.StatusBadRequest)
+		return respond(http.StatusBadRequest, nil, nil)
+	}
+	spec.mode = streamModeTCP
+
+	r := h.serviceRoute()
+	code := h.executeScript(ctx, r, headers.Data{
+		Service: h.Service.Name,
+		Header:  header,
+	}, &entry)
+	responseHeader := echoedHeader(header, h.Service.Headers)
+
+	if isStream && code == http.StatusOK {
+		n, err := h.stream(ctx, spec, func(message []byte) error {
+			return respond(code, responseHeader, message)
+		})
+		responseSent(entry, time.Since(startTime), n, code)
+		return err
+	}
+
+	responsePayload := h.responseBody(header, payload, r.responseSize)
+	responseSent(entry, time.Since(startTime), len(responsePayload), code)
+	return respond(code, responseHeader, responsePayload)
+}
+
+// attemptTCPRequest sends a request of cmd's size with header to cmd's TCP
+// service, on an idle connection of cmd's pool unless cmd asks for a new
+// connection or the pool does not keep connections alive.
+func attemptTCPRequest(
+	ctx context.Context,
+	cmd script.RequestCommand,
+	header http.Header) (string, error) {
+	destName := cmd.ServiceName
+	payload, err := makeRandomByteArray(cmd.Size)
+	if err != nil {
+		return failureOutcome(ctx, err), err
+	}
+
+	key := newClientKey(destName, "", cmd.ConnectionPool)
+	pool := getTCPPool(key)
+	reuse := cmd.Connection != script.ConnectionNew && key.keepAlive
+	conn, reused, err := pool.get(ctx, reuse)
+	if err != nil {
+		return failureOutcome(ctx, err), err
+	}
+	code, err := roundTripTCP(ctx, conn, header, payload)
+	if err != nil && reused && ctx.Err() == nil {
+		// The service, or a proxy in between, may have closed the connection
+		// while it was idle.
+		conn.Close()
+		log.Debugf("retrying on a new connection to %s: %s", destName, err)
+		conn, _, err = pool.get(ctx, false)
+		if err != nil {
+			return failureOutcome(ctx, err), err
+		}
+		code, err = roundTripTCP(ctx, conn, header, payload)
+	}
+	if err != nil {
+		conn.Close()
+		return failureOutcome(ctx, err), err
+	}
+	if reuse {
+		pool.put(conn)
+	} else {
+		conn.Close()
+	}
+
+	log.Debugf("%s responded with %d", destName, code)
+	outcome := strconv.Itoa(code)
+	if code != http.StatusOK {
+		return outcome, fmt.Errorf(
+			"service %s responded with %d %s",
+			destName, code, http.StatusText(code))
+	}
+	return outcome, nil
+}
+
+// tcpPool holds the connections of a connection pool to a TCP service.
+type tcpPool struct {
+	key clientKey
+	// slots holds a token per open connection if the pool bounds them, and
+	// handoff then passes released connections to calls waiting for a slot.
+	slots   chan struct{}
+	handoff chan net.Conn
+
+	mutex   sync.Mutex
+	idle    []idleTCPConn
+	waiting int
+}
+
+// idleTCPConn is an idle connection of a tcpPool, and when it became idle.
+type idleTCPConn struct {
+	conn  net.Conn
+	since time.Time
+}
+
+// pooledTCPConn is a connection of a tcpPool, which frees its slot in the
+// pool once closed.
+type pooledTCPConn struct {
+	net.Conn
+	release sync.Once
+	slots   chan struct{}
+}
+
+func (c *pooledTCPConn) Close() error {
+	err := c.Conn.Close()
+	c.release.Do(func() { <-c.slots })
+	return err
+}
+
+// getTCPPool returns the pool identified by key, making it on first use.
+func getTCPPool(key clientKey) *tcpPool {
+	tcpPoolsMutex.Lock()
+	defer tcpPoolsMutex.Unlock()
+	pool, ok := tcpPools[key]
+	if !ok {
+		pool = &tcpPool{key: key}
+		if key.pool.MaxConnections > 0 {
+			pool.slots = make(chan struct{}, key.pool.MaxConnections)
+			pool.handoff = make(chan net.Conn)
+		}
+		tcpPools[key] = pool
+	}
+	return pool
+}
+
+// get returns an idle connection of p if reuse is set and there is one which
+// has not been idle for longer than p's idle timeout, or else a new
+// connection. If p bounds its connections, get waits for a slot first, or,
+// if reuse is set, for a connection to be released. Assumes DNS is available
+// which maps the destination to the service, unless UseAddresses maps it.
+func (p *tcpPool) get(ctx context.Context, reuse bool) (
+	conn net.Conn, reused bool, err error) {
+	if reuse {
+		if conn := p.takeIdle(); conn != nil {
+			return conn, true, nil
+		}
+	}
+
+	if p.slots != nil {
+		conn, err := p.acquire(ctx, reuse)
+		if conn != nil || err != nil {
+			return conn, conn != nil, err
+		}
+	}
+	conn, err = p.key.dialContext()(ctx, "tcp", serviceAddr(p.key.destName))
+	if err != nil {
+		if p.slots != nil {
+			<-p.slots
+		}
+		return nil, false, err
+	}
+	if clientTLSConfig != nil {
+		config := clientTLSConfig.Clone()
+		config.ServerName = p.key.destName
+		conn = tls.Client(conn, config)
+	}
+	if p.slots != nil {
+		conn = &pooledTCPConn{Conn: conn, slots: p.slots}
+	}
+	return conn, false, nil
+}
+
+// acquire takes a slot of p for a new connection, closing an idle connection
+// to free one if needed, and waits for it. If reuse is set, a connection
+// released meanwhile is returned instead.
+func (p *tcpPool) acquire(ctx context.Context, reuse bool) (net.Conn, error) {
+	select {
+	case p.slots <- struct{}{}:
+		return nil, nil
+	default:
+	}
+
+	p.mutex.Lock()
+	p.waiting++
+	if len(p.idle) > 0 {
+		p.idle[0].conn.Close()
+		p.idle = p.idle[1:]
+	}
+	p.mutex.Unlock()
+	defer func() {
+		p.mutex.Lock()
+		p.waiting--
+		p.mutex.Unlock()
+	}()
+
+	var handoff chan net.Conn
+	if reuse {
+		handoff = p.handoff
+	}
+	select {
+	case p.slots <- struct{}{}:
+		return nil, nil
+	case conn := <-handoff:
+		return conn, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// takeIdle removes the most recently idle connection from p and returns it,
+// closing the connections which have been idle for too long, or returns nil.
+func (p *tcpPool) takeIdle() net.Conn {
+	idleTimeout := time.Duration(p.key.pool.IdleTimeout)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if idleTimeout > 0 {
+		// Connections became idle in order, so the expired ones come first.
+		expired := 0
+		for expired < len(p.idle) &&
+			time.Since(p.idle[expired].since) > idleTimeout {
+			p.idle[expired].conn.Close()
+			expired++
+		}
+		p.idle = p.idle[expired:]
+	}
+	n := len(p.idle)
+	if n == 0 {
+		return nil
+	}
+	conn := p.idle[n-1].conn
+	p.idle = p.idle[:n-1]
+	return conn
+}
+
+// put passes conn to a call waiting for a connection of p, or else keeps it
+// idle for reuse. It is closed instead if calls wait for a slot, or if p has
+// as many idle connections as its pool keeps: maxIdle, or else as many as
+// http.DefaultTransport keeps per host.
+func (p *tcpPool) put(conn net.Conn) {
+	if p.handoff != nil {
+		select {
+		case p.handoff <- conn:
+			return
+		default:
+		}
+	}
+
+	maxIdle := p.key.pool.MaxIdle
+	if maxIdle == 0 {
+		maxIdle = http.DefaultTransport.(*http.Transport).MaxIdleConnsPerHost
+	}
+	if maxIdle == 0 {
+		maxIdle = http.DefaultMaxIdleConnsPerHost
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.waiting > 0 || len(p.idle) >= maxIdle {
+		conn.Close()
+		return
+	}
+	p.idle = append(p.idle, idleTCPConn{conn, time.Now()})
+}
+
+// roundTripTCP writes a request with header and payload to conn and returns
+// the status code of the response, whose payload is discarded. It returns
+// early if ctx is done.
+func roundTripTCP(
+	ctx context.Context,
+	conn net.Conn,
+	header http.Header,
+	payload []byte) (int, error) {
+	unwatch, err := watchContext(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+	code, err := func() (int, error) {
+		writer := bufio.NewWriter(conn)
+		if err := writeTCPRequest(writer, header, payload); err != nil {
+			return 0, err
+		}
+		if err := writer.Flush(); err != nil {
+			return 0, err
+		}
+		return readTCPResponse(bufio.NewReader(conn))
+	}()
+	if unwatchErr := unwatch(); err == nil {
+		err = unwatchErr
+	}
+	return code, err
+}
+
+// watchContext applies ctx's deadline to conn and interrupts its pending
+// reads and writes once ctx is done, until the returned function is called,
+// which clears conn's deadline.
+func watchContext(ctx context.Context, conn net.Conn) (func() error, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return nil, err
+		}
+	}
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			_ = conn.SetDeadline(time.Unix(1, 0))
+		case <-stop:
+		}
+	}()
+	return func() error {
+		close(stop)
+		<-stopped
+		return conn.SetDeadline(time.Time{})
+	}, nil
+}
+
+func writeTCPRequest(w io.Writer, header http.Header, payload []byte) error {
+	var b bytes.Buffer
+	if err := header.Write(&b); err != nil {
+		return err
+	}
+	if err := writeTCPSection(w, b.Bytes()); err != nil {
+		return err
+	}
+	return writeTCPSection(w, payload)
+}
+
+func readTCPRequest(r io.Reader) (http.Header, []byte, error) {
+	b, err := readTCPSection(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The header is terminated by an empty line, as in HTTP/1.1.
+	b = append(b, "\r\n"...)
+	mimeHeader, err := textproto.NewReader(
+		bufio.NewReader(bytes.NewReader(b))).ReadMIMEHeader()
+	if err != nil {
+		return nil, nil, err
+	}
+	payload, err := readTCPSection(r)
+	if err != nil {
+		return nil, nil, unexpectedEOF(err)
+	}
+	return http.Header(mimeHeader), payload, nil
+}
+
+func writeTCPResponse(
+	w io.Writer, code int, header http.Header, payload []byte) error {
+	if err := binary.Write(w, binary.BigEndian, uint16(code)); err != nil {
+		return err
+	}
+	return writeTCPRequest(w, header, payload)
+}
+
+// readTCPResponse reads a response from r and returns its status code. Its
+// header and payload are discarded.
+func readTCPResponse(r io.Reader) (int, error) {
+	var code uint16
+	if err := binary.Read(r, binary.BigEndian, &code); err != nil {
+		return 0, err
+	}
+	for i := 0; i < 2; i++ {
+		var n uint32
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+			return 0, unexpectedEOF(err)
+		}
+		if _, err := io.CopyN(ioutil.Discard, r, int64(n)); err != nil {
+			return 0, unexpectedEOF(err)
+		}
+	}
+	return int(code), nil
+}
+
+func writeTCPSection(w io.Writer, b []byte) error {
+	if len(b) > maxTCPSectionSize {
+		return errTCPSectionTooLarge
+	}
+	if err := binary.Write(w, binary.BigEndian, uint32(len(b))); err != nil {
+		return err
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+func readTCPSection(r io.Reader) ([]byte, error) {
+	var n uint32
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return nil, err
+	}
+	if n > maxTCPSectionSize {
+		return nil, errTCPSectionTooLarge
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return b, nil
+}
+
+// unexpectedEOF turns io.EOF, which only ends a connection between frames,
+// into io.ErrUnexpectedEOF.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,440 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package srv
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/script"
+)
+
+func TestTCPFraming(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		code    int
+		header  http.Header
+		payload []byte
+	}{
+		{http.StatusOK, http.Header{}, []byte{}},
+		{
+			http.StatusInternalServerError,
+			http.Header{"X-A": {"1", "2"}, "X-B": {"b"}},
+			[]byte("payload"),
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			var b bytes.Buffer
+			if err := writeTCPRequest(&b, test.header, test.payload); err != nil {
+				t.Fatal(err)
+			}
+			header, payload, err := readTCPRequest(&b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(test.header, header) {
+				t.Errorf("expected header %v; actual %v", test.header, header)
+			}
+			if !bytes.Equal(test.payload, payload) {
+				t.Errorf("expected payload %q; actual %q", test.payload, payload)
+			}
+
+			err = writeTCPResponse(&b, test.code, test.header, test.payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code, err := readTCPResponse(&b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if code != test.code {
+				t.Errorf("expected code %d; actual %d", test.code, code)
+			}
+			if b.Len() != 0 {
+				t.Errorf("expected the response to be read whole; %d bytes left",
+					b.Len())
+			}
+		})
+	}
+}
+
+func TestReadTCPRequest_Errors(t *testing.T) {
+	t.Parallel()
+
+	// sections writes each int as a section length and each string as is.
+	sections := func(frames ...interface{}) []byte {
+		var buf bytes.Buffer
+		for _, frame := range frames {
+			switch frame := frame.(type) {
+			case int:
+				_ = binary.Write(&buf, binary.BigEndian, uint32(frame))
+			case string:
+				buf.WriteString(frame)
+			}
+		}
+		return buf.Bytes()
+	}
+
+	tests := []struct {
+		input []byte
+		err   error
+	}{
+		{nil, io.EOF},
+		{sections(maxTCPSectionSize + 1), errTCPSectionTooLarge},
+		{sections(0, maxTCPSectionSize+1), errTCPSectionTooLarge},
+		{sections(4, "X-A"), io.ErrUnexpectedEOF},
+		{sections(0), io.ErrUnexpectedEOF},
+		{sections(0, 4, "abc"), io.ErrUnexpectedEOF},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			_, _, err := readTCPRequest(bytes.NewReader(test.input))
+			if err != test.err {
+				t.Errorf("expected %v; actual %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestRoundTripTCP(t *testing.T) {
+	t.Parallel()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	go func() {
+		header, payload, err := readTCPRequest(server)
+		if err != nil {
+			return
+		}
+		code := http.StatusTeapot
+		if header.Get("X-A") != "a" || string(payload) != "payload" {
+			code = http.StatusBadRequest
+		}
+		_ = writeTCPResponse(server, code, http.Header{"X-B": {"b"}}, payload)
+	}()
+
+	code, err := roundTripTCP(context.Background(), client,
+		http.Header{"X-A": {"a"}}, []byte("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != http.StatusTeapot {
+		t.Errorf("expected %d; actual %d", http.StatusTeapot, code)
+	}
+
+	// The server does not respond to a second request, so the context ends
+	// the round trip.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	go func() { _, _, _ = readTCPRequest(server) }()
+	if _, err := roundTripTCP(ctx, client, http.Header{}, nil); err == nil {
+		t.Errorf("expected an error once the context is done")
+	}
+}
+
+// newTestTCPPool returns the pool of calls to destName with pool, which
+// connect to a loopback address accepting connections until the test
+// completes.
+func newTestTCPPool(
+	t *testing.T, destName string, pool *script.ConnectionPool) *tcpPool {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	addrsMutex.Lock()
+	if addrs == nil {
+		addrs = map[string]string{}
+	}
+	addrs[destName] = listener.Addr().String()
+	addrsMutex.Unlock()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, _ = io.Copy(ioutil.Discard, conn)
+				conn.Close()
+			}()
+		}
+	}()
+
+	key := newClientKey(destName, "", pool)
+	t.Cleanup(func() {
+		tcpPoolsMutex.Lock()
+		delete(tcpPools, key)
+		tcpPoolsMutex.Unlock()
+	})
+	return getTCPPool(key)
+}
+
+func TestTCPPool_Reuse(t *testing.T) {
+	t.Parallel()
+
+	pool := newTestTCPPool(t, "tcp-pool-reuse", nil)
+	ctx := context.Background()
+
+	conn, reused, err := pool.get(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reused {
+		t.Errorf("expected a new connection from an empty pool")
+	}
+	pool.put(conn)
+
+	again, reused, err := pool.get(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != conn || !reused {
+		t.Errorf("expected the idle connection to be reused")
+	}
+	pool.put(again)
+
+	other, reused, err := pool.get(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == conn || reused {
+		t.Errorf("expected a new connection when not reusing")
+	}
+	other.Close()
+}
+
+func TestTCPPool_MaxConnections(t *testing.T) {
+	t.Parallel()
+
+	pool := newTestTCPPool(t, "tcp-pool-max",
+		&script.ConnectionPool{MaxConnections: 1})
+	ctx := context.Background()
+
+	type result struct {
+		conn   net.Conn
+		reused bool
+		err    error
+	}
+	// getWaiting gets a connection from pool in the background, once the
+	// pool's only connection is in use, and fails the test if it does not
+	// wait for it.
+	getWaiting := func(reuse bool) <-chan result {
+		results := make(chan result, 1)
+		go func() {
+			conn, reused, err := pool.get(ctx, reuse)
+			results <- result{conn, reused, err}
+		}()
+		for {
+			pool.mutex.Lock()
+			waiting := pool.waiting
+			pool.mutex.Unlock()
+			if waiting > 0 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		select {
+		case r := <-results:
+			t.Fatalf("expected get to wait; got %v, %v", r.conn, r.err)
+		case <-time.After(50 * time.Millisecond):
+		}
+		return results
+	}
+
+	conn, _, err := pool.get(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A released connection is handed to a call waiting to reuse one.
+	results := getWaiting(true)
+	pool.put(conn)
+	r := <-results
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if r.conn != conn || !r.reused {
+		t.Errorf("expected the released connection to be handed over")
+	}
+
+	// Closing a connection frees its slot for a call waiting for a new one.
+	results = getWaiting(false)
+	conn.Close()
+	r = <-results
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if r.conn == conn || r.reused {
+		t.Errorf("expected a new connection once the slot is freed")
+	}
+
+	// A call gives up waiting once its context is done.
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, _, err := pool.get(timeoutCtx, false); err != context.DeadlineExceeded {
+		t.Errorf("expected %v; actual %v", context.DeadlineExceeded, err)
+	}
+	r.conn.Close()
+}
+
+const tcpServerGraphYAML = `
+services:
+- name: tcp-server
+  type: tcp
+  script:
+  - sleep: 100ms
+`
+
+// serveTCPForTest serves the tcp-server service of tcpServerGraphYAML on a
+// loopback address, and returns its server, its address and the error Serve
+// returns.
+func serveTCPForTest(t *testing.T) (*TCPServer, string, <-chan error) {
+	dir, err := ioutil.TempDir("", "tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "service-graph.yaml")
+	err = ioutil.WriteFile(path, []byte(tcpServerGraphYAML), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler, err := NewReloadingHandler(path, "tcp-server", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &TCPServer{Handler: handler}
+	t.Cleanup(func() { server.Close() })
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- server.Serve(listener) }()
+	return server, listener.Addr().String(), serveErr
+}
+
+// sendTCPRequest dials addr and sends a request, which s is serving once
+// sendTCPRequest returns.
+func sendTCPRequest(t *testing.T, s *TCPServer, addr string) net.Conn {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeTCPRequest(conn, http.Header{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		s.mutex.Lock()
+		state := s.conns[findTCPServerConn(s, conn)]
+		active := state != nil && state.active
+		s.mutex.Unlock()
+		if active {
+			return conn
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// findTCPServerConn returns the connection s accepted from client. It is to
+// be called with s.mutex held.
+func findTCPServerConn(s *TCPServer, client net.Conn) net.Conn {
+	for conn := range s.conns {
+		if conn.RemoteAddr().String() == client.LocalAddr().String() {
+			return conn
+		}
+	}
+	return nil
+}
+
+func TestTCPServer_Shutdown(t *testing.T) {
+	t.Parallel()
+
+	server, addr, serveErr := serveTCPForTest(t)
+	idle, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Close()
+	active := sendTCPRequest(t, server, addr)
+	defer active.Close()
+
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- server.Shutdown(context.Background()) }()
+
+	if _, err := idle.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("expected the idle connection to be closed; actual %v", err)
+	}
+	code, err := readTCPResponse(active)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != http.StatusOK {
+		t.Errorf("expected %d; actual %d", http.StatusOK, code)
+	}
+	if _, err := active.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("expected the connection to be closed after its response; actual %v",
+			err)
+	}
+	if err := <-shutdownErr; err != nil {
+		t.Errorf("expected nil; actual %v", err)
+	}
+	if err := <-serveErr; err != ErrTCPServerClosed {
+		t.Errorf("expected %v; actual %v", ErrTCPServerClosed, err)
+	}
+	if _, err := net.Dial("tcp", addr); err == nil {
+		t.Errorf("expected the listener to be closed")
+	}
+}
+
+func TestTCPServer_ShutdownTimeout(t *testing.T) {
+	t.Parallel()
+
+	server, addr, _ := serveTCPForTest(t)
+	active := sendTCPRequest(t, server, addr)
+	defer active.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected %v; actual %v", context.DeadlineExceeded, err)
+	}
+	if _, err := readTCPResponse(active); err == nil {
+		t.Errorf("expected the connection to be closed before its response")
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package srv
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"istio.io/pkg/log"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/consts"
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/pki"
+)
+
+// TLSMode describes whether a service serves and calls other services over
+// TLS.
+type TLSMode string
+
+const (
+	// TLSModeDisabled serves and calls over plaintext.
+	TLSModeDisabled TLSMode = "disabled"
+	// TLSModeSimple serves and calls over TLS.
+	TLSModeSimple TLSMode = "tls"
+	// TLSModeMutual serves and calls over TLS, presenting and requiring client
+	// certificates.
+	TLSModeMutual TLSMode = "mtls"
+)
+
+// TLSConfigs returns the server and client TLS configs of serviceName for
+// mode, or nil configs if mode is TLSModeDisabled.
+//
+// The certificate and key are read from dir. If it has no certificate, an
+// in-process CA issues one at startup. Peers are only verified if dir has a
+// CA certificate; otherwise any certificate is accepted, which encrypts the
+// traffic without authenticating it.
+func TLSConfigs(mode TLSMode, dir string, serviceName string) (
+	server *tls.Config, client *tls.Config, err error) {
+	switch mode {
+	case TLSModeDisabled:
+		return nil, nil, nil
+	case TLSModeSimple, TLSModeMutual:
+	default:
+		return nil, nil, fmt.Errorf(
+			`unknown TLS mode: %s (must be "%s", "%s" or "%s")`,
+			mode, TLSModeDisabled, TLSModeSimple, TLSModeMutual)
+	}
+
+	cert, err := loadOrIssueCertificate(dir, serviceName)
+	if err != nil {
+		return
+	}
+	roots, err := loadCA(path.Join(dir, consts.TLSCAFileName))
+	if err != nil {
+		return
+	}
+
+	server = &tls.Config{Certificates: []tls.Certificate{cert}}
+	client = &tls.Config{RootCAs: roots}
+	if roots == nil {
+		log.Warnf("%s not found: peer certificates will not be verified",
+			consts.TLSCAFileName)
+		client.InsecureSkipVerify = true
+	}
+	if mode == TLSModeMutual {
+		client.Certificates = []tls.Certificate{cert}
+		server.ClientAuth = tls.RequireAnyClientCert
+		if roots != nil {
+			server.ClientCAs = roots
+			server.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return
+}
+
+func loadOrIssueCertificate(
+	dir string, serviceName string) (tls.Certificate, error) {
+	certPath := path.Join(dir, consts.TLSCertFileName)
+	keyPath := path.Join(dir, consts.TLSKeyFileName)
+	if _, err := os.Stat(certPath); err == nil {
+		log.Infof("loading TLS certificate from %s", certPath)
+		return tls.LoadX509KeyPair(certPath, keyPath)
+	} else if !os.IsNotExist(err) {
+		return tls.Certificate{}, err
+	}
+
+	log.Infof("%s not found: issuing TLS certificate in-process", certPath)
+	ca, err := pki.NewCA(serviceName + " CA")
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	certPEM, keyPEM, err := ca.Issue(serviceName,
+		pki.ServiceDNSNames(serviceName, consts.ServiceGraphNamespace))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// loadCA returns a pool with the certificates in the file at caPath, or nil
+// if there is no such file.
+func loadCA(caPath string) (*x509.CertPool, error) {
+	caPEM, err := ioutil.ReadFile(caPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in %s", caPath)
+	}
+	return roots, nil
+}
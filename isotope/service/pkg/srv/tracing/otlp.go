@@ -0,0 +1,279 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"istio.io/pkg/log"
+)
+
+const (
+	otlpTracesPath = "/v1/traces"
+	scopeName      = "isotope"
+
+	maxQueueSize   = 2048
+	maxBatchSize   = 512
+	exportInterval = 5 * time.Second
+	exportTimeout  = 10 * time.Second
+
+	statusCodeError = 2
+)
+
+// OTLPExporter sends spans in batches to an OpenTelemetry collector, using
+// OTLP over HTTP with JSON encoding. Spans are dropped, rather than slowing
+// down the script, when the collector falls behind.
+type OTLPExporter struct {
+	url         string
+	serviceName string
+	client      *http.Client
+	spans       chan SpanData
+	// stop is closed by Shutdown. spans is never closed, so that spans ended
+	// afterwards, e.g. by requests outliving the shutdown, are dropped
+	// instead of panicking.
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewOTLPExporter returns an OTLPExporter which sends the spans of
+// serviceName to the collector at endpoint, e.g. "http://collector:4318".
+// "/v1/traces" is appended to endpoint unless it already ends with it.
+func NewOTLPExporter(endpoint string, serviceName string) *OTLPExporter {
+	url := strings.TrimSuffix(endpoint, "/")
+	if !strings.HasSuffix(url, otlpTracesPath) {
+		url += otlpTracesPath
+	}
+	e := &OTLPExporter{
+		url:         url,
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: exportTimeout},
+		spans:       make(chan SpanData, maxQueueSize),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// Export queues span to be sent with the next batch. Spans exported after
+// Shutdown are dropped.
+func (e *OTLPExporter) Export(span SpanData) {
+	select {
+	case <-e.stop:
+		log.Debugf("dropping span %s: exporter is shut down", span.Name)
+		return
+	default:
+	}
+	select {
+	case e.spans <- span:
+	default:
+		log.Debugf("dropping span %s: export queue is full", span.Name)
+	}
+}
+
+// Shutdown sends the queued spans and stops e. Spans exported afterwards are
+// dropped.
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	e.stopOnce.Do(func() { close(e.stop) })
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *OTLPExporter) run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+
+	batch := make([]SpanData, 0, maxBatchSize)
+	for {
+		select {
+		case span := <-e.spans:
+			batch = append(batch, span)
+			if len(batch) < maxBatchSize {
+				continue
+			}
+		case <-ticker.C:
+		case <-e.stop:
+			e.drain(batch)
+			return
+		}
+		e.send(batch)
+		batch = batch[:0]
+	}
+}
+
+// drain sends batch along with the spans still queued.
+func (e *OTLPExporter) drain(batch []SpanData) {
+	for {
+		select {
+		case span := <-e.spans:
+			batch = append(batch, span)
+			if len(batch) < maxBatchSize {
+				continue
+			}
+			e.send(batch)
+			batch = batch[:0]
+		default:
+			e.send(batch)
+			return
+		}
+	}
+}
+
+func (e *OTLPExporter) send(batch []SpanData) {
+	if len(batch) == 0 {
+		return
+	}
+	body, err := json.Marshal(e.toRequest(batch))
+	if err != nil {
+		log.Errorf("%s", err)
+		return
+	}
+	response, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Warnf("failed to export %d spans: %s", len(batch), err)
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		log.Warnf("failed to export %d spans: collector responded with %s",
+			len(batch), response.Status)
+	}
+}
+
+func (e *OTLPExporter) toRequest(batch []SpanData) otlpRequest {
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, span := range batch {
+		s := otlpSpan{
+			TraceID:           span.SpanContext.TraceID.String(),
+			SpanID:            span.SpanContext.SpanID.String(),
+			Name:              span.Name,
+			Kind:              int(span.Kind),
+			StartTimeUnixNano: strconv.FormatInt(span.StartTime.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.EndTime.UnixNano(), 10),
+			Attributes:        toKeyValues(span.Attributes),
+		}
+		if span.ParentSpanID != (SpanID{}) {
+			s.ParentSpanID = span.ParentSpanID.String()
+		}
+		if span.Err != nil {
+			s.Status = otlpStatus{Code: statusCodeError, Message: span.Err.Error()}
+		}
+		spans = append(spans, s)
+	}
+	return otlpRequest{
+		ResourceSpans: []otlpResourceSpans{
+			{
+				Resource: otlpResource{
+					Attributes: toKeyValues([]Attribute{
+						{"service.name", e.serviceName},
+					}),
+				},
+				ScopeSpans: []otlpScopeSpans{
+					{Scope: otlpScope{Name: scopeName}, Spans: spans},
+				},
+			},
+		},
+	}
+}
+
+func toKeyValues(attributes []Attribute) []otlpKeyValue {
+	keyValues := make([]otlpKeyValue, 0, len(attributes))
+	for _, a := range attributes {
+		var v otlpAnyValue
+		switch value := a.Value.(type) {
+		case string:
+			v.StringValue = &value
+		case int:
+			s := strconv.Itoa(value)
+			v.IntValue = &s
+		case bool:
+			v.BoolValue = &value
+		default:
+			s := fmt.Sprint(value)
+			v.StringValue = &s
+		}
+		keyValues = append(keyValues, otlpKeyValue{Key: a.Key, Value: v})
+	}
+	return keyValues
+}
+
+// The types below are the JSON encoding of an OTLP
+// ExportTraceServiceRequest. IDs are hex-encoded and 64-bit integers are
+// strings.
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
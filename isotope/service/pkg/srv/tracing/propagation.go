@@ -0,0 +1,160 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Headers which carry trace context, in their canonical form.
+const (
+	traceparentHeader    = "Traceparent"
+	tracestateHeader     = "Tracestate"
+	baggageHeader        = "Baggage"
+	b3Header             = "B3"
+	b3TraceIDHeader      = "X-B3-Traceid"
+	b3SpanIDHeader       = "X-B3-Spanid"
+	b3ParentSpanIDHeader = "X-B3-Parentspanid"
+	b3SampledHeader      = "X-B3-Sampled"
+	b3FlagsHeader        = "X-B3-Flags"
+)
+
+// Headers lists the headers which carry trace context.
+var Headers = []string{
+	traceparentHeader,
+	tracestateHeader,
+	baggageHeader,
+	b3Header,
+	b3TraceIDHeader,
+	b3SpanIDHeader,
+	b3ParentSpanIDHeader,
+	b3SampledHeader,
+	b3FlagsHeader,
+}
+
+// Extract returns the SpanContext in header. The W3C traceparent header takes
+// precedence over the single B3 header, which takes precedence over the
+// multiple X-B3 headers. If none of them is valid, the returned SpanContext
+// is not valid either.
+func Extract(header http.Header) SpanContext {
+	sc, ok := extractTraceparent(header.Get(traceparentHeader))
+	if ok {
+		sc.TraceState = header.Get(tracestateHeader)
+	} else if sc, ok = extractB3(header.Get(b3Header)); !ok {
+		sc, _ = extractB3Multi(header)
+	}
+	sc.Baggage = header.Get(baggageHeader)
+	return sc
+}
+
+// Inject returns a copy of header with its trace context replaced by sc, in
+// both the W3C and the multiple X-B3 headers.
+func Inject(header http.Header, sc SpanContext) http.Header {
+	injected := make(http.Header, len(header)+len(Headers))
+	for key, values := range header {
+		injected[key] = values
+	}
+	for _, key := range Headers {
+		delete(injected, key)
+	}
+
+	flags := 0
+	sampled := "0"
+	if sc.Sampled {
+		flags = 1
+		sampled = "1"
+	}
+	injected.Set(traceparentHeader,
+		fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, flags))
+	if sc.TraceState != "" {
+		injected.Set(tracestateHeader, sc.TraceState)
+	}
+	injected.Set(b3TraceIDHeader, sc.TraceID.String())
+	injected.Set(b3SpanIDHeader, sc.SpanID.String())
+	injected.Set(b3SampledHeader, sampled)
+	if sc.Baggage != "" {
+		injected.Set(baggageHeader, sc.Baggage)
+	}
+	return injected
+}
+
+// extractTraceparent parses a W3C traceparent header:
+// "{version}-{trace-id}-{parent-id}-{trace-flags}".
+func extractTraceparent(s string) (sc SpanContext, ok bool) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || parts[0] == "ff" || len(parts[3]) != 2 {
+		return
+	}
+	if len(parts[0]) != 2 || (parts[0] == "00" && len(parts) != 4) {
+		return
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return parseIDs(sc, parts[1], parts[2])
+}
+
+// extractB3 parses a single B3 header:
+// "{trace-id}-{span-id}[-{sampling-state}[-{parent-span-id}]]".
+func extractB3(s string) (sc SpanContext, ok bool) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 2 || len(parts) > 4 {
+		return
+	}
+	sc.Sampled = true
+	if len(parts) > 2 {
+		sc.Sampled = parts[2] == "1" || parts[2] == "d"
+	}
+	return parseIDs(sc, padTraceID(parts[0]), parts[1])
+}
+
+// extractB3Multi parses the X-B3 headers. Without a sampling decision, the
+// span is sampled.
+func extractB3Multi(header http.Header) (sc SpanContext, ok bool) {
+	sampled := header.Get(b3SampledHeader)
+	sc.Sampled = sampled == "" || sampled == "1" || sampled == "true" ||
+		header.Get(b3FlagsHeader) == "1"
+	return parseIDs(sc,
+		padTraceID(header.Get(b3TraceIDHeader)), header.Get(b3SpanIDHeader))
+}
+
+// padTraceID extends 64-bit B3 trace IDs to 128 bits.
+func padTraceID(s string) string {
+	if len(s) == 16 {
+		return strings.Repeat("0", 16) + s
+	}
+	return s
+}
+
+func parseIDs(
+	sc SpanContext, traceID string, spanID string) (SpanContext, bool) {
+	if !decodeHex(sc.TraceID[:], traceID) || !decodeHex(sc.SpanID[:], spanID) {
+		return SpanContext{}, false
+	}
+	return sc, sc.IsValid()
+}
+
+func decodeHex(dst []byte, s string) bool {
+	if hex.DecodedLen(len(s)) != len(dst) {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
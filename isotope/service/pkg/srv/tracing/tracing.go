@@ -0,0 +1,211 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tracing creates spans for the script of an isotope service and
+// propagates their context to the services it calls.
+package tracing
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"math/rand"
+	"time"
+)
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanContext is the part of a span which is propagated to other services.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+	// TraceState is the W3C tracestate header, forwarded as is.
+	TraceState string
+	// Baggage is the W3C baggage header, forwarded as is.
+	Baggage string
+}
+
+// IsValid returns true if sc identifies a span.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// SpanKind describes the relationship of a span to its parent and children.
+// Its values match those of OTLP.
+type SpanKind int
+
+const (
+	// SpanKindInternal is a span for work done within a service.
+	SpanKindInternal SpanKind = 1
+	// SpanKindServer is a span for handling an inbound request.
+	SpanKindServer SpanKind = 2
+	// SpanKindClient is a span for an outbound request.
+	SpanKindClient SpanKind = 3
+)
+
+// Attribute is a key-value pair describing a span. Value must be a string,
+// an int, or a bool.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// SpanData is a finished span, as passed to an Exporter.
+type SpanData struct {
+	Name         string
+	Kind         SpanKind
+	SpanContext  SpanContext
+	ParentSpanID SpanID
+	StartTime    time.Time
+	EndTime      time.Time
+	Attributes   []Attribute
+	Err          error
+}
+
+// Exporter sends finished spans to a tracing backend.
+type Exporter interface {
+	Export(span SpanData)
+}
+
+// Tracer creates spans and passes the sampled ones to its Exporter once they
+// end. A nil *Tracer creates no spans.
+type Tracer struct {
+	exporter Exporter
+}
+
+// NewTracer returns a Tracer which exports its spans with exporter.
+func NewTracer(exporter Exporter) *Tracer {
+	return &Tracer{exporter: exporter}
+}
+
+// Start creates a span which is a child of the span in ctx, or the root of a
+// new, sampled trace if ctx has none. It returns the span and a copy of ctx
+// which carries it. If t is nil, ctx is returned with a nil span.
+func (t *Tracer) Start(
+	ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	parent := SpanContextFromContext(ctx)
+	sc := parent
+	var parentSpanID SpanID
+	if parent.IsValid() {
+		parentSpanID = parent.SpanID
+	} else {
+		sc = SpanContext{
+			TraceID: newTraceID(),
+			Sampled: true,
+			Baggage: parent.Baggage,
+		}
+	}
+	sc.SpanID = newSpanID()
+
+	span := &Span{
+		tracer: t,
+		data: SpanData{
+			Name:         name,
+			Kind:         kind,
+			SpanContext:  sc,
+			ParentSpanID: parentSpanID,
+			StartTime:    time.Now(),
+		},
+	}
+	return ContextWithSpanContext(ctx, sc), span
+}
+
+// Span is an operation being traced. Its methods do nothing on a nil *Span.
+// A Span must not be used by more than one goroutine.
+type Span struct {
+	tracer *Tracer
+	data   SpanData
+}
+
+// SpanContext returns the context to propagate to the children of s.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.data.SpanContext
+}
+
+// SetAttribute adds key with value to s.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.data.Attributes = append(s.data.Attributes, Attribute{key, value})
+}
+
+// SetError marks s as failed with err.
+func (s *Span) SetError(err error) {
+	if s == nil {
+		return
+	}
+	s.data.Err = err
+}
+
+// End finishes s and exports it if it is sampled.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.data.EndTime = time.Now()
+	if s.data.SpanContext.Sampled && s.tracer.exporter != nil {
+		s.tracer.exporter.Export(s.data)
+	}
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpanContext returns a copy of ctx which carries sc as the parent
+// of the spans started with it.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFromContext returns the SpanContext carried by ctx, or the zero
+// SpanContext if there is none.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc
+}
+
+func newTraceID() (id TraceID) {
+	for id == (TraceID{}) {
+		binary.BigEndian.PutUint64(id[:8], rand.Uint64())
+		binary.BigEndian.PutUint64(id[8:], rand.Uint64())
+	}
+	return
+}
+
+func newSpanID() (id SpanID) {
+	for id == (SpanID{}) {
+		binary.BigEndian.PutUint64(id[:], rand.Uint64())
+	}
+	return
+}
@@ -0,0 +1,241 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestExtract(t *testing.T) {
+	var (
+		traceID = TraceID{
+			0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6,
+			0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36}
+		shortTraceID = TraceID{
+			8: 0xa3, 9: 0xce, 10: 0x92, 11: 0x9d,
+			12: 0x0e, 13: 0x0e, 14: 0x47, 15: 0x36}
+		spanID = SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7}
+	)
+
+	tests := []struct {
+		header      http.Header
+		spanContext SpanContext
+	}{
+		{
+			http.Header{},
+			SpanContext{},
+		},
+		{
+			http.Header{
+				"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+				"Tracestate":  {"vendor=value"},
+				"Baggage":     {"user=alice"},
+			},
+			SpanContext{
+				TraceID:    traceID,
+				SpanID:     spanID,
+				Sampled:    true,
+				TraceState: "vendor=value",
+				Baggage:    "user=alice",
+			},
+		},
+		{
+			http.Header{
+				"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"},
+			},
+			SpanContext{TraceID: traceID, SpanID: spanID},
+		},
+		{
+			http.Header{
+				"Traceparent": {"00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+			},
+			SpanContext{},
+		},
+		{
+			http.Header{
+				"B3": {"4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0"},
+			},
+			SpanContext{TraceID: traceID, SpanID: spanID},
+		},
+		{
+			http.Header{
+				"X-B3-Traceid": {"a3ce929d0e0e4736"},
+				"X-B3-Spanid":  {"00f067aa0ba902b7"},
+			},
+			SpanContext{TraceID: shortTraceID, SpanID: spanID, Sampled: true},
+		},
+		{
+			http.Header{
+				"X-B3-Traceid": {"4bf92f3577b34da6a3ce929d0e0e4736"},
+				"X-B3-Spanid":  {"00f067aa0ba902b7"},
+				"X-B3-Sampled": {"0"},
+			},
+			SpanContext{TraceID: traceID, SpanID: spanID},
+		},
+		{
+			http.Header{
+				"X-B3-Traceid": {"not hex"},
+				"X-B3-Spanid":  {"00f067aa0ba902b7"},
+			},
+			SpanContext{},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			spanContext := Extract(test.header)
+			if test.spanContext != spanContext {
+				t.Errorf("expected %v; actual %v", test.spanContext, spanContext)
+			}
+		})
+	}
+}
+
+func TestInject(t *testing.T) {
+	t.Parallel()
+
+	header := http.Header{
+		"X-Request-Id":      {"1"},
+		"B3":                {"1"},
+		"X-B3-Parentspanid": {"00f067aa0ba902b7"},
+	}
+	sc := SpanContext{
+		TraceID: newTraceID(),
+		SpanID:  newSpanID(),
+		Sampled: true,
+		Baggage: "user=alice",
+	}
+
+	injected := Inject(header, sc)
+	if len(header) != 3 {
+		t.Errorf("expected header to be unchanged; actual %v", header)
+	}
+	if injected.Get("X-Request-Id") != "1" {
+		t.Errorf("expected X-Request-Id to be kept; actual %v", injected)
+	}
+	if injected.Get("B3") != "" || injected.Get("X-B3-Parentspanid") != "" {
+		t.Errorf("expected stale trace headers to be removed; actual %v", injected)
+	}
+	if extracted := Extract(injected); sc != extracted {
+		t.Errorf("expected %v; actual %v", sc, extracted)
+	}
+	delete(injected, "Traceparent")
+	if extracted := Extract(injected); sc != extracted {
+		t.Errorf("expected %v from B3 headers; actual %v", sc, extracted)
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	t.Parallel()
+
+	requests := make(chan otlpRequest, 1)
+	collector := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/v1/traces" {
+				t.Errorf("expected /v1/traces; actual %s", r.URL.Path)
+			}
+			var request otlpRequest
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				t.Error(err)
+			}
+			requests <- request
+		}))
+	defer collector.Close()
+
+	exporter := NewOTLPExporter(collector.URL, "a")
+	tracer := NewTracer(exporter)
+	ctx, server := tracer.Start(context.Background(), "a", SpanKindServer)
+	_, client := tracer.Start(ctx, "call b", SpanKindClient)
+	client.SetAttribute("peer.service", "b")
+	client.SetError(errors.New("service b responded with 500"))
+	client.End()
+	server.End()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := exporter.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	request := <-requests
+	service := *request.ResourceSpans[0].Resource.Attributes[0].Value.StringValue
+	if service != "a" {
+		t.Errorf("expected service.name a; actual %s", service)
+	}
+	spans := request.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans; actual %v", spans)
+	}
+	clientSpan, serverSpan := spans[0], spans[1]
+	if clientSpan.TraceID != serverSpan.TraceID {
+		t.Errorf("expected spans in the same trace; actual %v", spans)
+	}
+	if clientSpan.ParentSpanID != serverSpan.SpanID {
+		t.Errorf("expected client span to be a child of the server span; "+
+			"actual %v", spans)
+	}
+	if serverSpan.ParentSpanID != "" {
+		t.Errorf("expected server span to be a root; actual %v", serverSpan)
+	}
+	if clientSpan.Kind != int(SpanKindClient) ||
+		clientSpan.Status.Code != statusCodeError {
+		t.Errorf("unexpected client span %v", clientSpan)
+	}
+}
+
+func TestOTLPExporter_ExportAfterShutdown(t *testing.T) {
+	t.Parallel()
+
+	collector := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {}))
+	defer collector.Close()
+
+	exporter := NewOTLPExporter(collector.URL, "a")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := exporter.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	_, span := NewTracer(exporter).Start(
+		context.Background(), "a", SpanKindServer)
+	span.End()
+	if err := exporter.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTracer_Nil(t *testing.T) {
+	t.Parallel()
+
+	var tracer *Tracer
+	ctx := context.Background()
+	actualCtx, span := tracer.Start(ctx, "a", SpanKindServer)
+	if span != nil || actualCtx != ctx {
+		t.Errorf("expected no span; actual %v", span)
+	}
+	span.SetAttribute("k", "v")
+	span.SetError(errors.New("error"))
+	span.End()
+}
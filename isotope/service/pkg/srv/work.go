@@ -0,0 +1,76 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package srv
+
+import (
+	"context"
+	"crypto/sha256"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/script"
+)
+
+// ctxCheckInterval is how many hashes are computed between checks for
+// cancellation or the end of a compute command.
+const ctxCheckInterval = 1024
+
+var (
+	// retained holds the memory of AllocateCommands with Retain set.
+	retained      [][]byte
+	retainedMutex sync.Mutex
+)
+
+// compute keeps a CPU busy hashing, for cmd's Duration of wall-clock time or
+// for cmd's Iterations hashes, or until ctx is done.
+func compute(ctx context.Context, cmd script.ComputeCommand) error {
+	var deadline time.Time
+	if cmd.Duration > 0 {
+		deadline = time.Now().Add(time.Duration(cmd.Duration))
+	}
+	var sum [sha256.Size]byte
+	for i := 1; cmd.Iterations == 0 || i <= cmd.Iterations; i++ {
+		sum = sha256.Sum256(sum[:])
+		if i%ctxCheckInterval != 0 {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			break
+		}
+	}
+	return ctx.Err()
+}
+
+// allocate allocates cmd's Size bytes and writes to each page so that they
+// are resident. Unless cmd retains them, they are left to the garbage
+// collector.
+func allocate(cmd script.AllocateCommand) {
+	b := make([]byte, cmd.Size)
+	pageSize := os.Getpagesize()
+	for i := 0; i < len(b); i += pageSize {
+		b[i] = 1
+	}
+	if cmd.Retain {
+		retainedMutex.Lock()
+		retained = append(retained, b)
+		retainedMutex.Unlock()
+	}
+	runtime.KeepAlive(b)
+}
@@ -0,0 +1,131 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this currentFile except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"istio.io/pkg/log"
+
+	"github.com/kristofgyuracz/istio-tools/isotope/convert/pkg/graph/script"
+	"github.com/kristofgyuracz/istio-tools/isotope/service/pkg/sim"
+	"github.com/kristofgyuracz/istio-tools/isotope/service/pkg/srv/prometheus"
+)
+
+// simulateCommand is the first argument which runs the whole service graph in
+// this process instead of a single service.
+const simulateCommand = "simulate"
+
+// simulate runs every service of the service graph file named by args in this
+// process, on localhost, until interrupted or, if --load is set, until the
+// load completes.
+func simulate(args []string) {
+	flags := flag.NewFlagSet(simulateCommand, flag.ExitOnError)
+	basePort := flags.Int(
+		"base-port", 0,
+		"port of the first service, followed by the others in order; "+
+			"free ports are picked if 0")
+	metricsPort := flags.Int(
+		"metrics-port", 0,
+		"port of the Prometheus endpoint of all services; 0 disables it")
+	configPollInterval := flags.Duration(
+		"config-poll-interval", 5*time.Second,
+		"how often to check the service graph file for changes to reload; "+
+			"0 disables reloading")
+	load := flags.String(
+		"load", "",
+		`service, or "service/endpoint", to send load to; no load is sent `+
+			"if empty")
+	qps := flags.Float64(
+		"qps", 0, "requests per second of the load; 0 sends them back to back")
+	concurrency := flags.Int(
+		"concurrency", 1, "number of concurrent requests of the load")
+	requests := flags.Int(
+		"requests", 0, "number of requests of the load; 0 is unlimited")
+	loadDuration := flags.Duration(
+		"duration", 10*time.Second, "duration of the load; 0 is unlimited")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(),
+			"Usage: %s %s [flags] <service graph YAML file>\n",
+			os.Args[0], simulateCommand)
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	promHandler := prometheus.Handler(nil)
+	if *metricsPort > 0 {
+		go func() {
+			err := http.ListenAndServe(
+				fmt.Sprintf(":%d", *metricsPort),
+				withPrometheus(nil, promHandler))
+			log.Errorf("Prometheus endpoint: %s", err)
+		}()
+	}
+
+	s, err := sim.Start(flags.Arg(0), sim.Options{BasePort: *basePort})
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancel()
+	}()
+	if *configPollInterval > 0 {
+		s.Watch(ctx, *configPollInterval)
+	}
+
+	if *load == "" {
+		<-ctx.Done()
+		return
+	}
+	// Parse the target like the service of a call command.
+	var request script.RequestCommand
+	if err := json.Unmarshal([]byte(strconv.Quote(*load)), &request); err != nil {
+		log.Fatalf("invalid --load: %s", err)
+	}
+	result, err := s.Drive(ctx, sim.Load{
+		Request:     request,
+		QPS:         *qps,
+		Concurrency: *concurrency,
+		Requests:    *requests,
+		Duration:    *loadDuration,
+	})
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	fmt.Println(result)
+	if result.FirstError != nil {
+		fmt.Printf("first error: %s\n", result.FirstError)
+	}
+}